@@ -0,0 +1,201 @@
+package buildctx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/containerclient"
+	"github.com/quay/quay-builder/rpc"
+)
+
+// dockerHubRegistry is the name Docker Hub is normalized to.
+const dockerHubRegistry = "docker.io"
+
+// normalizeRegistry converts a registry as it may appear as a key in a docker
+// config.json (e.g. "https://index.docker.io/v1/") to the hostname used in
+// image references (e.g. "docker.io").
+func normalizeRegistry(registry string) string {
+	registry = strings.ToLower(strings.TrimSpace(registry))
+	if strings.Contains(registry, "://") {
+		if u, err := url.Parse(registry); err == nil {
+			registry = u.Host
+		}
+	}
+	registry = strings.TrimSuffix(registry, "/")
+	if i := strings.Index(registry, "/"); i >= 0 {
+		registry = registry[:i]
+	}
+
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHubRegistry
+	}
+	return registry
+}
+
+// registryCredentials converts credentials sent by the BuildManager to the
+// form used by the container client. An "auth" field is only used when no
+// username is given.
+func registryCredentials(creds rpc.RegistryCredentials) (containerclient.AuthConfiguration, bool) {
+	if creds.Username != "" {
+		return containerclient.AuthConfiguration{Username: creds.Username, Password: creds.Password}, true
+	}
+
+	if creds.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(creds.Auth)
+		if err != nil {
+			log.Warningf("ignoring invalid registry auth: %s", err)
+			return containerclient.AuthConfiguration{}, false
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			log.Warningf("ignoring invalid registry auth: missing password")
+			return containerclient.AuthConfiguration{}, false
+		}
+		return containerclient.AuthConfiguration{Username: username, Password: password}, true
+	}
+
+	return containerclient.AuthConfiguration{}, false
+}
+
+// registryAuth returns the credentials the BuildManager sent for registry, if
+// any.
+func registryAuth(args *rpc.BuildArgs, registry string) (containerclient.AuthConfiguration, bool) {
+	registry = normalizeRegistry(registry)
+	for key, creds := range args.RegistryAuths {
+		if normalizeRegistry(key) == registry {
+			return registryCredentials(creds)
+		}
+	}
+
+	return containerclient.AuthConfiguration{}, false
+}
+
+// imageRegistry returns the registry of an image, or "" if the image name is
+// invalid.
+func imageRegistry(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	return reference.Domain(named)
+}
+
+// buildAuthConfigs returns the credentials, keyed by registry, used for any
+// images pulled by the build itself, such as the base images of other stages.
+// The base image credentials are used for the build's own registry unless the
+// BuildManager sent others for it.
+func buildAuthConfigs(args *rpc.BuildArgs) map[string]containerclient.AuthConfiguration {
+	auths := map[string]containerclient.AuthConfiguration{}
+	for key, creds := range args.RegistryAuths {
+		if auth, ok := registryCredentials(creds); ok {
+			auths[normalizeRegistry(key)] = auth
+		}
+	}
+
+	if args.BaseImage.Username != "" && args.Registry != "" {
+		registry := normalizeRegistry(args.Registry)
+		if _, ok := auths[registry]; !ok {
+			auths[registry] = containerclient.AuthConfiguration{
+				Username: args.BaseImage.Username,
+				Password: args.BaseImage.Password,
+			}
+		}
+	}
+
+	return auths
+}
+
+// defaultRegistryCAFile is the CA bundle entrypoint.sh writes from CA_CERT,
+// which the container runtime trusts when pushing the build.
+const defaultRegistryCAFile = "/certs/cacert.crt"
+
+// registryAccess is how the builder accesses the build's registry directly,
+// the same way the container runtime pushes to it.
+type registryAccess struct {
+	// insecure is whether the registry is accessed over plain HTTP or without
+	// verifying its certificate.
+	insecure bool
+	// rootCAs are the CAs trusted to sign the registry's certificate, or nil
+	// for the system's.
+	rootCAs *x509.CertPool
+}
+
+// newRegistryAccess returns how to access the build's registry: insecurely if
+// the container runtime does, trusting the CAs in registryCAsFromEnv.
+func newRegistryAccess(containerClient containerclient.Client, registry string) registryAccess {
+	return registryAccess{
+		insecure: containerClient.InsecureRegistry(registry),
+		rootCAs:  registryCAsFromEnv(),
+	}
+}
+
+// registryCAsFromEnv returns the system's CAs along with those in the bundle
+// named by REGISTRY_CA_FILE, or in defaultRegistryCAFile if it exists. It
+// returns nil if there is no bundle.
+func registryCAsFromEnv() *x509.CertPool {
+	filename := os.Getenv("REGISTRY_CA_FILE")
+	if filename == "" {
+		if _, err := os.Stat(defaultRegistryCAFile); err != nil {
+			return nil
+		}
+		filename = defaultRegistryCAFile
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		log.Warningf("ignoring registry CA bundle: %s", err)
+		return nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		log.Warningf("ignoring registry CA bundle %s: no certificates found", filename)
+		return nil
+	}
+
+	return pool
+}
+
+// repository returns the name of the repository in the registry.
+func (ra registryAccess) repository(repository string) (name.Repository, error) {
+	var opts []name.Option
+	if ra.insecure {
+		opts = append(opts, name.Insecure)
+	}
+	return name.NewRepository(repository, opts...)
+}
+
+// remoteOptions returns the options for accessing the registry with auth.
+func (ra registryAccess) remoteOptions(auth authn.Authenticator) []remote.Option {
+	opts := []remote.Option{remote.WithAuth(auth)}
+	if !ra.insecure && ra.rootCAs == nil {
+		return opts
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: ra.rootCAs, InsecureSkipVerify: ra.insecure}
+	return append(opts, remote.WithTransport(transport))
+}
+
+// pushRemoteOptions returns the options for accessing the build's repository
+// directly with the push token, such as to push artifacts attached to the
+// built image.
+func pushRemoteOptions(args *rpc.BuildArgs, access registryAccess) []remote.Option {
+	return access.remoteOptions(&authn.Basic{Username: "$token", Password: args.PushToken})
+}
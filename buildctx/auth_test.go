@@ -0,0 +1,98 @@
+package buildctx
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/quay/quay-builder/containerclient"
+	"github.com/quay/quay-builder/rpc"
+)
+
+func TestNormalizeRegistry(t *testing.T) {
+	table := []struct {
+		registry string
+		expected string
+	}{
+		{"quay.io", "quay.io"},
+		{"Quay.IO", "quay.io"},
+		{"https://index.docker.io/v1/", "docker.io"},
+		{"index.docker.io", "docker.io"},
+		{"registry-1.docker.io", "docker.io"},
+		{"https://ghcr.io", "ghcr.io"},
+		{"localhost:5000/", "localhost:5000"},
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com", "123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+	}
+
+	for _, tt := range table {
+		if got := normalizeRegistry(tt.registry); got != tt.expected {
+			t.Errorf("normalizeRegistry(%q): got %q, wanted %q", tt.registry, got, tt.expected)
+		}
+	}
+}
+
+func TestBaseImageAuth(t *testing.T) {
+	args := &rpc.BuildArgs{
+		Registry:  "quay.io",
+		BaseImage: rpc.BuildArgsBaseImage{Username: "robot", Password: "secret"},
+		RegistryAuths: map[string]rpc.RegistryCredentials{
+			"https://index.docker.io/v1/": {Auth: "aHViOmh1YnBhc3M="}, // hub:hubpass
+			"ghcr.io":                     {Username: "gh", Password: "ghpass"},
+			"broken.example.com":          {Auth: "not base64"},
+		},
+	}
+
+	table := []struct {
+		image    string
+		expected containerclient.AuthConfiguration
+		ok       bool
+	}{
+		{"quay.io/myorg/base", containerclient.AuthConfiguration{Username: "robot", Password: "secret"}, true},
+		{"ubuntu", containerclient.AuthConfiguration{Username: "hub", Password: "hubpass"}, true},
+		{"docker.io/myorg/base", containerclient.AuthConfiguration{Username: "hub", Password: "hubpass"}, true},
+		{"ghcr.io/myorg/base", containerclient.AuthConfiguration{Username: "gh", Password: "ghpass"}, true},
+		{"broken.example.com/base", containerclient.AuthConfiguration{}, false},
+		{"registry.example.com/base", containerclient.AuthConfiguration{}, false},
+	}
+
+	for _, tt := range table {
+		auth, ok := baseImageAuth(args, tt.image)
+		if auth != tt.expected || ok != tt.ok {
+			t.Errorf("%s: got %+v, %t, wanted %+v, %t", tt.image, auth, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestCacheAuth(t *testing.T) {
+	auths := map[string]rpc.RegistryCredentials{"quay.io": {Username: "robot", Password: "secret"}}
+
+	token := cacheAuth(&rpc.BuildArgs{Registry: "quay.io", PullToken: "token", RegistryAuths: auths})
+	if token != (containerclient.AuthConfiguration{Username: "$token", Password: "token"}) {
+		t.Errorf("the pull token wasn't used: got %+v", token)
+	}
+
+	creds := cacheAuth(&rpc.BuildArgs{Registry: "quay.io", RegistryAuths: auths})
+	if creds != (containerclient.AuthConfiguration{Username: "robot", Password: "secret"}) {
+		t.Errorf("the registry credentials weren't used: got %+v", creds)
+	}
+}
+
+func TestBuildAuthConfigs(t *testing.T) {
+	args := &rpc.BuildArgs{
+		Registry:  "quay.io",
+		BaseImage: rpc.BuildArgsBaseImage{Username: "robot", Password: "secret"},
+		RegistryAuths: map[string]rpc.RegistryCredentials{
+			"https://index.docker.io/v1/": {Username: "hub", Password: "hubpass"},
+			"ghcr.io":                     {Username: "gh", Password: "ghpass"},
+			"empty.example.com":           {},
+		},
+	}
+
+	expected := map[string]containerclient.AuthConfiguration{
+		"quay.io":   {Username: "robot", Password: "secret"},
+		"docker.io": {Username: "hub", Password: "hubpass"},
+		"ghcr.io":   {Username: "gh", Password: "ghpass"},
+	}
+	if got := buildAuthConfigs(args); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, wanted %+v", got, expected)
+	}
+}
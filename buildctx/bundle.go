@@ -0,0 +1,138 @@
+package buildctx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/buildlog"
+	"github.com/quay/quay-builder/rpc"
+	"github.com/quay/quay-builder/version"
+)
+
+// bundleUploadTimeout is how long an attempt to upload the log bundle may
+// take.
+const bundleUploadTimeout = 2 * time.Minute
+
+// bundleMetadata describes the build in a log bundle. It holds nothing from
+// the build args that may be secret, such as tokens, keys or credentials in
+// URLs.
+type bundleMetadata struct {
+	BuilderVersion string         `json:"builder_version"`
+	Repository     string         `json:"repository"`
+	TagNames       []string       `json:"tag_names"`
+	Source         resourceDigest `json:"source"`
+	Context        string         `json:"context,omitempty"`
+	DockerfilePath string         `json:"dockerfile_path"`
+	ContextDigest  string         `json:"context_digest,omitempty"`
+	BaseImages     []string       `json:"base_images,omitempty"`
+	ImageID        string         `json:"image_id,omitempty"`
+	Digests        []string       `json:"digests,omitempty"`
+	Error          string         `json:"error,omitempty"`
+	ErrorType      string         `json:"error_type,omitempty"`
+}
+
+// logBundle returns the files in the log bundle of the build: the build log
+// file, the Dockerfile and metadata about the build.
+func (bc *Context) logBundle(logFile string, bmd *rpc.BuildMetadata, buildErr error) ([]buildlog.File, error) {
+	logs, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		return nil, err
+	}
+	files := []buildlog.File{{Name: "build.jsonl", Data: logs}}
+
+	if bc.dockerfile != nil {
+		files = append(files, buildlog.File{Name: path.Base(bc.args.DockerfilePath), Data: bc.dockerfile})
+	}
+
+	metadata := bundleMetadata{
+		BuilderVersion: version.Version,
+		Repository:     bc.args.FullRepoName(),
+		TagNames:       bc.args.TagNames,
+		Source:         provenanceSource(bc.args, bc.commitSHA),
+		Context:        bc.args.Context,
+		DockerfilePath: bc.args.DockerfilePath,
+		ContextDigest:  bc.contextDigest,
+	}
+	if bc.metadata != nil {
+		metadata.BaseImages = bc.metadata.BaseImages
+	}
+	if bmd != nil {
+		metadata.ImageID = bmd.ImageID
+		metadata.Digests = bmd.Digests
+	}
+	if buildErr != nil {
+		metadata.Error = buildErr.Error()
+		metadata.ErrorType = fmt.Sprintf("%T", buildErr)
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, buildlog.File{Name: "metadata.json", Data: data})
+
+	return files, nil
+}
+
+// UploadLogBundle uploads a gzipped tarball of the build log file, the
+// Dockerfile and metadata about the build to the URL sent by the
+// BuildManager, so that builds can be debugged after the builder is gone.
+func (bc *Context) UploadLogBundle(logFile string, bmd *rpc.BuildMetadata, buildErr error) error {
+	files, err := bc.logBundle(logFile, bmd, buildErr)
+	if err != nil {
+		return fmt.Errorf("failed to bundle build logs: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := buildlog.WriteBundle(&buf, files); err != nil {
+		return fmt.Errorf("failed to bundle build logs: %w", err)
+	}
+
+	err = bc.retryPolicy.Do(func() error {
+		return uploadBundle(bc.args.LogBundleURL, buf.Bytes())
+	}, func(err error, attempt int, backoff time.Duration) {
+		log.Infof("failed to upload log bundle (attempt #%d), retrying in %s: %s", attempt, backoff, err)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("uploaded log bundle (%d bytes) to %s", buf.Len(), redactURL(bc.args.LogBundleURL))
+	return nil
+}
+
+// uploadBundle PUTs the bundle to the URL, which is usually presigned. The URL
+// is redacted from errors, as its query may hold a signature.
+func uploadBundle(bundleURL string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, bundleURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.New("invalid log bundle URL")
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+
+	client := &http.Client{Timeout: bundleUploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = redactURL(uerr.URL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to upload log bundle: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -1,16 +1,24 @@
 package buildctx
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/distribution/reference"
+	units "github.com/docker/go-units"
 	log "github.com/sirupsen/logrus"
 
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/quay/quay-builder/buildpack"
 	"github.com/quay/quay-builder/containerclient"
 	"github.com/quay/quay-builder/containerclient/dockerfile"
+	"github.com/quay/quay-builder/retry"
 	"github.com/quay/quay-builder/rpc"
 )
 
@@ -23,6 +31,18 @@ const (
 	scratchImageID   = "511136ea3c5a64f264b78b5433614aec563103b4d4702f3ba7d4d2698e22c158"
 )
 
+// largeContextSize is the size of build context above which users are warned
+// that their builds may be slow.
+const largeContextSize = 500 << 20
+
+// revisionLabel is the label applied to built images recording the git commit
+// they were built from.
+const revisionLabel = "org.opencontainers.image.revision"
+
+// contextDigestLabel is the label applied to built images recording the digest
+// of the build context, Dockerfile and build parameters they were built from.
+const contextDigestLabel = "io.quay.build.context-digest"
+
 // Context represents the internal state of a build.
 type Context struct {
 	client          rpc.Client
@@ -31,8 +51,31 @@ type Context struct {
 	args            *rpc.BuildArgs
 	metadata        *dockerfile.Metadata
 	buildpackDir    string
+	commitSHA       string
 	buildID         string
 	cacheTag        string
+	contextDigest   string
+	sourceDateEpoch *time.Time
+	maxContextSize  int64
+	baseImagePolicy *rpc.BaseImagePolicy
+	registryMirrors map[string][]registryMirror
+	mirroredImages  []string
+	pullMetadata    *rpc.PullMetadata
+	retryPolicy     retry.Policy
+	registry        registryAccess
+	buildArgs       map[string]string
+	startedOn       time.Time
+	finishedOn      time.Time
+	dockerfile      []byte
+}
+
+// streamWriter writes plain text lines to the build logs.
+type streamWriter struct {
+	w containerclient.LogWriter
+}
+
+func (sw streamWriter) Write(p []byte) (int, error) {
+	return len(p), sw.w.WriteStream(string(p))
 }
 
 // New connects to the docker daemon and sets up the initial state of a build
@@ -48,14 +91,88 @@ func New(client rpc.Client, args *rpc.BuildArgs, dockerHost, containerRuntime st
 	}
 	log.Infof("connected to docker host: %s", dockerHost)
 
+	baseImagePolicy, err := baseImagePolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	registryMirrors, err := registryMirrorsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	retryPolicy, err := retryPolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Context{
 		client:          client,
 		writer:          containerclient.NewRPCWriter(client, containerRuntime),
 		containerClient: containerClient,
 		args:            args,
+		maxContextSize:  maxContextSizeFromEnv(),
+		baseImagePolicy: baseImagePolicy,
+		registryMirrors: registryMirrors,
+		retryPolicy:     retryPolicy,
+		registry:        newRegistryAccess(containerClient, args.Registry),
+		startedOn:       time.Now(),
 	}, nil
 }
 
+// maxContextSizeFromEnv returns the largest build context allowed by
+// BUILD_CONTEXT_MAX_SIZE (e.g. "2g"), or zero if there is no maximum.
+func maxContextSizeFromEnv() int64 {
+	value := os.Getenv("BUILD_CONTEXT_MAX_SIZE")
+	if value == "" {
+		return 0
+	}
+
+	size, err := units.RAMInBytes(value)
+	if err != nil || size <= 0 {
+		log.Warningf("ignoring invalid BUILD_CONTEXT_MAX_SIZE %q", value)
+		return 0
+	}
+
+	return size
+}
+
+// retryPolicyFromEnv returns the policy for retrying pulls and pushes, with
+// the defaults overridden by REGISTRY_RETRY_ATTEMPTS, REGISTRY_RETRY_BACKOFF
+// and REGISTRY_RETRY_MAX_BACKOFF (e.g. "2s").
+func retryPolicyFromEnv() (retry.Policy, error) {
+	policy := retry.DefaultPolicy
+
+	if value := os.Getenv("REGISTRY_RETRY_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return retry.Policy{}, fmt.Errorf("invalid REGISTRY_RETRY_ATTEMPTS %q: must be a positive number", value)
+		}
+		policy.Attempts = attempts
+	}
+
+	for key, backoff := range map[string]*time.Duration{
+		"REGISTRY_RETRY_BACKOFF":     &policy.InitialBackoff,
+		"REGISTRY_RETRY_MAX_BACKOFF": &policy.MaxBackoff,
+	} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return retry.Policy{}, fmt.Errorf("invalid %s %q: must be a duration", key, value)
+		}
+		*backoff = d
+	}
+
+	if policy.MaxBackoff < policy.InitialBackoff {
+		policy.MaxBackoff = policy.InitialBackoff
+	}
+
+	return policy, nil
+}
+
 // Unpack downloads and expands the buildpack and parses the Dockerfile.
 func (bc *Context) Unpack() error {
 	if err := bc.client.SetPhase(rpc.Unpacking, nil); err != nil {
@@ -63,49 +180,179 @@ func (bc *Context) Unpack() error {
 		return err
 	}
 
-	// Download and expand the buildpack.
-	buildpackDir, err := buildpack.Download(bc.args)
+	// Download and expand the buildpack, streaming the progress of any git
+	// commands to the build logs.
+	buildpackDir, commitSHA, err := buildpack.Download(bc.args, streamWriter{bc.writer})
 	if err != nil {
 		log.Errorf("failed to download buildpack: %v", err)
 		return err
 	}
 	bc.buildpackDir = buildpackDir
+	bc.commitSHA = commitSHA
+
+	// Reproducible builds are timestamped with the time of the commit, or the
+	// epoch if the build package didn't come from git.
+	if bc.args.Reproducible {
+		sourceDateEpoch := time.Unix(0, 0).UTC()
+		if commitSHA != "" {
+			sourceDateEpoch, err = buildpack.CommitTime(buildpackDir, commitSHA)
+			if err != nil {
+				log.Errorf("failed to find time of commit: %v", err)
+				return err
+			}
+		}
+		bc.sourceDateEpoch = &sourceDateEpoch
+		log.Infof("building reproducibly with SOURCE_DATE_EPOCH=%d", sourceDateEpoch.Unix())
+	}
+
+	// Find the Dockerfile, falling back to a Containerfile. The path found is
+	// used for the rest of the build.
+	dockerfilePath, err := dockerfile.FindDockerfile(buildpackDir, bc.args.DockerfilePath)
+	if err != nil {
+		log.Errorf("failed to find dockerfile: %v", err)
+		return err
+	}
+	if dockerfilePath != bc.args.DockerfilePath {
+		log.Infof("using %s as the dockerfile", dockerfilePath)
+		bc.args.DockerfilePath = dockerfilePath
+	}
+
+	// Keep the Dockerfile for the log bundle, as the buildpack is removed once
+	// the image is built.
+	if bc.args.LogBundleURL != "" {
+		bc.dockerfile, err = ioutil.ReadFile(path.Join(buildpackDir, bc.args.DockerfilePath))
+		if err != nil {
+			log.Warningf("failed to read dockerfile for the log bundle: %v", err)
+		}
+	}
 
 	// Parse the Dockerfile.
 	metadata, err := dockerfile.NewMetadataFromDir(buildpackDir, bc.args.DockerfilePath)
 
 	if err != nil {
 		log.Errorf("failed to parse dockerfile: %v", err)
+
+		// Show users where the error is in their Dockerfile.
+		var dockerfileErr rpc.InvalidDockerfileError
+		if errors.As(err, &dockerfileErr) && dockerfileErr.Line > 0 {
+			bc.writer.WriteError(formatDockerfileError(bc.args.DockerfilePath, dockerfileErr))
+		}
 		return err
 	}
 	bc.metadata = metadata
 
+	// Report lint warnings in the build logs, prefixed by their location in
+	// the Dockerfile.
+	for _, w := range metadata.LintWarnings {
+		location := bc.args.DockerfilePath
+		if w.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, w.Line)
+		}
+		bc.writer.WriteStream(fmt.Sprintf("Warning: %s: %s\n", location, w))
+	}
+	if err := metadata.LintError(bc.args.StrictLint); err != nil {
+		log.Errorf("failed to lint dockerfile: %v", err)
+		return err
+	}
+
+	// Check the size of the context before hashing it.
+	if err := checkBuildContext(bc.writer, buildpackDir, bc.args.DockerfilePath, bc.containerClient.IgnoreFiles(), bc.maxContextSize); err != nil {
+		return err
+	}
+
+	// The digest covers the sources, the Dockerfile and the build args passed
+	// to the build, which is everything that affects the image, but not the
+	// revision: building the same sources from a different commit is not a
+	// change. It is computed before the build so that it can be reported to
+	// the BuildManager when pulling starts.
+	buildArgs := map[string]string{}
+	if bc.sourceDateEpoch != nil {
+		buildArgs["SOURCE_DATE_EPOCH"] = strconv.FormatInt(bc.sourceDateEpoch.Unix(), 10)
+	}
+	bc.buildArgs = buildArgs
+	contextDigest, err := dockerfile.ContextDigest(buildpackDir, bc.args.DockerfilePath, bc.containerClient.IgnoreFiles(), buildArgs)
+	if err != nil {
+		log.Errorf("failed to compute build context digest: %v", err)
+		return err
+	}
+	bc.contextDigest = contextDigest.String()
+	log.Infof("build context digest: %s", bc.contextDigest)
+
 	return nil
 }
 
+// formatDockerfileError describes an error found on a line of the Dockerfile
+// named dockerfileName, followed by the lines around it.
+func formatDockerfileError(dockerfileName string, err rpc.InvalidDockerfileError) string {
+	location := fmt.Sprintf("%s:%d", dockerfileName, err.Line)
+	if err.Instruction != "" {
+		location = fmt.Sprintf("%s (%s)", location, err.Instruction)
+	}
+
+	return fmt.Sprintf("%s: %s\n%s", location, err.Message, err.Source)
+}
+
 // Pull executes "docker pull" for the base image of the build's Dockerfile.
+// If a mirror of the base image's registry has the image, it is pulled from
+// there instead, falling back to the registry itself if that fails. Which of
+// them the image was pulled from is only known once it is pulled, so it is
+// reported with the phase after pulling.
 func (bc *Context) Pull() error {
-	if err := bc.client.SetPhase(rpc.Pulling, &rpc.PullMetadata{
-		RegistryURL:  bc.args.Registry,
-		BaseImage:    bc.metadata.BaseImage,
-		BaseImageTag: bc.metadata.BaseImageTag,
-		PullUsername: bc.args.BaseImage.Username,
-	}); err != nil {
+	mirror := bc.findBaseImageMirror()
+
+	pullAuth, _ := baseImageAuth(bc.args, bc.metadata.BaseImage)
+	pullMetadata := &rpc.PullMetadata{
+		RegistryURL:   bc.args.Registry,
+		BaseImage:     bc.metadata.BaseImage,
+		BaseImageTag:  bc.metadata.BaseImageTag,
+		PullUsername:  pullAuth.Username,
+		ContextDigest: bc.contextDigest,
+	}
+	if err := bc.client.SetPhase(rpc.Pulling, pullMetadata); err != nil {
 		log.Errorf("failed to update phase to `pulling`")
 		return err
 	}
 
-	return pullBaseImage(bc.writer, bc.containerClient, bc.metadata, bc.args)
+	pulled := false
+	if mirror != nil {
+		named, _, _ := parseBaseImage(bc.metadata.BaseImage + ":" + bc.metadata.BaseImageTag)
+		mirrored, err := pullFromMirror(bc.writer, bc.containerClient, bc.retryPolicy, mirror, named, bc.metadata.BaseImageTag)
+		if err != nil {
+			log.Warningf("failed to pull base image from mirror %s: %s", mirror.Endpoint, err)
+			bc.writer.WriteStream(fmt.Sprintf("Could not pull from mirror %s, pulling from %s instead\n", mirror.Endpoint, reference.Domain(named)))
+		} else {
+			bc.mirroredImages = append(bc.mirroredImages, mirrored)
+			pulled = true
+		}
+	}
+
+	if !pulled {
+		if err := pullBaseImage(bc.writer, bc.containerClient, bc.retryPolicy, bc.metadata, bc.args); err != nil {
+			return err
+		}
+	}
+
+	pulledFrom := *pullMetadata
+	if mirror != nil && pulled {
+		pulledFrom.MirrorURL = mirror.Endpoint
+		pulledFrom.PullUsername = mirror.Username
+	}
+	bc.pullMetadata = &pulledFrom
+
+	bc.pullStageImagesFromMirrors()
+
+	return pullFrontendImage(bc.writer, bc.containerClient, bc.retryPolicy, bc.metadata)
 }
 
 // Cache calls an RPC to the BuildManager to find the best tag to pull for
 // caching and then "docker pull"s it.
 func (bc *Context) Cache() error {
-	// Attempts to update the phase to checking cache.
+	// Attempts to update the phase to checking cache, along with where the
+	// base image was actually pulled from.
 	// We don't handle the error here, as we currently consider the rpc.CheckingCache phase pulling,
 	// SetPhase will return an rpc.ErrClientRejectedPhaseTransition, since the phase will not change
 	// from the previous one (rpc.CheckingCache).
-	bc.client.SetPhase(rpc.CheckingCache, nil)
+	bc.client.SetPhase(rpc.CheckingCache, bc.pullMetadata)
 
 	// Attempt to calculate the optimal tag. If we cannot find a tag, then caching is simply
 	// skipped.
@@ -116,10 +363,11 @@ func (bc *Context) Cache() error {
 	}
 
 	// Conduct a pull of the existing tag (if any). This will prime the cache.
-	if bc.args.PullToken != "" && cachedTag != "" {
+	_, hasRegistryAuth := registryAuth(bc.args, bc.args.Registry)
+	if (bc.args.PullToken != "" || hasRegistryAuth) && cachedTag != "" {
 		bc.client.SetPhase(rpc.PrimingCache, nil)
 
-		err = primeCache(bc.writer, bc.containerClient, bc.args, cachedTag)
+		err = primeCache(bc.writer, bc.containerClient, bc.retryPolicy, bc.args, cachedTag)
 		if err != nil {
 			log.Warningf("Error priming cache: %s", err.Error())
 		} else {
@@ -145,55 +393,132 @@ func (bc *Context) Build() error {
 			log.Infof("removed build dir: %s", bc.buildpackDir)
 		}
 	}()
+
+	labels := map[string]string{contextDigestLabel: bc.contextDigest}
+
+	// Files copied into the image keep their mtimes, so they must not depend
+	// on when the build package was extracted.
+	if bc.sourceDateEpoch != nil {
+		if err := dockerfile.SetTimestamps(bc.buildpackDir, *bc.sourceDateEpoch); err != nil {
+			log.Errorf("failed to set timestamps of build context: %v", err)
+			return err
+		}
+	}
+
+	if bc.commitSHA != "" {
+		labels[revisionLabel] = bc.commitSHA
+	}
+
 	var err error
 	bc.buildID, err = executeBuild(bc.writer, bc.containerClient, bc.buildpackDir,
-		bc.args.DockerfilePath, bc.args.FullRepoName(), bc.cacheTag)
-	return err
+		bc.args.DockerfilePath, bc.args.FullRepoName(), bc.cacheTag, labels, bc.buildArgs, bc.sourceDateEpoch, buildAuthConfigs(bc.args))
+	if err != nil {
+		return err
+	}
+
+	bc.finishedOn = time.Now()
+	return nil
 }
 
 // Push executes "docker push" and builds a successful call result if no
-// failures occur.
+// failures occur. If the image was pushed but some of its tags couldn't be
+// created, the result is returned along with a PartialPushError, and lists
+// the tags that failed.
 func (bc *Context) Push() (*rpc.BuildMetadata, error) {
 	if err := bc.client.SetPhase(rpc.Pushing, nil); err != nil {
 		log.Errorf("failed to update phase to `pushing`")
 		return nil, err
 	}
 
-	imageID, digests, err := pushBuiltImage(bc.writer, bc.containerClient, bc.args, bc.buildID)
-	if err != nil {
-		return nil, err
+	// Provenance is signed, so fail before pushing anything if it can't be.
+	if bc.args.Provenance && bc.args.SigningKey == nil {
+		return nil, rpc.SignError{Err: "A provenance attestation was requested without a signing key"}
 	}
 
-	return &rpc.BuildMetadata{ImageID: imageID, Digests: digests}, nil
-}
+	imageID, digests, pushed, pushErr := pushBuiltImage(bc.writer, bc.containerClient, bc.retryPolicy, bc.args, bc.registry, bc.buildID)
+	partial, isPartial := pushErr.(rpc.PartialPushError)
+	if pushErr != nil && !isPartial {
+		return nil, pushErr
+	}
 
-// retryDockerRequest retries attempts to execute a closure that alters that
-// state of the docker daemon until it succeeds.
-func retryDockerRequest(w containerclient.LogWriter, requestFunc func() error) (err error) {
-	for i := 0; i < 3; i++ {
-		// Explicitly throw away the errors from any previous attempts to pull.
-		w.ResetError()
+	buildMetadata := &rpc.BuildMetadata{
+		ImageID:       imageID,
+		Digests:       digests,
+		CommitSHA:     bc.commitSHA,
+		ContextDigest: bc.contextDigest,
+		Tagged:        bc.args.TagNames,
+	}
+	if isPartial {
+		buildMetadata.Tagged = partial.Tagged
+		buildMetadata.FailedTags = partial.Failed
+	}
+	if bc.args.SBOMFormat == "" && bc.args.SigningKey == nil && !bc.args.Provenance {
+		return buildMetadata, pushErr
+	}
+
+	// Artifacts attached to the image refer to the digest it was pushed as.
+	repo, err := bc.registry.repository(bc.args.FullRepoName())
+	if err != nil {
+		return nil, rpc.PushError{Err: err.Error()}
+	}
+	image, err := pushedDigest(repo, pushed, digests, bc.args.TagNames, pushRemoteOptions(bc.args, bc.registry)...)
+	if err != nil {
+		return nil, rpc.PushError{Err: err.Error()}
+	}
 
-		err = requestFunc()
-		rerr, hasResponseError := w.ErrResponse()
-		if err == nil && !hasResponseError {
-			return nil
+	if bc.args.SBOMFormat != "" {
+		buildMetadata.SBOMDigest, err = bc.attachSBOM(image)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		log.Infof("failed docker request attempt #%d: err: %s err response %s", i, err, rerr)
-		if i == 2 {
-			if err != nil {
-				return err
-			}
+	if bc.args.SigningKey != nil {
+		buildMetadata.Signatures, err = bc.sign(image)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-			return rerr
+	if bc.args.Provenance {
+		buildMetadata.Provenance, buildMetadata.Attestations, err = bc.attestProvenance(image)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	return buildMetadata, pushErr
+}
+
+// Complete reports the result of the build to the BuildManager, and then
+// removes the images associated with it.
+func (bc *Context) Complete(buildMetadata *rpc.BuildMetadata) error {
+	if err := bc.client.CompleteBuild(buildMetadata); err != nil {
+		return err
+	}
+	return bc.Cleanup(buildMetadata.ImageID)
+}
+
+// retryDockerRequest makes a request that alters the state of the docker
+// daemon or a registry until it succeeds, retrying transient failures as
+// configured by the policy. Errors streamed by docker count as failures.
+func retryDockerRequest(w containerclient.LogWriter, policy retry.Policy, requestFunc func() error) error {
+	return policy.Do(func() error {
+		// Explicitly throw away the errors from any previous attempts.
+		w.ResetError()
+
+		err := requestFunc()
+		if rerr, hasResponseError := w.ErrResponse(); hasResponseError && err == nil {
+			err = rerr
+		}
+		return err
+	}, func(err error, attempt int, backoff time.Duration) {
+		log.Infof("failed docker request attempt #%d, retrying in %s: %s", attempt, backoff, err)
+		w.WriteStream(fmt.Sprintf("Attempt %d of %d failed, retrying in %s: %s\n", attempt, policy.Attempts, backoff.Round(time.Millisecond), err))
+	})
 }
 
-func primeCache(w containerclient.LogWriter, containerClient containerclient.Client, args *rpc.BuildArgs, cachedTag string) error {
+func primeCache(w containerclient.LogWriter, containerClient containerclient.Client, policy retry.Policy, args *rpc.BuildArgs, cachedTag string) error {
 	if cachedTag == "" {
 		// There's nothing to do!
 		return nil
@@ -201,8 +526,8 @@ func primeCache(w containerclient.LogWriter, containerClient containerclient.Cli
 
 	log.Infof("priming cache with image %s:%s", args.Repository, cachedTag)
 
-	// Attempt to pull the existing tag (if any) three times.
-	err := retryDockerRequest(w, func() error {
+	// Attempt to pull the existing tag (if any), retrying transient failures.
+	err := retryDockerRequest(w, policy, func() error {
 		return containerClient.PullImage(
 			containerclient.PullImageOptions{
 				Repository:   args.FullRepoName(),
@@ -210,10 +535,7 @@ func primeCache(w containerclient.LogWriter, containerClient containerclient.Cli
 				Tag:          cachedTag,
 				OutputStream: w,
 			},
-			containerclient.AuthConfiguration{
-				Username: "$token",
-				Password: args.PullToken,
-			},
+			cacheAuth(args),
 		)
 	})
 	if err != nil {
@@ -223,7 +545,41 @@ func primeCache(w containerclient.LogWriter, containerClient containerclient.Cli
 	return nil
 }
 
-func pullBaseImage(w containerclient.LogWriter, containerClient containerclient.Client, df *dockerfile.Metadata, args *rpc.BuildArgs) error {
+// cacheAuth returns the credentials used to pull the cached image from the
+// build's repository: the pull token, or the credentials the BuildManager sent
+// for the registry if there is no token.
+func cacheAuth(args *rpc.BuildArgs) containerclient.AuthConfiguration {
+	if args.PullToken == "" {
+		if auth, ok := registryAuth(args, args.Registry); ok {
+			return auth
+		}
+	}
+
+	return containerclient.AuthConfiguration{
+		Username: "$token",
+		Password: args.PullToken,
+	}
+}
+
+// baseImageAuth returns the credentials used to pull a base image. Images in
+// our own registry are pulled with the base image credentials, if any, and
+// images in any registry with the credentials the BuildManager sent for it.
+func baseImageAuth(args *rpc.BuildArgs, image string) (containerclient.AuthConfiguration, bool) {
+	if args.BaseImage.Username != "" && strings.Index(image, args.Registry) == 0 {
+		return containerclient.AuthConfiguration{
+			Username: args.BaseImage.Username,
+			Password: args.BaseImage.Password,
+		}, true
+	}
+
+	if registry := imageRegistry(image); registry != "" {
+		return registryAuth(args, registry)
+	}
+
+	return containerclient.AuthConfiguration{}, false
+}
+
+func pullBaseImage(w containerclient.LogWriter, containerClient containerclient.Client, policy retry.Policy, df *dockerfile.Metadata, args *rpc.BuildArgs) error {
 	// Skip pulling the base image if it's "scratch" which is a built-in image
 	// that throws an error after executing `docker pull`.
 	if df.BaseImage == scratchImageName {
@@ -237,21 +593,12 @@ func pullBaseImage(w containerclient.LogWriter, containerClient containerclient.
 		OutputStream: w,
 	}
 
-	// Only pull the base image with auth when it is in our own registry.
-	var pullAuth containerclient.AuthConfiguration
-	var usesAuth bool
-	if args.BaseImage.Username != "" && strings.Index(df.BaseImage, args.Registry) == 0 {
-		pullAuth = containerclient.AuthConfiguration{
-			Username: args.BaseImage.Username,
-			Password: args.BaseImage.Password,
-		}
-		usesAuth = true
-	}
+	pullAuth, usesAuth := baseImageAuth(args, df.BaseImage)
 
 	log.Infof("pulling base image %s:%s (with auth: %t)", df.BaseImage, df.BaseImageTag, usesAuth)
 
-	// Attempt to pull an image three times.
-	err := retryDockerRequest(w, func() error {
+	// Attempt to pull the image, retrying transient failures.
+	err := retryDockerRequest(w, policy, func() error {
 		return containerClient.PullImage(pullOptions, pullAuth)
 	})
 	if err != nil {
@@ -261,6 +608,43 @@ func pullBaseImage(w containerclient.LogWriter, containerClient containerclient.
 	return nil
 }
 
+// pullFrontendImage pulls the frontend image named by the Dockerfile's syntax
+// directive, so that failing to pull it is reported as a pull error rather than
+// a build error. Only BuildKit uses frontend images, so nothing is pulled for
+// other builders.
+func pullFrontendImage(w containerclient.LogWriter, containerClient containerclient.Client, policy retry.Policy, df *dockerfile.Metadata) error {
+	if df.Syntax == "" || !containerClient.UsesBuildKit() {
+		return nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(df.Syntax)
+	if err != nil {
+		return rpc.InvalidDockerfileError{Err: fmt.Sprintf("Invalid syntax directive %q: %s", df.Syntax, err)}
+	}
+	named = reference.TagNameOnly(named)
+
+	pullOptions := containerclient.PullImageOptions{
+		Repository:   reference.FamiliarName(named),
+		OutputStream: w,
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		pullOptions.Tag = digested.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		pullOptions.Tag = tagged.Tag()
+	}
+
+	log.Infof("pulling dockerfile frontend image %s", reference.FamiliarString(named))
+
+	err = retryDockerRequest(w, policy, func() error {
+		return containerClient.PullImage(pullOptions, containerclient.AuthConfiguration{})
+	})
+	if err != nil {
+		return rpc.PullError{Err: err.Error()}
+	}
+
+	return nil
+}
+
 func findCachedTag(w containerclient.LogWriter, client rpc.Client, containerClient containerclient.Client, df *dockerfile.Metadata) (string, error) {
 	log.Infof("querying Docker for the ID of the pulled base image: %s:%s", df.BaseImage, df.BaseImageTag)
 	var baseImageID string
@@ -290,61 +674,42 @@ func findCachedTag(w containerclient.LogWriter, client rpc.Client, containerClie
 	})
 }
 
-func pushBuiltImage(w containerclient.LogWriter, containerClient containerclient.Client, args *rpc.BuildArgs, imageID string) (string, []string, error) {
-	// Push each new tag for the image.
-	for _, tagName := range args.TagNames {
-		// Setup tag options.
-		tagOptions := containerclient.TagImageOptions{
-			Repository: args.FullRepoName(),
-			Tag:        tagName,
-			Force:      true,
-		}
-
-		// Tag the image.
-		log.Infof("tagging image %s as %s:%s", imageID, args.FullRepoName(), tagName)
-		err := containerClient.TagImage(imageID, tagOptions)
-		if err != nil {
-			return "", nil, rpc.TagError{Err: err.Error()}
-		}
-
-		if rerr, hasResponseError := w.ErrResponse(); hasResponseError {
-			return "", nil, rpc.TagError{Err: rerr.Error()}
-		}
-
-		fullyQualifiedName := args.FullRepoName() + ":" + tagName
-		log.Infof("pushing image %s (%s)", fullyQualifiedName, imageID)
-		err = retryDockerRequest(w, func() error {
-			return containerClient.PushImage(
-				containerclient.PushImageOptions{
-					Repository:   args.FullRepoName(),
-					Registry:     args.Registry,
-					Tag:          tagName,
-					OutputStream: w,
-				},
-				containerclient.AuthConfiguration{
-					Username: "$token",
-					Password: args.PushToken,
-				},
-			)
-		})
+// pushBuiltImage pushes the image with its first tag, then creates the other
+// tags through the registry API so the image is only uploaded once. It returns
+// the image's ID and repo digests, and the digest it was pushed as if the
+// container runtime reported it.
+func pushBuiltImage(w containerclient.LogWriter, containerClient containerclient.Client, policy retry.Policy, args *rpc.BuildArgs, access registryAccess, imageID string) (string, []string, string, error) {
+	var pushed string
+	if len(args.TagNames) > 0 {
+		var err error
+		pushed, err = pushTag(w, containerClient, policy, args, imageID, args.TagNames[0])
 		if err != nil {
-			return "", nil, rpc.PushError{Err: err.Error()}
+			return "", nil, "", err
 		}
-
-		log.Infof("successfully pushed %s", fullyQualifiedName)
 	}
 
 	// Find the image built.
 	dockerImage, err := containerClient.InspectImage(imageID)
 	if err != nil {
-		return "", nil, rpc.TagError{Err: err.Error()}
+		return "", nil, "", rpc.TagError{Err: err.Error()}
 	}
 
 	if rerr, hasResponseError := w.ErrResponse(); hasResponseError {
-		return "", nil, rpc.TagError{Err: rerr.Error()}
+		return "", nil, "", rpc.TagError{Err: rerr.Error()}
 	}
 
-	return dockerImage.ID, dockerImage.RepoDigests, nil
+	// The image is still returned if some of the tags couldn't be created,
+	// so that the tags that were can be reported.
+	if len(args.TagNames) > 1 {
+		if err := tagPushedImage(w, containerClient, policy, args, access, imageID, pushed); err != nil {
+			if _, ok := err.(rpc.PartialPushError); !ok {
+				return "", nil, "", err
+			}
+			return dockerImage.ID, dockerImage.RepoDigests, pushed, err
+		}
+	}
+
+	return dockerImage.ID, dockerImage.RepoDigests, pushed, nil
 }
 
 // Cleanup attempts to remove all the images associated with the build.
@@ -372,6 +737,16 @@ func (bc *Context) Cleanup(builtImageID string) error {
 		log.Warningf("Could not remove base image %s: %v", baseImage, err)
 	}
 
+	// Remove the names that images were pulled from mirrors as.
+	for _, image := range bc.mirroredImages {
+		err := bc.containerClient.RemoveImageExtended(image, containerclient.RemoveImageOptions{
+			Force: true,
+		})
+		if err != nil {
+			log.Warningf("Could not remove mirrored image %s: %v", image, err)
+		}
+	}
+
 	// Remove the built image.
 	brerr := bc.containerClient.RemoveImageExtended(builtImageID, containerclient.RemoveImageOptions{
 		Force: true,
@@ -389,7 +764,39 @@ func (bc *Context) Cleanup(builtImageID string) error {
 	return nil
 }
 
-func executeBuild(w containerclient.LogWriter, containerClient containerclient.Client, buildPackageDirectory string, dockerFileName string, repo string, cacheTag string) (string, error) {
+// checkBuildContext reports the size of the build context, after applying the
+// first of ignoreFiles found, to the build logs. If maxSize is set, larger
+// contexts fail the build.
+func checkBuildContext(w containerclient.LogWriter, buildPackageDirectory, dockerFileName string, ignoreFiles []string, maxSize int64) error {
+	stats, err := dockerfile.MeasureContext(buildPackageDirectory, dockerFileName, ignoreFiles)
+	if err != nil {
+		log.Errorf("failed to measure build context: %v", err)
+		return err
+	}
+
+	ignored := fmt.Sprintf("no %s found", strings.Join(ignoreFiles, " or "))
+	if stats.IgnoreFile != "" {
+		ignored = "after applying " + stats.IgnoreFile
+	}
+	size := units.HumanSize(float64(stats.Size))
+	log.Infof("build context: %d files, %s (%s)", stats.Files, size, ignored)
+	w.WriteStream(fmt.Sprintf("Build context: %d files, %s (%s)\n", stats.Files, size, ignored))
+
+	if maxSize > 0 && stats.Size > maxSize {
+		return rpc.BuildError{Err: fmt.Sprintf(
+			"Build context is %s, which is larger than the maximum of %s. Use a .dockerignore file to exclude files that are not needed by the build.",
+			size, units.HumanSize(float64(maxSize)),
+		)}
+	}
+
+	if stats.Size > largeContextSize {
+		w.WriteStream(fmt.Sprintf("Warning: the build context is very large (%s) and may slow down the build. Consider excluding unneeded files with a .dockerignore file.\n", size))
+	}
+
+	return nil
+}
+
+func executeBuild(w containerclient.LogWriter, containerClient containerclient.Client, buildPackageDirectory string, dockerFileName string, repo string, cacheTag string, labels map[string]string, buildArgs map[string]string, sourceDateEpoch *time.Time, authConfigs map[string]containerclient.AuthConfiguration) (string, error) {
 	buildUUID, err := uuid.NewV4()
 	if err != nil {
 		return "", err
@@ -415,7 +822,14 @@ func executeBuild(w containerclient.LogWriter, containerClient containerclient.C
 		OutputStream:        w,
 		Dockerfile:          dockerFileName, // Required for .dockerignore to work
 		ContextDir:          buildPackageDirectory,
+		Labels:              labels,
+		BuildArgs:           buildArgs,
+		SourceDateEpoch:     sourceDateEpoch,
+		AuthConfigs:         authConfigs,
 	})
+	if ferr := w.Flush(); ferr != nil {
+		log.Warningf("failed to publish the end of the build output: %s", ferr)
+	}
 	if err != nil {
 		return "", rpc.BuildError{Err: err.Error()}
 	}
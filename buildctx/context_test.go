@@ -0,0 +1,122 @@
+package buildctx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quay/quay-builder/containerclient"
+	"github.com/quay/quay-builder/containerclient/dockerfile"
+	"github.com/quay/quay-builder/retry"
+	"github.com/quay/quay-builder/rpc"
+)
+
+func TestRetryPolicyFromEnv(t *testing.T) {
+	var tests = []struct {
+		name       string
+		env        map[string]string
+		want       retry.Policy
+		shouldFail bool
+	}{
+		{"defaults", nil, retry.DefaultPolicy, false},
+		{
+			"overridden",
+			map[string]string{
+				"REGISTRY_RETRY_ATTEMPTS":    "5",
+				"REGISTRY_RETRY_BACKOFF":     "500ms",
+				"REGISTRY_RETRY_MAX_BACKOFF": "1m",
+			},
+			retry.Policy{Attempts: 5, InitialBackoff: 500 * time.Millisecond, MaxBackoff: time.Minute, Jitter: retry.DefaultPolicy.Jitter},
+			false,
+		},
+		{
+			"maximum below initial backoff",
+			map[string]string{"REGISTRY_RETRY_BACKOFF": "1m"},
+			retry.Policy{Attempts: retry.DefaultPolicy.Attempts, InitialBackoff: time.Minute, MaxBackoff: time.Minute, Jitter: retry.DefaultPolicy.Jitter},
+			false,
+		},
+		{"no attempts", map[string]string{"REGISTRY_RETRY_ATTEMPTS": "0"}, retry.Policy{}, true},
+		{"invalid backoff", map[string]string{"REGISTRY_RETRY_BACKOFF": "soon"}, retry.Policy{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			policy, err := retryPolicyFromEnv()
+			if (err != nil) != tt.shouldFail {
+				t.Fatalf("got error %v, wanted failure: %t", err, tt.shouldFail)
+			}
+			if policy != tt.want {
+				t.Fatalf("got policy %+v, wanted %+v", policy, tt.want)
+			}
+		})
+	}
+}
+
+// phaseClient is a client that keeps the pull metadata sent with each phase.
+type phaseClient struct {
+	rpc.Client
+	phases map[rpc.Phase]*rpc.PullMetadata
+}
+
+func (c *phaseClient) SetPhase(phase rpc.Phase, pmd *rpc.PullMetadata) error {
+	if c.phases == nil {
+		c.phases = map[rpc.Phase]*rpc.PullMetadata{}
+	}
+	c.phases[phase] = pmd
+	return nil
+}
+
+// pullClient is a container client that records the images it pulls, failing
+// to pull from the registries in failRegistries.
+type pullClient struct {
+	containerclient.Client
+	failRegistries []string
+	pulled         []string
+}
+
+func (c *pullClient) PullImage(opts containerclient.PullImageOptions, auth containerclient.AuthConfiguration) error {
+	for _, registry := range c.failRegistries {
+		if strings.HasPrefix(opts.Repository, registry+"/") {
+			return errors.New("manifest unknown")
+		}
+	}
+	c.pulled = append(c.pulled, opts.Repository+":"+opts.Tag)
+	return nil
+}
+
+func (c *pullClient) TagImage(string, containerclient.TagImageOptions) error { return nil }
+
+func (c *pullClient) InspectImage(string) (*containerclient.Image, error) {
+	return nil, errors.New("no such image")
+}
+
+func (c *pullClient) UsesBuildKit() bool { return false }
+
+func TestPullReportsContextDigest(t *testing.T) {
+	client := &phaseClient{}
+	bc := &Context{
+		client:          client,
+		writer:          &streamLogWriter{},
+		containerClient: &pullClient{},
+		retryPolicy:     retry.Policy{Attempts: 1},
+		args:            &rpc.BuildArgs{Registry: "quay.io"},
+		metadata:        &dockerfile.Metadata{BaseImage: "alpine", BaseImageTag: "3.20", BaseImages: []string{"alpine:3.20"}},
+		contextDigest:   "sha256:context",
+	}
+
+	if err := bc.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	pmd, ok := client.phases[rpc.Pulling]
+	if !ok || pmd == nil {
+		t.Fatal("the pulling phase wasn't reported")
+	}
+	if pmd.ContextDigest != "sha256:context" {
+		t.Fatalf("reported context digest %q, wanted sha256:context", pmd.ContextDigest)
+	}
+}
@@ -0,0 +1,228 @@
+package buildctx
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/containerclient"
+	"github.com/quay/quay-builder/retry"
+)
+
+// mirrorCheckTimeout is how long a mirror has to respond when checking
+// whether it has an image.
+const mirrorCheckTimeout = 10 * time.Second
+
+// registryMirror is a mirror or pull-through cache of a registry.
+type registryMirror struct {
+	// Endpoint is the host of the mirror, optionally followed by a path that
+	// is prepended to the names of the mirrored repositories (e.g.
+	// "harbor.example.com/dockerhub").
+	Endpoint string `json:"endpoint"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Insecure allows the mirror to be accessed over plain HTTP or with a
+	// certificate that can't be verified.
+	Insecure bool `json:"insecure"`
+}
+
+// registryMirrorsFromEnv reads the mirrors of each registry from the JSON file
+// named by REGISTRY_MIRRORS_FILE, which maps registries (e.g. "docker.io") to
+// the mirrors to try, in order. It returns nil if no file is configured.
+func registryMirrorsFromEnv() (map[string][]registryMirror, error) {
+	filename := os.Getenv("REGISTRY_MIRRORS_FILE")
+	if filename == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry mirrors: %w", err)
+	}
+
+	var config map[string][]registryMirror
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse registry mirrors %s: %w", filename, err)
+	}
+
+	mirrors := map[string][]registryMirror{}
+	for registry, m := range config {
+		registry = normalizeRegistry(registry)
+		mirrors[registry] = append(mirrors[registry], m...)
+	}
+
+	return mirrors, nil
+}
+
+// repository returns the name of the repository of image in the mirror.
+func (m *registryMirror) repository(image reference.Named) string {
+	return strings.TrimSuffix(m.Endpoint, "/") + "/" + reference.Path(image)
+}
+
+func (m *registryMirror) auth() containerclient.AuthConfiguration {
+	return containerclient.AuthConfiguration{Username: m.Username, Password: m.Password}
+}
+
+// hasImage reports whether the mirror serves the tag of image, by requesting
+// its manifest.
+func (m *registryMirror) hasImage(image reference.Named, tag string) bool {
+	var opts []name.Option
+	if m.Insecure {
+		opts = append(opts, name.Insecure)
+	}
+	ref, err := name.ParseReference(m.repository(image)+":"+tag, opts...)
+	if err != nil {
+		log.Warningf("invalid registry mirror %s: %s", m.Endpoint, err)
+		return false
+	}
+
+	auth := authn.Anonymous
+	if m.Username != "" {
+		auth = &authn.Basic{Username: m.Username, Password: m.Password}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if m.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorCheckTimeout)
+	defer cancel()
+
+	_, err = remote.Head(ref, remote.WithAuth(auth), remote.WithTransport(transport), remote.WithContext(ctx))
+	if err != nil {
+		log.Infof("registry mirror %s doesn't have %s:%s: %s", m.Endpoint, reference.FamiliarName(image), tag, err)
+		return false
+	}
+
+	return true
+}
+
+// findMirror returns the first mirror of the registry of image that has the
+// tag, or nil if there is none.
+func findMirror(mirrors map[string][]registryMirror, image reference.Named, tag string) *registryMirror {
+	for i := range mirrors[reference.Domain(image)] {
+		m := &mirrors[reference.Domain(image)][i]
+		if m.hasImage(image, tag) {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// pullFromMirror pulls the tag of image from a mirror, and tags it with the
+// image's own name so that the build uses it rather than pulling it again.
+// The name the image was pulled as is returned, so it can be removed later.
+func pullFromMirror(w containerclient.LogWriter, containerClient containerclient.Client, policy retry.Policy, mirror *registryMirror, image reference.Named, tag string) (string, error) {
+	repository := mirror.repository(image)
+	w.WriteStream(fmt.Sprintf("Pulling %s:%s from mirror %s\n", reference.FamiliarName(image), tag, mirror.Endpoint))
+	log.Infof("pulling %s:%s from mirror %s", reference.FamiliarName(image), tag, mirror.Endpoint)
+
+	err := retryDockerRequest(w, policy, func() error {
+		return containerClient.PullImage(containerclient.PullImageOptions{
+			Repository:   repository,
+			Tag:          tag,
+			OutputStream: w,
+			Insecure:     mirror.Insecure,
+		}, mirror.auth())
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = containerClient.TagImage(repository+":"+tag, containerclient.TagImageOptions{
+		Repository: reference.FamiliarName(image),
+		Tag:        tag,
+		Force:      true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return repository + ":" + tag, nil
+}
+
+// parseBaseImage parses the name and tag of an image referenced by a
+// Dockerfile. Images pinned to a digest aren't mirrored, as a copy pulled from
+// a mirror can't be given the original digest reference, so ok is false for
+// them.
+func parseBaseImage(image string) (named reference.Named, tag string, ok bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, "", false
+	}
+	if _, digested := named.(reference.Digested); digested {
+		return nil, "", false
+	}
+
+	tag = "latest"
+	if tagged, isTagged := named.(reference.Tagged); isTagged {
+		tag = tagged.Tag()
+	}
+
+	return reference.TrimNamed(named), tag, true
+}
+
+// findBaseImageMirror returns the first mirror that has the base image, or nil
+// if the base image isn't mirrored.
+func (bc *Context) findBaseImageMirror() *registryMirror {
+	if len(bc.registryMirrors) == 0 || bc.metadata.BaseImage == scratchImageName {
+		return nil
+	}
+
+	for _, image := range bc.metadata.BaseImages {
+		if strings.HasPrefix(image, bc.metadata.BaseImage+"@") {
+			return nil
+		}
+	}
+
+	named, tag, ok := parseBaseImage(bc.metadata.BaseImage + ":" + bc.metadata.BaseImageTag)
+	if !ok {
+		return nil
+	}
+
+	return findMirror(bc.registryMirrors, named, tag)
+}
+
+// pullStageImagesFromMirrors pulls the base images of the Dockerfile's other
+// stages from mirrors, if any of them have the images, so that the build uses
+// those copies. Images that can't be pulled from a mirror are left for the
+// build to pull from their own registries.
+func (bc *Context) pullStageImagesFromMirrors() {
+	if len(bc.registryMirrors) == 0 {
+		return
+	}
+
+	baseImage, baseTag, _ := parseBaseImage(bc.metadata.BaseImage + ":" + bc.metadata.BaseImageTag)
+	for _, image := range bc.metadata.BaseImages {
+		named, tag, ok := parseBaseImage(image)
+		if !ok || baseImage != nil && named.Name() == baseImage.Name() && tag == baseTag {
+			continue
+		}
+
+		mirror := findMirror(bc.registryMirrors, named, tag)
+		if mirror == nil {
+			continue
+		}
+
+		pulled, err := pullFromMirror(bc.writer, bc.containerClient, bc.retryPolicy, mirror, named, tag)
+		if err != nil {
+			log.Warningf("failed to pull %s from mirror %s: %s", image, mirror.Endpoint, err)
+			continue
+		}
+		bc.mirroredImages = append(bc.mirroredImages, pulled)
+	}
+}
@@ -0,0 +1,218 @@
+package buildctx
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/quay/quay-builder/containerclient/dockerfile"
+	"github.com/quay/quay-builder/retry"
+	"github.com/quay/quay-builder/rpc"
+)
+
+func TestRegistryMirrorsFromEnv(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "mirrors.json")
+	err := ioutil.WriteFile(filename, []byte(`{
+		"https://index.docker.io/v1/": [{"endpoint": "mirror.example.com/dockerhub", "username": "user", "password": "pass"}],
+		"docker.io": [{"endpoint": "localhost:5000", "insecure": true}],
+		"quay.io": [{"endpoint": "quay-mirror.example.com"}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REGISTRY_MIRRORS_FILE", filename)
+
+	mirrors, err := registryMirrorsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mirrors["docker.io"]) != 2 {
+		t.Errorf("expected the docker.io mirrors to be merged, got %+v", mirrors["docker.io"])
+	}
+	expected := []registryMirror{{Endpoint: "quay-mirror.example.com"}}
+	if !reflect.DeepEqual(mirrors["quay.io"], expected) {
+		t.Errorf("quay.io: got %+v, wanted %+v", mirrors["quay.io"], expected)
+	}
+
+	t.Setenv("REGISTRY_MIRRORS_FILE", "")
+	if mirrors, err := registryMirrorsFromEnv(); mirrors != nil || err != nil {
+		t.Errorf("expected no mirrors without a file, got %+v, %v", mirrors, err)
+	}
+}
+
+func TestMirrorRepository(t *testing.T) {
+	table := []struct {
+		endpoint string
+		image    string
+		expected string
+	}{
+		{"mirror.example.com", "ubuntu", "mirror.example.com/library/ubuntu"},
+		{"mirror.example.com/dockerhub/", "docker.io/library/ubuntu", "mirror.example.com/dockerhub/library/ubuntu"},
+		{"localhost:5000", "quay.io/org/repo", "localhost:5000/org/repo"},
+	}
+
+	for _, tt := range table {
+		named, err := reference.ParseNormalizedNamed(tt.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := registryMirror{Endpoint: tt.endpoint}
+		if got := m.repository(named); got != tt.expected {
+			t.Errorf("%s in %s: got %q, wanted %q", tt.image, tt.endpoint, got, tt.expected)
+		}
+	}
+}
+
+func TestParseBaseImage(t *testing.T) {
+	table := []struct {
+		image    string
+		name     string
+		tag      string
+		expected bool
+	}{
+		{"ubuntu", "docker.io/library/ubuntu", "latest", true},
+		{"quay.io/org/repo:1.0", "quay.io/org/repo", "1.0", true},
+		{"alpine@sha256:" + strings.Repeat("a", 64), "", "", false},
+		{"${IMAGE}", "", "", false},
+	}
+
+	for _, tt := range table {
+		named, tag, ok := parseBaseImage(tt.image)
+		if ok != tt.expected {
+			t.Errorf("%s: got ok %t, wanted %t", tt.image, ok, tt.expected)
+			continue
+		}
+		if ok && (named.Name() != tt.name || tag != tt.tag) {
+			t.Errorf("%s: got %s:%s, wanted %s:%s", tt.image, named.Name(), tag, tt.name, tt.tag)
+		}
+	}
+}
+
+func TestFindMirror(t *testing.T) {
+	empty := httptest.NewServer(registry.New())
+	defer empty.Close()
+	full := httptest.NewServer(registry.New())
+	defer full.Close()
+
+	emptyHost := strings.TrimPrefix(empty.URL, "http://")
+	fullHost := strings.TrimPrefix(full.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fullHost+"/dockerhub/library/ubuntu:22.04", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	mirrors := map[string][]registryMirror{
+		"docker.io": {
+			{Endpoint: "invalid mirror"},
+			{Endpoint: emptyHost, Insecure: true},
+			{Endpoint: fullHost + "/dockerhub", Insecure: true},
+		},
+	}
+
+	table := []struct {
+		image    string
+		tag      string
+		expected string
+	}{
+		{"ubuntu", "22.04", fullHost + "/dockerhub"},
+		{"ubuntu", "24.04", ""},
+		{"quay.io/org/repo", "22.04", ""},
+	}
+
+	for _, tt := range table {
+		named, err := reference.ParseNormalizedNamed(tt.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got string
+		if m := findMirror(mirrors, named, tt.tag); m != nil {
+			got = m.Endpoint
+		}
+		if got != tt.expected {
+			t.Errorf("%s:%s: got mirror %q, wanted %q", tt.image, tt.tag, got, tt.expected)
+		}
+	}
+}
+
+func TestPullRecordsSource(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(host+"/dockerhub/library/ubuntu:22.04", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		name           string
+		failRegistries []string
+		mirrorURL      string
+		pullUsername   string
+	}{
+		{"pulled from mirror", nil, host + "/dockerhub", "mirror-user"},
+		{"fell back to registry", []string{host}, "", ""},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &phaseClient{}
+			bc := &Context{
+				client:          client,
+				writer:          &streamLogWriter{},
+				containerClient: &pullClient{failRegistries: tt.failRegistries},
+				retryPolicy:     retry.Policy{Attempts: 1},
+				args:            &rpc.BuildArgs{Registry: "quay.io"},
+				metadata:        &dockerfile.Metadata{BaseImage: "ubuntu", BaseImageTag: "22.04", BaseImages: []string{"ubuntu:22.04"}},
+				registryMirrors: map[string][]registryMirror{
+					"docker.io": {{Endpoint: host + "/dockerhub", Insecure: true, Username: "mirror-user"}},
+				},
+			}
+
+			if err := bc.Pull(); err != nil {
+				t.Fatal(err)
+			}
+			if err := bc.Cache(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The source isn't known until the image has been pulled.
+			if pmd := client.phases[rpc.Pulling]; pmd == nil || pmd.MirrorURL != "" {
+				t.Fatalf("pulling phase reported a mirror before pulling: %+v", pmd)
+			}
+			pmd := client.phases[rpc.CheckingCache]
+			if pmd == nil {
+				t.Fatal("the source of the base image wasn't reported")
+			}
+			if pmd.MirrorURL != tt.mirrorURL || pmd.PullUsername != tt.pullUsername {
+				t.Fatalf("reported mirror %q as %q, wanted %q as %q", pmd.MirrorURL, pmd.PullUsername, tt.mirrorURL, tt.pullUsername)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package buildctx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/distribution/reference"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+// baseImagePolicyFromEnv reads the base image policy from the JSON file named
+// by BASE_IMAGE_POLICY_FILE, which is usually mounted into the builder by the
+// administrator. It returns nil if no file is configured.
+func baseImagePolicyFromEnv() (*rpc.BaseImagePolicy, error) {
+	filename := os.Getenv("BASE_IMAGE_POLICY_FILE")
+	if filename == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base image policy: %w", err)
+	}
+
+	var policy rpc.BaseImagePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse base image policy %s: %w", filename, err)
+	}
+
+	return &policy, nil
+}
+
+// CheckBaseImages checks the base images of the Dockerfile, the images it
+// copies or mounts files from, and the frontend image BuildKit builds it with
+// (if it has a syntax directive), against the base image policy configured for
+// the builder and the one sent with the build (if any). Each violation is
+// written to the build logs, and the build fails if there are any.
+func (bc *Context) CheckBaseImages() error {
+	images := append(append([]string{}, bc.metadata.BaseImages...), bc.metadata.CopiedImages...)
+	if bc.metadata.Syntax != "" && bc.containerClient.UsesBuildKit() {
+		images = append(images, bc.metadata.Syntax)
+	}
+
+	var violations []string
+	for _, policy := range []*rpc.BaseImagePolicy{bc.baseImagePolicy, bc.args.BaseImagePolicy} {
+		if policy == nil {
+			continue
+		}
+
+		v, err := checkBaseImagePolicy(policy, images)
+		if err != nil {
+			log.Errorf("failed to check base image policy: %v", err)
+			return err
+		}
+		violations = append(violations, v...)
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	for _, violation := range violations {
+		bc.writer.WriteStream(fmt.Sprintf("Base image policy violation: %s\n", violation))
+	}
+
+	return rpc.BaseImagePolicyError{
+		Err:        fmt.Sprintf("Dockerfile uses base images that are not allowed: %s", strings.Join(violations, "; ")),
+		Violations: violations,
+	}
+}
+
+// checkBaseImagePolicy returns a description of every way the images break
+// the policy. An error is returned if the policy itself is invalid.
+func checkBaseImagePolicy(policy *rpc.BaseImagePolicy, images []string) ([]string, error) {
+	var violations []string
+	for _, image := range images {
+		if strings.Contains(image, "$") {
+			violations = append(violations, fmt.Sprintf("%s depends on build args, so it can't be checked", image))
+			continue
+		}
+
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("%s is not a valid image reference", image))
+			continue
+		}
+
+		if len(policy.AllowedRegistries) > 0 && !containsFold(policy.AllowedRegistries, reference.Domain(named)) {
+			violations = append(violations, fmt.Sprintf("%s is not from an allowed registry", image))
+		}
+
+		denied, err := matchesAny(policy.DeniedRepositories, named.Name())
+		if err != nil {
+			return nil, err
+		}
+		if denied {
+			violations = append(violations, fmt.Sprintf("%s is from a denied repository", image))
+		}
+
+		if len(policy.AllowedRepositories) > 0 {
+			allowed, err := matchesAny(policy.AllowedRepositories, named.Name())
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				violations = append(violations, fmt.Sprintf("%s is not from an allowed repository", image))
+			}
+		}
+
+		_, digested := named.(reference.Digested)
+		if policy.RequireDigest && !digested {
+			violations = append(violations, fmt.Sprintf("%s is not pinned to a digest", image))
+		}
+
+		if policy.DenyLatest && !digested {
+			if tagged, ok := named.(reference.Tagged); !ok || tagged.Tag() == "latest" {
+				violations = append(violations, fmt.Sprintf("%s uses the latest tag", image))
+			}
+		}
+	}
+
+	return violations, nil
+}
+
+// matchesAny reports whether name matches any of the glob patterns, in which
+// "*" matches any part of a single path component.
+func matchesAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid repository pattern %q in base image policy: %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// containsFold reports whether s is in values, ignoring case.
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,190 @@
+package buildctx
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/quay/quay-builder/containerclient"
+	"github.com/quay/quay-builder/containerclient/dockerfile"
+	"github.com/quay/quay-builder/rpc"
+)
+
+func TestCheckBaseImagePolicy(t *testing.T) {
+	const digest = "sha256:4c68376a702446fc3c79af22de146a148bc3367e73c25a5803d453b6b3f722fb"
+
+	table := []struct {
+		name       string
+		policy     rpc.BaseImagePolicy
+		images     []string
+		violations []string
+	}{
+		{
+			"empty policy",
+			rpc.BaseImagePolicy{},
+			[]string{"alpine", "quay.io/myorg/base:1.0"},
+			nil,
+		},
+		{
+			"allowed registries",
+			rpc.BaseImagePolicy{AllowedRegistries: []string{"quay.io", "docker.io"}},
+			[]string{"alpine:3.20", "quay.io/myorg/base:1.0", "ghcr.io/other/base:1.0"},
+			[]string{"ghcr.io/other/base:1.0 is not from an allowed registry"},
+		},
+		{
+			"allowed repositories",
+			rpc.BaseImagePolicy{AllowedRepositories: []string{"quay.io/myorg/*", "docker.io/library/*"}},
+			[]string{"alpine:3.20", "quay.io/myorg/base:1.0", "quay.io/myorg/team/base:1.0", "quay.io/other/base:1.0"},
+			[]string{
+				"quay.io/myorg/team/base:1.0 is not from an allowed repository",
+				"quay.io/other/base:1.0 is not from an allowed repository",
+			},
+		},
+		{
+			"denied repositories",
+			rpc.BaseImagePolicy{DeniedRepositories: []string{"docker.io/library/ubuntu"}},
+			[]string{"alpine:3.20", "ubuntu:24.04"},
+			[]string{"ubuntu:24.04 is from a denied repository"},
+		},
+		{
+			"require digest",
+			rpc.BaseImagePolicy{RequireDigest: true},
+			[]string{"alpine:3.20", "alpine@" + digest, "alpine:3.20@" + digest},
+			[]string{"alpine:3.20 is not pinned to a digest"},
+		},
+		{
+			"deny latest",
+			rpc.BaseImagePolicy{DenyLatest: true},
+			[]string{"alpine", "alpine:latest", "alpine:3.20", "alpine:latest@" + digest},
+			[]string{"alpine uses the latest tag", "alpine:latest uses the latest tag"},
+		},
+		{
+			"unresolved and invalid images",
+			rpc.BaseImagePolicy{DenyLatest: true},
+			[]string{"alpine:$TAG", "/invalid"},
+			[]string{"alpine:$TAG depends on build args, so it can't be checked", "/invalid is not a valid image reference"},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := checkBaseImagePolicy(&tt.policy, tt.images)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(violations, tt.violations) {
+				t.Fatalf("unexpected violations: got: %q wanted: %q", violations, tt.violations)
+			}
+		})
+	}
+}
+
+func TestCheckBaseImagePolicyInvalidPattern(t *testing.T) {
+	policy := &rpc.BaseImagePolicy{AllowedRepositories: []string{"quay.io/["}}
+	if _, err := checkBaseImagePolicy(policy, []string{"alpine"}); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+// logClient is a client that keeps the log entries published to it.
+type logClient struct {
+	rpc.Client
+	entries []string
+}
+
+func (c *logClient) PublishBuildLogEntry(entry string) error {
+	c.entries = append(c.entries, entry)
+	return nil
+}
+
+func TestCheckBaseImages(t *testing.T) {
+	metadata, err := dockerfile.NewMetadataFromReader(strings.NewReader(
+		"FROM quay.io/myorg/base AS build\n"+
+			"FROM quay.io/myorg/base\n"+
+			"COPY --from=build /out /out\n"+
+			"COPY --from=docker.io/other/tools /bin/tool /bin/tool\n"+
+			"RUN --mount=type=bind,from=ghcr.io/other/files,target=/files ls /files\n",
+	), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &logClient{}
+	bc := &Context{
+		args:            &rpc.BuildArgs{},
+		metadata:        metadata,
+		writer:          containerclient.NewRPCWriter(client, "podman"),
+		baseImagePolicy: &rpc.BaseImagePolicy{AllowedRegistries: []string{"quay.io"}},
+	}
+
+	err = bc.CheckBaseImages()
+	var policyErr rpc.BaseImagePolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected a BaseImagePolicyError, got %v", err)
+	}
+	expected := []string{
+		"docker.io/other/tools is not from an allowed registry",
+		"ghcr.io/other/files is not from an allowed registry",
+	}
+	if !reflect.DeepEqual(policyErr.Violations, expected) {
+		t.Fatalf("unexpected violations: got: %q wanted: %q", policyErr.Violations, expected)
+	}
+	if len(client.entries) != len(expected) {
+		t.Fatalf("expected a log entry per violation, got %q", client.entries)
+	}
+}
+
+// buildKitClient is a container client that may build with BuildKit.
+type buildKitClient struct {
+	containerclient.Client
+	buildKit bool
+}
+
+func (c buildKitClient) UsesBuildKit() bool { return c.buildKit }
+
+func TestCheckSyntaxFrontend(t *testing.T) {
+	metadata, err := dockerfile.NewMetadataFromReader(strings.NewReader(
+		"# syntax=docker.io/docker/dockerfile:1\n"+
+			"FROM quay.io/myorg/base\n",
+	), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		name       string
+		buildKit   bool
+		violations []string
+	}{
+		{"buildkit", true, []string{"docker.io/docker/dockerfile:1 is not from an allowed registry"}},
+		{"classic builder", false, nil},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := &Context{
+				args:            &rpc.BuildArgs{},
+				metadata:        metadata,
+				containerClient: buildKitClient{buildKit: tt.buildKit},
+				writer:          containerclient.NewRPCWriter(&logClient{}, "docker"),
+				baseImagePolicy: &rpc.BaseImagePolicy{AllowedRegistries: []string{"quay.io"}},
+			}
+
+			err := bc.CheckBaseImages()
+			var policyErr rpc.BaseImagePolicyError
+			if tt.violations == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected a BaseImagePolicyError, got %v", err)
+			}
+			if !reflect.DeepEqual(policyErr.Violations, tt.violations) {
+				t.Fatalf("unexpected violations: got: %q wanted: %q", policyErr.Violations, tt.violations)
+			}
+		})
+	}
+}
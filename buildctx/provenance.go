@@ -0,0 +1,288 @@
+package buildctx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+	"github.com/quay/quay-builder/version"
+)
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	inTotoPayloadType   = "application/vnd.in-toto+json"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	// provenanceBuildType identifies the schema of the parameters in the
+	// provenance of builds run by this builder.
+	provenanceBuildType = "https://github.com/quay/quay-builder/buildtypes/dockerfile/v1"
+	// builderID identifies this builder as the platform that ran builds.
+	builderID = "https://github.com/quay/quay-builder"
+
+	// dsseMediaType is the media type cosign gives the layers of an
+	// attestation, each holding a DSSE envelope.
+	dsseMediaType = "application/vnd.dsse.envelope.v1+json"
+	// predicateTypeAnnotation is the annotation cosign uses to find the
+	// attestations with a given predicate type.
+	predicateTypeAnnotation = "predicateType"
+	// attestationTagSuffix is appended to the digest of an image to name the
+	// tag its attestations are stored in.
+	attestationTagSuffix = ".att"
+)
+
+// inTotoStatement is an in-toto attestation about the images in Subject.
+type inTotoStatement struct {
+	Type          string           `json:"_type"`
+	Subject       []resourceDigest `json:"subject"`
+	PredicateType string           `json:"predicateType"`
+	Predicate     slsaProvenance   `json:"predicate"`
+}
+
+// resourceDigest is an in-toto resource descriptor: an artifact identified by
+// its URI or name and its digests.
+type resourceDigest struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// slsaProvenance is a SLSA v1 provenance predicate.
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   provenanceParameters `json:"externalParameters"`
+		InternalParameters   map[string]string    `json:"internalParameters,omitempty"`
+		ResolvedDependencies []resourceDigest     `json:"resolvedDependencies,omitempty"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string `json:"invocationId,omitempty"`
+			StartedOn    string `json:"startedOn,omitempty"`
+			FinishedOn   string `json:"finishedOn,omitempty"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// provenanceParameters are the inputs to a build that were chosen by whoever
+// requested it.
+type provenanceParameters struct {
+	Source     resourceDigest    `json:"source"`
+	Context    string            `json:"context,omitempty"`
+	Dockerfile string            `json:"dockerfile"`
+	BuildArgs  map[string]string `json:"buildArgs,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+}
+
+// redactURL removes any credentials, query and fragment from a URL, as they
+// may hold secrets (such as the signature of a presigned S3 URL). Strings that
+// aren't URLs, such as scp-style git remotes, only have a user removed.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		if at := strings.Index(rawURL, "@"); at >= 0 && !strings.Contains(rawURL[:at], "/") {
+			return rawURL[at+1:]
+		}
+		return rawURL
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// provenanceSource describes the sources the build was run from: the git
+// commit, or the build package and its digest.
+func provenanceSource(args *rpc.BuildArgs, commitSHA string) resourceDigest {
+	if args.Git != nil {
+		source := resourceDigest{URI: "git+" + redactURL(args.Git.URL)}
+		if args.Git.Ref != "" {
+			source.URI += "@" + args.Git.Ref
+		}
+		if commitSHA != "" {
+			source.Digest = map[string]string{"gitCommit": commitSHA}
+		}
+		return source
+	}
+
+	source := resourceDigest{URI: redactURL(args.BuildPackage)}
+	if d, err := digest.Parse(args.BuildPackageDigest); err == nil {
+		source.Digest = map[string]string{d.Algorithm().String(): d.Encoded()}
+	}
+	return source
+}
+
+// provenanceStatement describes how the image with the given digest was built.
+func (bc *Context) provenanceStatement(image name.Digest) inTotoStatement {
+	d, _ := digest.Parse(image.DigestStr())
+	statement := inTotoStatement{
+		Type: inTotoStatementType,
+		Subject: []resourceDigest{{
+			Name:   image.Context().Name(),
+			Digest: map[string]string{d.Algorithm().String(): d.Encoded()},
+		}},
+		PredicateType: slsaProvenanceType,
+	}
+
+	def := &statement.Predicate.BuildDefinition
+	def.BuildType = provenanceBuildType
+	def.ExternalParameters = provenanceParameters{
+		Source:     provenanceSource(bc.args, bc.commitSHA),
+		Context:    bc.args.Context,
+		Dockerfile: bc.args.DockerfilePath,
+		BuildArgs:  bc.buildArgs,
+		Tags:       bc.args.TagNames,
+	}
+	if bc.contextDigest != "" {
+		def.InternalParameters = map[string]string{"contextDigest": bc.contextDigest}
+	}
+	def.ResolvedDependencies = append([]resourceDigest{def.ExternalParameters.Source}, bc.imageDependencies()...)
+
+	run := &statement.Predicate.RunDetails
+	run.Builder.ID = builderID
+	run.Builder.Version = map[string]string{"quay-builder": version.Version}
+	run.Metadata.InvocationID = bc.buildID
+	if !bc.startedOn.IsZero() {
+		run.Metadata.StartedOn = bc.startedOn.UTC().Format(time.RFC3339)
+	}
+	if !bc.finishedOn.IsZero() {
+		run.Metadata.FinishedOn = bc.finishedOn.UTC().Format(time.RFC3339)
+	}
+
+	return statement
+}
+
+// imageDependencies returns the base images of the Dockerfile, the images it
+// copies or mounts files from and the frontend image BuildKit built it with
+// (if any), with the digests they had when they were pulled. Images that are
+// no longer present are listed without a digest, and images whose names
+// depend on build args are listed as written.
+func (bc *Context) imageDependencies() []resourceDigest {
+	images := append(append([]string{}, bc.metadata.BaseImages...), bc.metadata.CopiedImages...)
+	if bc.metadata.Syntax != "" && bc.containerClient.UsesBuildKit() {
+		images = append(images, bc.metadata.Syntax)
+	}
+
+	var dependencies []resourceDigest
+	seen := map[string]bool{}
+	for _, image := range images {
+		if seen[image] {
+			continue
+		}
+		seen[image] = true
+
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			dependencies = append(dependencies, resourceDigest{URI: image})
+			continue
+		}
+		dependency := resourceDigest{URI: named.String()}
+
+		if digested, ok := named.(reference.Digested); ok {
+			dependency.Digest = map[string]string{digested.Digest().Algorithm().String(): digested.Digest().Encoded()}
+		} else if d := bc.localImageDigest(named); d != "" {
+			dependency.Digest = map[string]string{d.Algorithm().String(): d.Encoded()}
+		}
+
+		dependencies = append(dependencies, dependency)
+	}
+
+	return dependencies
+}
+
+// localImageDigest returns the digest of the manifest an image was pulled as,
+// preferring the digest from its own repository over one from a mirror. It
+// returns "" if the image isn't present.
+func (bc *Context) localImageDigest(named reference.Named) digest.Digest {
+	img, err := bc.containerClient.InspectImage(reference.FamiliarString(reference.TagNameOnly(named)))
+	if err != nil {
+		log.Infof("could not find digest of base image %s: %v", named, err)
+		return ""
+	}
+
+	var found digest.Digest
+	for _, repoDigest := range img.RepoDigests {
+		ref, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		digested, ok := ref.(reference.Digested)
+		if !ok {
+			continue
+		}
+		if ref.Name() == named.Name() {
+			return digested.Digest()
+		}
+		if found == "" {
+			found = digested.Digest()
+		}
+	}
+
+	return found
+}
+
+// attestImage signs the statement as a DSSE envelope and pushes it to the
+// image's repository, next to any attestations it already has. It returns the
+// tag the attestation was pushed to.
+func attestImage(image name.Digest, signer signature.Signer, statement []byte, predicateType string, opts ...remote.Option) (name.Tag, error) {
+	envelope, err := dsse.WrapSigner(signer, inTotoPayloadType).SignMessage(bytes.NewReader(statement))
+	if err != nil {
+		return name.Tag{}, fmt.Errorf("failed to sign attestation for %s: %w", image, err)
+	}
+
+	tag := attachedTag(image, attestationTagSuffix)
+	err = appendToTag(tag, static.NewLayer(envelope, dsseMediaType), map[string]string{
+		predicateTypeAnnotation: predicateType,
+	}, opts...)
+	if err != nil {
+		return name.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+// attestProvenance pushes a SLSA provenance attestation for the image, signed
+// with the key sent with the build, and returns the statement along with the
+// tag it was pushed to.
+func (bc *Context) attestProvenance(image name.Digest) (string, []string, error) {
+	signer, err := loadSigner(bc.args.SigningKey)
+	if err != nil {
+		return "", nil, rpc.SignError{Err: err.Error()}
+	}
+
+	statement, err := json.Marshal(bc.provenanceStatement(image))
+	if err != nil {
+		return "", nil, rpc.SignError{Err: err.Error()}
+	}
+
+	var tag name.Tag
+	err = retryDockerRequest(bc.writer, bc.retryPolicy, func() error {
+		var aerr error
+		tag, aerr = attestImage(image, signer, statement, slsaProvenanceType, pushRemoteOptions(bc.args, bc.registry)...)
+		return aerr
+	})
+	if err != nil {
+		return "", nil, rpc.SignError{Err: err.Error()}
+	}
+
+	log.Infof("attested provenance of %s as %s", image, tag)
+	bc.writer.WriteStream(fmt.Sprintf("Pushed provenance attestation for %s to %s\n", image.DigestStr(), tag))
+
+	return string(statement), []string{tag.String()}, nil
+}
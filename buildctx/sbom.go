@@ -0,0 +1,172 @@
+package buildctx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+	"github.com/quay/quay-builder/sbom"
+)
+
+// emptyJSON is the content of the config blob of artifacts that have no
+// configuration.
+var emptyJSON = []byte("{}")
+
+// artifactManifest is an OCI image manifest for an artifact that refers to
+// another image as its subject, so it is listed by the registry's referrers
+// API. The manifest is built by hand as go-containerregistry doesn't support
+// artifactType.
+type artifactManifest struct {
+	SchemaVersion int64           `json:"schemaVersion"`
+	MediaType     types.MediaType `json:"mediaType"`
+	ArtifactType  string          `json:"artifactType"`
+	Config        v1.Descriptor   `json:"config"`
+	Layers        []v1.Descriptor `json:"layers"`
+	Subject       *v1.Descriptor  `json:"subject"`
+}
+
+// rawManifest is a manifest pushed by remote.Put.
+type rawManifest []byte
+
+func (m rawManifest) RawManifest() ([]byte, error) { return m, nil }
+
+func (m rawManifest) MediaType() (types.MediaType, error) { return types.OCIManifestSchema1, nil }
+
+// generateSBOM inventories the packages in the image and writes them as an
+// SBOM in the format, returning it along with the inventory.
+func generateSBOM(image name.Digest, img v1.Image, format sbom.Format, created time.Time) ([]byte, *sbom.Inventory, error) {
+	fs := mutate.Extract(img)
+	defer fs.Close()
+
+	inventory, err := sbom.Scan(fs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to inventory %s: %w", image, err)
+	}
+
+	data, err := sbom.Encode(format, sbom.Subject{
+		Repository: image.Context().Name(),
+		Digest:     image.DigestStr(),
+	}, inventory, created)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, inventory, nil
+}
+
+// attachArtifact pushes data to the repository of image as an artifact that
+// refers to image, and returns the digest of the artifact's manifest. The
+// artifact type is also used as the media type of its config, for registries
+// that don't support the referrers API and clients that look there for it.
+func attachArtifact(image name.Digest, subject v1.Descriptor, artifactType string, data []byte, filename string, opts ...remote.Option) (v1.Hash, error) {
+	mediaType := types.MediaType(artifactType)
+	config := static.NewLayer(emptyJSON, mediaType)
+	layer := static.NewLayer(data, mediaType)
+
+	manifest := artifactManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		ArtifactType:  artifactType,
+		Subject:       &subject,
+	}
+	for i, l := range []v1.Layer{config, layer} {
+		if err := remote.WriteLayer(image.Context(), l, opts...); err != nil {
+			return v1.Hash{}, fmt.Errorf("failed to push %s: %w", filename, err)
+		}
+
+		d, err := l.Digest()
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		desc := v1.Descriptor{MediaType: mediaType, Digest: d, Size: size}
+
+		if i == 0 {
+			manifest.Config = desc
+		} else {
+			desc.Annotations = map[string]string{"org.opencontainers.image.title": filename}
+			manifest.Layers = append(manifest.Layers, desc)
+		}
+	}
+
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	digest, _, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	if err := remote.Put(image.Context().Digest(digest.String()), rawManifest(raw), opts...); err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to push %s: %w", filename, err)
+	}
+
+	return digest, nil
+}
+
+// attachSBOM generates an SBOM of the pushed image in the format requested by
+// the BuildManager, and attaches it to the image with the push token. It
+// returns the digest of the manifest the SBOM was attached as.
+func (bc *Context) attachSBOM(image name.Digest) (string, error) {
+	format, err := sbom.ParseFormat(bc.args.SBOMFormat)
+	if err != nil {
+		return "", rpc.SBOMError{Err: err.Error()}
+	}
+
+	opts := pushRemoteOptions(bc.args, bc.registry)
+	bc.writer.WriteStream(fmt.Sprintf("Generating %s SBOM for %s\n", format, image.DigestStr()))
+
+	img, err := remote.Image(image, opts...)
+	if err != nil {
+		return "", rpc.SBOMError{Err: fmt.Sprintf("failed to fetch %s: %s", image, err)}
+	}
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		return "", rpc.SBOMError{Err: err.Error()}
+	}
+
+	// Reproducible builds produce reproducible SBOMs.
+	created := time.Now()
+	if bc.sourceDateEpoch != nil {
+		created = *bc.sourceDateEpoch
+	}
+
+	data, inventory, err := generateSBOM(image, img, format, created)
+	if err != nil {
+		return "", rpc.SBOMError{Err: err.Error()}
+	}
+	for _, db := range inventory.Unsupported {
+		log.Warningf("not listing the packages in %s in the SBOM of %s", db, image)
+		bc.writer.WriteStream(fmt.Sprintf("Warning: RPM databases are not supported, so the packages in %s are not listed in the SBOM\n", db))
+	}
+
+	var digest v1.Hash
+	err = retryDockerRequest(bc.writer, bc.retryPolicy, func() error {
+		var aerr error
+		digest, aerr = attachArtifact(image, *subject, format.MediaType(), data, "sbom."+string(format)+".json", opts...)
+		return aerr
+	})
+	if err != nil {
+		return "", rpc.SBOMError{Err: err.Error()}
+	}
+
+	log.Infof("attached SBOM %s to %s", digest, image)
+	bc.writer.WriteStream(fmt.Sprintf("Attached SBOM listing %d packages as %s\n", len(inventory.Packages), digest))
+
+	return digest.String(), nil
+}
@@ -0,0 +1,122 @@
+package buildctx
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/quay/quay-builder/sbom"
+)
+
+func TestAttachSBOM(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// An image with a single OS package installed.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"etc/os-release":       "ID=alpine\nVERSION_ID=3.19.1\n",
+		"lib/apk/db/installed": "P:musl\nV:1.2.4-r2\n",
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := name.NewTag(host + "/org/repo:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := tag.Context().Digest(imgDigest.String())
+
+	data, inventory, err := generateSBOM(image, img, sbom.FormatSPDX, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inventory.Packages) != 1 || !strings.Contains(string(data), "pkg:apk/alpine/musl@1.2.4-r2") {
+		t.Fatalf("SBOM doesn't list musl:\n%s", data)
+	}
+
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := attachArtifact(image, *subject, sbom.FormatSPDX.MediaType(), data, "sbom.spdx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	referrers, err := remote.Referrers(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := referrers.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 {
+		t.Fatalf("expected 1 referrer, got %d", len(index.Manifests))
+	}
+	if index.Manifests[0].Digest != digest || index.Manifests[0].ArtifactType != "application/spdx+json" {
+		t.Errorf("got referrer %+v, wanted %s of type application/spdx+json", index.Manifests[0], digest)
+	}
+
+	artifact, err := remote.Image(image.Context().Digest(digest.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := artifact.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("expected 1 layer, got %d", len(layers))
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	pushed, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pushed, data) {
+		t.Error("pushed SBOM doesn't match the generated one")
+	}
+}
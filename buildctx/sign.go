@@ -0,0 +1,195 @@
+package buildctx
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/secure-systems-lab/go-securesystemslib/encrypted"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+const (
+	// simpleSigningMediaType is the media type cosign gives the payload layer
+	// of a signature.
+	simpleSigningMediaType types.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// signatureAnnotation is the annotation on the payload layer holding the
+	// base64-encoded signature of the payload.
+	signatureAnnotation = "dev.cosignproject.cosign/signature"
+	// signatureTagSuffix is appended to the digest of an image to name the tag
+	// its signatures are stored in.
+	signatureTagSuffix = ".sig"
+)
+
+// loadSigner decodes the PEM-encoded private key sent with the build. Keys
+// generated by cosign are encrypted with a password, but unencrypted PKCS #8,
+// EC and RSA keys are also accepted.
+func loadSigner(key *rpc.SigningKey) (signature.Signer, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("signing key is not PEM-encoded")
+	}
+
+	var privateKey crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		der, derr := encrypted.Decrypt(block.Bytes, []byte(key.Password))
+		if derr != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key: %w", derr)
+		}
+		privateKey, err = x509.ParsePKCS8PrivateKey(der)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	return signature.LoadSigner(privateKey, crypto.SHA256)
+}
+
+// signImage signs the image with the given digest and pushes the signature to
+// the image's repository, next to any signatures it already has. It returns the
+// tag the signature was pushed to.
+func signImage(image name.Digest, signer signature.Signer, opts ...remote.Option) (name.Tag, error) {
+	tag := attachedTag(image, signatureTagSuffix)
+
+	body, err := payload.Cosign{Image: image}.MarshalJSON()
+	if err != nil {
+		return name.Tag{}, err
+	}
+
+	sig, err := signer.SignMessage(bytes.NewReader(body))
+	if err != nil {
+		return name.Tag{}, fmt.Errorf("failed to sign %s: %w", image, err)
+	}
+
+	err = appendToTag(tag, static.NewLayer(body, simpleSigningMediaType), map[string]string{
+		signatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+	}, opts...)
+	if err != nil {
+		return name.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+// attachedTag returns the tag cosign stores the artifacts of a kind (named by
+// suffix) attached to the image with the given digest in.
+func attachedTag(image name.Digest, suffix string) name.Tag {
+	return image.Context().Tag(strings.Replace(image.DigestStr(), ":", "-", 1) + suffix)
+}
+
+// appendToTag adds a layer with the given annotations to the image pushed to
+// tag, or to a new empty image if there is none, and pushes it back.
+func appendToTag(tag name.Tag, layer v1.Layer, annotations map[string]string, opts ...remote.Option) error {
+	base, err := attachedImage(tag, opts...)
+	if err != nil {
+		return err
+	}
+
+	img, err := mutate.Append(base, mutate.Addendum{Layer: layer, Annotations: annotations})
+	if err != nil {
+		return err
+	}
+
+	if err := remote.Write(tag, img, opts...); err != nil {
+		return fmt.Errorf("failed to push %s: %w", tag, err)
+	}
+
+	return nil
+}
+
+// attachedImage returns the image holding the artifacts already pushed to tag,
+// or an empty one if there are none.
+func attachedImage(tag name.Tag, opts ...remote.Option) (v1.Image, error) {
+	img, err := remote.Image(tag, opts...)
+	if err == nil {
+		return img, nil
+	}
+
+	var terr *transport.Error
+	if !errors.As(err, &terr) || terr.StatusCode != 404 {
+		return nil, fmt.Errorf("failed to fetch %s: %w", tag, err)
+	}
+
+	return mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON), nil
+}
+
+// pushedDigest returns the digest of the image pushed to repo: the digest the
+// container runtime reported pushing, if any, or else one of the image's repo
+// digests or, failing that, the digest of the first tag pushed, asked of the
+// registry.
+func pushedDigest(repo name.Repository, pushed string, repoDigests []string, tagNames []string, opts ...remote.Option) (name.Digest, error) {
+	if pushed != "" {
+		return repo.Digest(pushed), nil
+	}
+
+	for _, repoDigest := range repoDigests {
+		d, err := name.NewDigest(repoDigest)
+		if err == nil && d.Context().Name() == repo.Name() {
+			return repo.Digest(d.DigestStr()), nil
+		}
+	}
+
+	if len(tagNames) == 0 {
+		return name.Digest{}, errors.New("no tags were pushed")
+	}
+
+	tag := repo.Tag(tagNames[0])
+	desc, err := remote.Head(tag, opts...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to find the digest of %s: %w", tag, err)
+	}
+
+	return repo.Digest(desc.Digest.String()), nil
+}
+
+// sign signs the pushed image with the key sent with the build and pushes the
+// signature with the push token. It returns the tags the signatures were
+// pushed to.
+func (bc *Context) sign(image name.Digest) ([]string, error) {
+	signer, err := loadSigner(bc.args.SigningKey)
+	if err != nil {
+		return nil, rpc.SignError{Err: err.Error()}
+	}
+
+	var tag name.Tag
+	err = retryDockerRequest(bc.writer, bc.retryPolicy, func() error {
+		var serr error
+		tag, serr = signImage(image, signer, pushRemoteOptions(bc.args, bc.registry)...)
+		return serr
+	})
+	if err != nil {
+		return nil, rpc.SignError{Err: err.Error()}
+	}
+
+	log.Infof("signed %s as %s", image, tag)
+	bc.writer.WriteStream(fmt.Sprintf("Signed %s, pushed signature to %s\n", image.DigestStr(), tag))
+
+	return []string{tag.String()}, nil
+}
@@ -0,0 +1,186 @@
+package buildctx
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/secure-systems-lab/go-securesystemslib/encrypted"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/payload"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+func generateSigningKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, der
+}
+
+func TestLoadSigner(t *testing.T) {
+	key, der := generateSigningKey(t)
+	ecDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := encrypted.Encrypt(der, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(blockType string, b []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}))
+	}
+
+	table := []struct {
+		name     string
+		key      rpc.SigningKey
+		expected bool
+	}{
+		{"pkcs8", rpc.SigningKey{PrivateKey: encode("PRIVATE KEY", der)}, true},
+		{"ec", rpc.SigningKey{PrivateKey: encode("EC PRIVATE KEY", ecDER)}, true},
+		{"cosign", rpc.SigningKey{PrivateKey: encode("ENCRYPTED SIGSTORE PRIVATE KEY", ciphertext), Password: "hunter2"}, true},
+		{"old cosign", rpc.SigningKey{PrivateKey: encode("ENCRYPTED COSIGN PRIVATE KEY", ciphertext), Password: "hunter2"}, true},
+		{"wrong password", rpc.SigningKey{PrivateKey: encode("ENCRYPTED SIGSTORE PRIVATE KEY", ciphertext), Password: "wrong"}, false},
+		{"not pem", rpc.SigningKey{PrivateKey: "not a key"}, false},
+		{"public key", rpc.SigningKey{PrivateKey: encode("PUBLIC KEY", der)}, false},
+	}
+
+	for _, tt := range table {
+		_, err := loadSigner(&tt.key)
+		if (err == nil) != tt.expected {
+			t.Errorf("%s: got error %v, wanted success %t", tt.name, err, tt.expected)
+		}
+	}
+}
+
+func TestSignImage(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagRef, err := name.NewTag(host + "/org/repo:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tagRef, img); err != nil {
+		t.Fatal(err)
+	}
+	imageDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a digest or repo digests from the container runtime, the digest
+	// is looked up in the registry.
+	repo, err := name.NewRepository(host + "/org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := pushedDigest(repo, "", []string{"quay.io/other/repo@" + imageDigest.String()}, []string{"latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.DigestStr() != imageDigest.String() {
+		t.Fatalf("got digest %s, wanted %s", image.DigestStr(), imageDigest)
+	}
+
+	key, _ := generateSigningKey(t)
+	signer, err := signature.LoadSigner(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := signature.LoadVerifier(key.Public(), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing twice keeps both signatures.
+	for i := 0; i < 2; i++ {
+		tag, err := signImage(image, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedTag := host + "/org/repo:" + strings.Replace(imageDigest.String(), ":", "-", 1) + ".sig"
+		if tag.String() != expectedTag {
+			t.Fatalf("got signature tag %s, wanted %s", tag, expectedTag)
+		}
+	}
+
+	sigImage, err := remote.Image(attachedTag(image, signatureTagSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := sigImage.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 2 {
+		t.Fatalf("expected 2 signatures, got %d", len(manifest.Layers))
+	}
+
+	layers, err := sigImage.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, layer := range layers {
+		desc := manifest.Layers[i]
+		if desc.MediaType != simpleSigningMediaType {
+			t.Errorf("layer %d: got media type %s", i, desc.MediaType)
+		}
+
+		rc, err := layer.Uncompressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(desc.Annotations[signatureAnnotation])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifier.VerifySignature(bytes.NewReader(sig), bytes.NewReader(body)); err != nil {
+			t.Errorf("layer %d: signature doesn't verify: %v", i, err)
+		}
+
+		var p payload.SimpleContainerImage
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Critical.Image.DockerManifestDigest != imageDigest.String() {
+			t.Errorf("layer %d: signed digest %s, wanted %s", i, p.Critical.Image.DockerManifestDigest, imageDigest)
+		}
+		if p.Critical.Identity.DockerReference != host+"/org/repo" {
+			t.Errorf("layer %d: signed reference %s", i, p.Critical.Identity.DockerReference)
+		}
+	}
+}
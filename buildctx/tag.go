@@ -0,0 +1,153 @@
+package buildctx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/containerclient"
+	"github.com/quay/quay-builder/retry"
+	"github.com/quay/quay-builder/rpc"
+)
+
+// remoteTagConcurrency is the number of tags created at the same time.
+const remoteTagConcurrency = 4
+
+// tagRemotely points each of the tags in the image's repository at the
+// already pushed image, by putting its manifest under the tag. Only the
+// manifest is sent, so no blobs are checked or uploaded again. It returns the
+// error, if any, for each tag.
+func tagRemotely(image name.Digest, tagNames []string, opts ...remote.Option) []error {
+	errs := make([]error, len(tagNames))
+
+	desc, err := remote.Get(image, opts...)
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("failed to fetch manifest of %s: %w", image, err)
+		}
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, remoteTagConcurrency)
+	for i, tagName := range tagNames {
+		wg.Add(1)
+		go func(i int, tagName string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			errs[i] = remote.Tag(image.Context().Tag(tagName), desc, opts...)
+		}(i, tagName)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// pushTag tags the image with tagName in the build's repository and pushes it
+// with the container runtime. It returns the digest the runtime reported
+// pushing, if any.
+func pushTag(w containerclient.LogWriter, containerClient containerclient.Client, policy retry.Policy, args *rpc.BuildArgs, imageID, tagName string) (string, error) {
+	log.Infof("tagging image %s as %s:%s", imageID, args.FullRepoName(), tagName)
+	err := containerClient.TagImage(imageID, containerclient.TagImageOptions{
+		Repository: args.FullRepoName(),
+		Tag:        tagName,
+		Force:      true,
+	})
+	if err != nil {
+		return "", rpc.TagError{Err: err.Error()}
+	}
+
+	if rerr, hasResponseError := w.ErrResponse(); hasResponseError {
+		return "", rpc.TagError{Err: rerr.Error()}
+	}
+
+	fullyQualifiedName := args.FullRepoName() + ":" + tagName
+	log.Infof("pushing image %s (%s)", fullyQualifiedName, imageID)
+	var digest string
+	err = retryDockerRequest(w, policy, func() error {
+		var perr error
+		digest, perr = containerClient.PushImage(
+			containerclient.PushImageOptions{
+				Repository:   args.FullRepoName(),
+				Registry:     args.Registry,
+				Tag:          tagName,
+				OutputStream: w,
+			},
+			containerclient.AuthConfiguration{
+				Username: "$token",
+				Password: args.PushToken,
+			},
+		)
+		return perr
+	})
+	if err != nil {
+		return "", rpc.PushError{Err: err.Error()}
+	}
+
+	log.Infof("successfully pushed %s (%s)", fullyQualifiedName, digest)
+	return digest, nil
+}
+
+// tagPushedImage creates every tag after the first, which the image was pushed
+// as with the given digest, logging whether each of them succeeded. Tags that
+// can't be created through the registry API, or every tag if the container
+// runtime didn't report the digest it pushed, are pushed with the runtime
+// instead.
+func tagPushedImage(w containerclient.LogWriter, containerClient containerclient.Client, policy retry.Policy, args *rpc.BuildArgs, access registryAccess, imageID, pushed string) error {
+	tagNames := args.TagNames[1:]
+	errs := make([]error, len(tagNames))
+	var image name.Digest
+	if pushed == "" {
+		log.Warningf("the digest of %s:%s wasn't reported, pushing its other tags", args.FullRepoName(), args.TagNames[0])
+		for i := range errs {
+			errs[i] = errors.New("the pushed digest is unknown")
+		}
+	} else {
+		repo, err := access.repository(args.FullRepoName())
+		if err != nil {
+			return rpc.PushError{Err: err.Error()}
+		}
+		image = repo.Digest(pushed)
+		errs = tagRemotely(image, tagNames, pushRemoteOptions(args, access)...)
+	}
+
+	tagged := []string{args.TagNames[0]}
+	var failed []string
+	for i, err := range errs {
+		tagName := tagNames[i]
+		if err == nil {
+			log.Infof("tagged %s as %s", image, tagName)
+			w.WriteStream(fmt.Sprintf("Tagged %s as %s\n", image.DigestStr(), tagName))
+			tagged = append(tagged, tagName)
+			continue
+		}
+
+		if pushed != "" {
+			log.Warningf("failed to tag %s as %s, pushing it instead: %v", image, tagName, err)
+		}
+		if _, err := pushTag(w, containerClient, policy, args, imageID, tagName); err != nil {
+			log.Errorf("failed to push %s as %s: %v", imageID, tagName, err)
+			w.WriteStream(fmt.Sprintf("Failed to push the image as %s: %v\n", tagName, err))
+			failed = append(failed, tagName)
+			continue
+		}
+		tagged = append(tagged, tagName)
+	}
+
+	if len(failed) > 0 {
+		return rpc.PartialPushError{
+			Err:    fmt.Sprintf("pushed %s:%s, but failed to create tags: %s", args.FullRepoName(), args.TagNames[0], strings.Join(failed, ", ")),
+			Tagged: tagged,
+			Failed: failed,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package buildctx
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/quay/quay-builder/containerclient"
+	"github.com/quay/quay-builder/containerclient/dockerfile"
+	"github.com/quay/quay-builder/retry"
+	"github.com/quay/quay-builder/rpc"
+)
+
+func TestTagRemotely(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(host + "/org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(repo.Tag("latest"), img); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		digest   string
+		tagNames []string
+		failed   bool
+	}{
+		{"pushed image", imageDigest.String(), []string{"v1", "v1.2", "v1.2.3", "stable", "prod"}, false},
+		{"missing image", "sha256:" + strings.Repeat("0", 64), []string{"v2", "v2.0"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := repo.Digest(tt.digest)
+			errs := tagRemotely(image, tt.tagNames)
+			if len(errs) != len(tt.tagNames) {
+				t.Fatalf("got %d results, wanted %d", len(errs), len(tt.tagNames))
+			}
+
+			for i, tagName := range tt.tagNames {
+				if (errs[i] != nil) != tt.failed {
+					t.Fatalf("tagging %s: got error %v, wanted failure: %t", tagName, errs[i], tt.failed)
+				}
+
+				desc, err := remote.Head(repo.Tag(tagName))
+				if tt.failed {
+					if err == nil {
+						t.Fatalf("tag %s was created", tagName)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if desc.Digest != imageDigest {
+					t.Fatalf("tag %s points to %s, wanted %s", tagName, desc.Digest, imageDigest)
+				}
+			}
+		})
+	}
+}
+
+// pushClient is a container client that records the tags it pushes.
+type pushClient struct {
+	containerclient.Client
+	pushed []string
+}
+
+func (c *pushClient) TagImage(string, containerclient.TagImageOptions) error {
+	return nil
+}
+
+func (c *pushClient) PushImage(opts containerclient.PushImageOptions, auth containerclient.AuthConfiguration) (string, error) {
+	c.pushed = append(c.pushed, opts.Tag)
+	return "", nil
+}
+
+// streamLogWriter is a log writer that keeps the lines written to it.
+type streamLogWriter struct {
+	lines []string
+}
+
+func (w *streamLogWriter) ErrResponse() (error, bool) { return nil, false }
+func (w *streamLogWriter) ResetError()                {}
+func (w *streamLogWriter) Flush() error               { return nil }
+func (w *streamLogWriter) WriteError(s string) error  { return w.WriteStream(s) }
+func (w *streamLogWriter) Write(p []byte) (int, error) {
+	return len(p), w.WriteStream(string(p))
+}
+func (w *streamLogWriter) WriteStream(s string) error {
+	w.lines = append(w.lines, s)
+	return nil
+}
+
+func TestTagPushedImage(t *testing.T) {
+	// The registry's certificate is signed by its own CA, like a Quay
+	// deployed with a custom CA_CERT.
+	server := httptest.NewTLSServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	caFile := filepath.Join(t.TempDir(), "cacert.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REGISTRY_CA_FILE", caFile)
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(host + "/org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(repo.Tag("latest"), img, remote.WithTransport(server.Client().Transport)); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name        string
+		access      registryAccess
+		pushed      string
+		tagNames    []string
+		wantRemote  bool
+		wantRuntime []string
+	}{
+		{"trusted CA", registryAccess{rootCAs: registryCAsFromEnv()}, imageDigest.String(), []string{"latest", "v1", "v1.2"}, true, nil},
+		{"untrusted CA", registryAccess{}, imageDigest.String(), []string{"latest", "v2", "v2.0"}, false, []string{"v2", "v2.0"}},
+		{"unknown digest", registryAccess{rootCAs: registryCAsFromEnv()}, "", []string{"latest", "v3"}, false, []string{"v3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &pushClient{}
+			w := &streamLogWriter{}
+			args := &rpc.BuildArgs{Registry: host, Repository: "org/repo", TagNames: tt.tagNames, PushToken: "token"}
+
+			err := tagPushedImage(w, client, retry.Policy{Attempts: 1}, args, tt.access, "sha256:abc", tt.pushed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(client.pushed, tt.wantRuntime) {
+				t.Fatalf("pushed %v with the container runtime, wanted %v", client.pushed, tt.wantRuntime)
+			}
+
+			for _, tagName := range tt.tagNames[1:] {
+				_, err := remote.Head(repo.Tag(tagName), remote.WithTransport(server.Client().Transport))
+				if (err == nil) != tt.wantRemote {
+					t.Fatalf("tag %s: got error %v, wanted it created through the registry API: %t", tagName, err, tt.wantRemote)
+				}
+			}
+		})
+	}
+}
+
+// partialPushClient is a container client that can't push one of the tags.
+type partialPushClient struct {
+	pushClient
+	failTag string
+	removed []string
+}
+
+func (c *partialPushClient) PushImage(opts containerclient.PushImageOptions, auth containerclient.AuthConfiguration) (string, error) {
+	if opts.Tag == c.failTag {
+		return "", errors.New("denied")
+	}
+	return c.pushClient.PushImage(opts, auth)
+}
+
+func (c *partialPushClient) InspectImage(id string) (*containerclient.Image, error) {
+	return &containerclient.Image{ID: id, RepoDigests: []string{"quay.io/org/repo@sha256:abc"}}, nil
+}
+
+func (c *partialPushClient) RemoveImageExtended(image string, opts containerclient.RemoveImageOptions) error {
+	c.removed = append(c.removed, image)
+	return nil
+}
+
+func (c *partialPushClient) PruneImages(containerclient.PruneImagesOptions) (*containerclient.PruneImagesResults, error) {
+	return &containerclient.PruneImagesResults{}, nil
+}
+
+// completeClient is a client that keeps the result of the build.
+type completeClient struct {
+	rpc.Client
+	completed *rpc.BuildMetadata
+}
+
+func (c *completeClient) SetPhase(rpc.Phase, *rpc.PullMetadata) error { return nil }
+
+func (c *completeClient) CompleteBuild(bmd *rpc.BuildMetadata) error {
+	c.completed = bmd
+	return nil
+}
+
+func TestPartialPush(t *testing.T) {
+	containerClient := &partialPushClient{failTag: "v1.2"}
+	client := &completeClient{}
+	bc := &Context{
+		client:          client,
+		writer:          &streamLogWriter{},
+		containerClient: containerClient,
+		retryPolicy:     retry.Policy{Attempts: 1},
+		args:            &rpc.BuildArgs{Registry: "quay.io", Repository: "org/repo", TagNames: []string{"latest", "v1", "v1.2"}},
+		metadata:        &dockerfile.Metadata{BaseImage: "alpine"},
+		buildID:         "sha256:built",
+	}
+
+	bmd, err := bc.Push()
+	var partial rpc.PartialPushError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a PartialPushError, got %v", err)
+	}
+	if bmd == nil {
+		t.Fatal("expected the build metadata of the pushed image")
+	}
+
+	if err := bc.Complete(bmd); err != nil {
+		t.Fatal(err)
+	}
+	if client.completed == nil {
+		t.Fatal("the build wasn't completed")
+	}
+	if !reflect.DeepEqual(client.completed.Tagged, []string{"latest", "v1"}) {
+		t.Fatalf("reported tags %v, wanted [latest v1]", client.completed.Tagged)
+	}
+	if !reflect.DeepEqual(client.completed.FailedTags, []string{"v1.2"}) {
+		t.Fatalf("reported failed tags %v, wanted [v1.2]", client.completed.FailedTags)
+	}
+	if !reflect.DeepEqual(containerClient.removed, []string{"alpine", "sha256:built"}) {
+		t.Fatalf("removed %v, wanted the base and built images", containerClient.removed)
+	}
+}
@@ -0,0 +1,42 @@
+package buildlog
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// File is a file in a bundle.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// WriteBundle writes the files to w as a gzipped tarball.
+func WriteBundle(w io.Writer, files []File) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	now := time.Now()
+	for _, f := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     f.Name,
+			Mode:     0644,
+			Size:     int64(len(f.Data)),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
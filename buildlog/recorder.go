@@ -0,0 +1,210 @@
+// Package buildlog keeps a local record of a build, so that its output isn't
+// lost if the connection to the BuildManager is.
+package buildlog
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+// The types of the records in a build log file.
+const (
+	// LogRecord is a build log entry.
+	LogRecord = "log"
+	// PhaseRecord is a transition to a new phase of the build.
+	PhaseRecord = "phase"
+	// CompleteRecord holds the metadata of a completed build.
+	CompleteRecord = "complete"
+	// ResultRecord is the last record, with the outcome of the build.
+	ResultRecord = "result"
+)
+
+// Record is a line of a build log file.
+type Record struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	// Entry is the log entry of a LogRecord, which is JSON written by the
+	// log writers.
+	Entry json.RawMessage `json:"entry,omitempty"`
+
+	// Phase is the phase a PhaseRecord moves to, and Previous is the phase it
+	// moves from, along with how long the build was in it.
+	Phase            rpc.Phase         `json:"phase,omitempty"`
+	PullMetadata     *rpc.PullMetadata `json:"pull_metadata,omitempty"`
+	Previous         rpc.Phase         `json:"previous,omitempty"`
+	PreviousDuration float64           `json:"previous_duration_seconds,omitempty"`
+
+	// Metadata is the metadata of the built image in a CompleteRecord.
+	Metadata *rpc.BuildMetadata `json:"metadata,omitempty"`
+
+	// Error is the error the build failed with in a ResultRecord, and
+	// Duration is how long the whole build took.
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+
+	// SendError is the error from sending the record to the BuildManager, if
+	// it couldn't be.
+	SendError string `json:"send_error,omitempty"`
+}
+
+// Recorder is an rpc.Client that writes every log entry, phase transition and
+// the build's metadata to a JSON-lines file, as well as sending them to the
+// BuildManager.
+type Recorder struct {
+	rpc.Client
+	path    string
+	started time.Time
+
+	mu           sync.Mutex
+	f            *os.File
+	enc          *json.Encoder
+	failed       bool
+	tolerant     bool
+	sendFailed   bool
+	phase        rpc.Phase
+	phaseStarted time.Time
+}
+
+// NewRecorder creates the file at path and returns a Recorder that writes to
+// it and sends everything on to client.
+func NewRecorder(client rpc.Client, path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Recorder{
+		Client:       client,
+		path:         path,
+		f:            f,
+		enc:          json.NewEncoder(f),
+		started:      now,
+		phase:        rpc.Waiting,
+		phaseStarted: now,
+	}, nil
+}
+
+// Path returns the path of the file the build is recorded in.
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// TolerateSendErrors makes PublishBuildLogEntry only record entries that can't
+// be sent, rather than failing, for builds whose logs are also uploaded in a
+// log bundle.
+func (r *Recorder) TolerateSendErrors() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tolerant = true
+}
+
+// PublishBuildLogEntry records the entry and sends it to the BuildManager. An
+// entry that can't be sent is still recorded, and the error is returned unless
+// send errors are tolerated.
+func (r *Recorder) PublishBuildLogEntry(entry string) error {
+	err := r.Client.PublishBuildLogEntry(entry)
+
+	record := Record{Type: LogRecord, SendError: errorString(err)}
+	if json.Valid([]byte(entry)) {
+		record.Entry = json.RawMessage(entry)
+	} else {
+		record.Entry, _ = json.Marshal(entry)
+	}
+	r.write(record)
+
+	if err == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.tolerant {
+		return err
+	}
+	if !r.sendFailed {
+		r.sendFailed = true
+		log.Warningf("failed to publish log entry, only recording it to %s: %s", r.path, err)
+	}
+	return nil
+}
+
+// SetPhase records the phase transition and sends it to the BuildManager.
+func (r *Recorder) SetPhase(phase rpc.Phase, pmd *rpc.PullMetadata) error {
+	err := r.Client.SetPhase(phase, pmd)
+	r.write(r.phaseRecord(phase, pmd, err))
+	return err
+}
+
+// CompleteBuild records the build's metadata and sends it to the
+// BuildManager.
+func (r *Recorder) CompleteBuild(bmd *rpc.BuildMetadata) error {
+	err := r.Client.CompleteBuild(bmd)
+	r.write(r.phaseRecord(rpc.Complete, nil, err))
+	r.write(Record{Type: CompleteRecord, Metadata: bmd})
+	return err
+}
+
+// Finish records the outcome of the build and closes the file.
+func (r *Recorder) Finish(buildErr error) error {
+	r.write(Record{
+		Type:     ResultRecord,
+		Error:    errorString(buildErr),
+		Duration: time.Since(r.started).Seconds(),
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// phaseRecord moves the build to the phase, and returns the record of the
+// transition.
+func (r *Recorder) phaseRecord(phase rpc.Phase, pmd *rpc.PullMetadata, err error) Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	record := Record{
+		Time:             now,
+		Type:             PhaseRecord,
+		Phase:            phase,
+		PullMetadata:     pmd,
+		SendError:        errorString(err),
+		Previous:         r.phase,
+		PreviousDuration: now.Sub(r.phaseStarted).Seconds(),
+	}
+	r.phase = phase
+	r.phaseStarted = now
+
+	return record
+}
+
+// write appends the record to the file. Failing to write doesn't fail the
+// build, so errors are only logged, once.
+func (r *Recorder) write(record Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	if err := r.enc.Encode(record); err != nil && !r.failed {
+		r.failed = true
+		log.Warningf("failed to write build log file %s: %s", r.path, err)
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,196 @@
+package buildlog
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+// disconnectedClient is a client whose connection to the BuildManager drops
+// after the given number of log entries.
+type disconnectedClient struct {
+	rpc.Client
+	entries int
+	phases  []rpc.Phase
+}
+
+func (c *disconnectedClient) PublishBuildLogEntry(entry string) error {
+	if c.entries == 0 {
+		return errors.New("connection lost")
+	}
+	c.entries--
+	return nil
+}
+
+func (c *disconnectedClient) SetPhase(phase rpc.Phase, pmd *rpc.PullMetadata) error {
+	c.phases = append(c.phases, phase)
+	return nil
+}
+
+func (c *disconnectedClient) CompleteBuild(bmd *rpc.BuildMetadata) error {
+	return c.SetPhase(rpc.Complete, nil)
+}
+
+func readRecords(t *testing.T, path string) []Record {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid record %q: %s", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+func TestRecorder(t *testing.T) {
+	client := &disconnectedClient{entries: 1}
+	path := filepath.Join(t.TempDir(), "build.jsonl")
+	r, err := NewRecorder(client, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SetPhase(rpc.Pulling, &rpc.PullMetadata{BaseImage: "alpine"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PublishBuildLogEntry(`{"stream":"Step 1/2 : FROM alpine\n","type":"step"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetPhase(rpc.Building, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Entries are recorded after the connection drops.
+	if err := r.PublishBuildLogEntry(`{"stream":"Step 2/2 : RUN true\n"}`); err == nil {
+		t.Fatal("expected the entry not to be sent")
+	}
+	// Send errors are tolerated once the logs are uploaded in a bundle.
+	r.TolerateSendErrors()
+	if err := r.PublishBuildLogEntry("not json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CompleteBuild(&rpc.BuildMetadata{ImageID: "sha256:abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(client.phases, []rpc.Phase{rpc.Pulling, rpc.Building, rpc.Complete}) {
+		t.Fatalf("unexpected phases sent: %v", client.phases)
+	}
+
+	records := readRecords(t, path)
+	expected := []struct {
+		typ       string
+		phase     rpc.Phase
+		previous  rpc.Phase
+		entry     string
+		sendError string
+	}{
+		{PhaseRecord, rpc.Pulling, rpc.Waiting, "", ""},
+		{LogRecord, "", "", `{"stream":"Step 1/2 : FROM alpine\n","type":"step"}`, ""},
+		{PhaseRecord, rpc.Building, rpc.Pulling, "", ""},
+		{LogRecord, "", "", `{"stream":"Step 2/2 : RUN true\n"}`, "connection lost"},
+		{LogRecord, "", "", `"not json"`, "connection lost"},
+		{PhaseRecord, rpc.Complete, rpc.Building, "", ""},
+		{CompleteRecord, "", "", "", ""},
+		{ResultRecord, "", "", "", ""},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %+v", len(expected), len(records), records)
+	}
+	for i, e := range expected {
+		record := records[i]
+		if record.Type != e.typ || record.Phase != e.phase || record.Previous != e.previous ||
+			string(record.Entry) != e.entry || record.SendError != e.sendError {
+			t.Errorf("record %d: got %+v, expected %+v", i, record, e)
+		}
+		if record.Time.IsZero() {
+			t.Errorf("record %d has no time", i)
+		}
+	}
+
+	if records[0].PullMetadata == nil || records[0].PullMetadata.BaseImage != "alpine" {
+		t.Errorf("pull metadata wasn't recorded: %+v", records[0])
+	}
+	if records[6].Metadata == nil || records[6].Metadata.ImageID != "sha256:abc" {
+		t.Errorf("build metadata wasn't recorded: %+v", records[6])
+	}
+}
+
+func TestRecorderFailedBuild(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.jsonl")
+	r, err := NewRecorder(&disconnectedClient{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Finish(rpc.PullError{Err: "manifest unknown"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readRecords(t, path)
+	if len(records) != 1 || records[0].Type != ResultRecord || records[0].Error != "manifest unknown" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	files := []File{
+		{Name: "build.jsonl", Data: []byte(`{"type":"log"}` + "\n")},
+		{Name: "Dockerfile", Data: []byte("FROM alpine\n")},
+		{Name: "metadata.json", Data: []byte("{}")},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBundle(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	var got []File
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, File{Name: hdr.Name, Data: data})
+	}
+
+	if !reflect.DeepEqual(got, files) {
+		t.Fatalf("got %+v, expected %+v", got, files)
+	}
+}
@@ -231,15 +231,24 @@ type BuildPack struct {
 	// Types that are assignable to BuildPack:
 	//	*BuildPack_PackageUrl
 	//	*BuildPack_GitPackage_
-	BuildPack      isBuildPack_BuildPack `protobuf_oneof:"build_pack"`
-	Context        string                `protobuf:"bytes,4,opt,name=context,proto3" json:"context,omitempty"`
-	DockerfilePath string                `protobuf:"bytes,5,opt,name=dockerfile_path,json=dockerfilePath,proto3" json:"dockerfile_path,omitempty"`
-	Repository     string                `protobuf:"bytes,6,opt,name=repository,proto3" json:"repository,omitempty"`
-	Registry       string                `protobuf:"bytes,7,opt,name=registry,proto3" json:"registry,omitempty"`
-	PullToken      string                `protobuf:"bytes,8,opt,name=pull_token,json=pullToken,proto3" json:"pull_token,omitempty"`
-	PushToken      string                `protobuf:"bytes,9,opt,name=push_token,json=pushToken,proto3" json:"push_token,omitempty"`
-	TagNames       []string              `protobuf:"bytes,10,rep,name=tag_names,json=tagNames,proto3" json:"tag_names,omitempty"`
-	BaseImage      *BuildPack_BaseImage  `protobuf:"bytes,11,opt,name=base_image,json=baseImage,proto3" json:"base_image,omitempty"`
+	BuildPack       isBuildPack_BuildPack                     `protobuf_oneof:"build_pack"`
+	Context         string                                    `protobuf:"bytes,4,opt,name=context,proto3" json:"context,omitempty"`
+	DockerfilePath  string                                    `protobuf:"bytes,5,opt,name=dockerfile_path,json=dockerfilePath,proto3" json:"dockerfile_path,omitempty"`
+	Repository      string                                    `protobuf:"bytes,6,opt,name=repository,proto3" json:"repository,omitempty"`
+	Registry        string                                    `protobuf:"bytes,7,opt,name=registry,proto3" json:"registry,omitempty"`
+	PullToken       string                                    `protobuf:"bytes,8,opt,name=pull_token,json=pullToken,proto3" json:"pull_token,omitempty"`
+	PushToken       string                                    `protobuf:"bytes,9,opt,name=push_token,json=pushToken,proto3" json:"push_token,omitempty"`
+	TagNames        []string                                  `protobuf:"bytes,10,rep,name=tag_names,json=tagNames,proto3" json:"tag_names,omitempty"`
+	BaseImage       *BuildPack_BaseImage                      `protobuf:"bytes,11,opt,name=base_image,json=baseImage,proto3" json:"base_image,omitempty"`
+	PackageDigest   string                                    `protobuf:"bytes,12,opt,name=package_digest,json=packageDigest,proto3" json:"package_digest,omitempty"`
+	Reproducible    bool                                      `protobuf:"varint,13,opt,name=reproducible,proto3" json:"reproducible,omitempty"`
+	StrictLint      bool                                      `protobuf:"varint,14,opt,name=strict_lint,json=strictLint,proto3" json:"strict_lint,omitempty"`
+	BaseImagePolicy *BuildPack_BaseImagePolicy                `protobuf:"bytes,15,opt,name=base_image_policy,json=baseImagePolicy,proto3" json:"base_image_policy,omitempty"`
+	RegistryAuths   map[string]*BuildPack_RegistryCredentials `protobuf:"bytes,16,rep,name=registry_auths,json=registryAuths,proto3" json:"registry_auths,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	SigningKey      *BuildPack_SigningKey                     `protobuf:"bytes,17,opt,name=signing_key,json=signingKey,proto3" json:"signing_key,omitempty"`
+	SbomFormat      string                                    `protobuf:"bytes,18,opt,name=sbom_format,json=sbomFormat,proto3" json:"sbom_format,omitempty"`
+	Provenance      bool                                      `protobuf:"varint,19,opt,name=provenance,proto3" json:"provenance,omitempty"`
+	LogBundleUrl    string                                    `protobuf:"bytes,20,opt,name=log_bundle_url,json=logBundleUrl,proto3" json:"log_bundle_url,omitempty"`
 }
 
 func (x *BuildPack) Reset() {
@@ -358,6 +367,69 @@ func (x *BuildPack) GetBaseImage() *BuildPack_BaseImage {
 	return nil
 }
 
+func (x *BuildPack) GetPackageDigest() string {
+	if x != nil {
+		return x.PackageDigest
+	}
+	return ""
+}
+
+func (x *BuildPack) GetReproducible() bool {
+	if x != nil {
+		return x.Reproducible
+	}
+	return false
+}
+
+func (x *BuildPack) GetStrictLint() bool {
+	if x != nil {
+		return x.StrictLint
+	}
+	return false
+}
+
+func (x *BuildPack) GetBaseImagePolicy() *BuildPack_BaseImagePolicy {
+	if x != nil {
+		return x.BaseImagePolicy
+	}
+	return nil
+}
+
+func (x *BuildPack) GetRegistryAuths() map[string]*BuildPack_RegistryCredentials {
+	if x != nil {
+		return x.RegistryAuths
+	}
+	return nil
+}
+
+func (x *BuildPack) GetSigningKey() *BuildPack_SigningKey {
+	if x != nil {
+		return x.SigningKey
+	}
+	return nil
+}
+
+func (x *BuildPack) GetSbomFormat() string {
+	if x != nil {
+		return x.SbomFormat
+	}
+	return ""
+}
+
+func (x *BuildPack) GetProvenance() bool {
+	if x != nil {
+		return x.Provenance
+	}
+	return false
+}
+
+func (x *BuildPack) GetLogBundleUrl() string {
+	if x != nil {
+		return x.LogBundleUrl
+	}
+	return ""
+}
+
 type isBuildPack_BuildPack interface {
 	isBuildPack_BuildPack()
 }
@@ -473,10 +545,11 @@ type SetPhaseRequest struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	JobJwt         string                        `protobuf:"bytes,1,opt,name=job_jwt,json=jobJwt,proto3" json:"job_jwt,omitempty"`
-	SequenceNumber int32                         `protobuf:"varint,2,opt,name=sequence_number,json=sequenceNumber,proto3" json:"sequence_number,omitempty"`
-	Phase          Phase                         `protobuf:"varint,3,opt,name=phase,proto3,enum=buildman_pb.Phase" json:"phase,omitempty"`
-	PullMetadata   *SetPhaseRequest_PullMetadata `protobuf:"bytes,4,opt,name=pull_metadata,json=pullMetadata,proto3" json:"pull_metadata,omitempty"`
+	JobJwt         string                         `protobuf:"bytes,1,opt,name=job_jwt,json=jobJwt,proto3" json:"job_jwt,omitempty"`
+	SequenceNumber int32                          `protobuf:"varint,2,opt,name=sequence_number,json=sequenceNumber,proto3" json:"sequence_number,omitempty"`
+	Phase          Phase                          `protobuf:"varint,3,opt,name=phase,proto3,enum=buildman_pb.Phase" json:"phase,omitempty"`
+	PullMetadata   *SetPhaseRequest_PullMetadata  `protobuf:"bytes,4,opt,name=pull_metadata,json=pullMetadata,proto3" json:"pull_metadata,omitempty"`
+	BuildMetadata  *SetPhaseRequest_BuildMetadata `protobuf:"bytes,5,opt,name=build_metadata,json=buildMetadata,proto3" json:"build_metadata,omitempty"`
 }
 
 func (x *SetPhaseRequest) Reset() {
@@ -539,6 +612,13 @@ func (x *SetPhaseRequest) GetPullMetadata() *SetPhaseRequest_PullMetadata {
 	return nil
 }
 
+func (x *SetPhaseRequest) GetBuildMetadata() *SetPhaseRequest_BuildMetadata {
+	if x != nil {
+		return x.BuildMetadata
+	}
+	return nil
+}
+
 type SetPhaseResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -850,7 +930,7 @@ type BuildPack_BaseImage struct {
 func (x *BuildPack_BaseImage) Reset() {
 	*x = BuildPack_BaseImage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_buildman_proto_msgTypes[12]
+		mi := &file_buildman_proto_msgTypes[13]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -863,7 +943,7 @@ func (x *BuildPack_BaseImage) String() string {
 func (*BuildPack_BaseImage) ProtoMessage() {}
 
 func (x *BuildPack_BaseImage) ProtoReflect() protoreflect.Message {
-	mi := &file_buildman_proto_msgTypes[12]
+	mi := &file_buildman_proto_msgTypes[13]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -876,7 +956,7 @@ func (x *BuildPack_BaseImage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BuildPack_BaseImage.ProtoReflect.Descriptor instead.
 func (*BuildPack_BaseImage) Descriptor() ([]byte, []int) {
-	return file_buildman_proto_rawDescGZIP(), []int{3, 0}
+	return file_buildman_proto_rawDescGZIP(), []int{3, 1}
 }
 
 func (x *BuildPack_BaseImage) GetUsername() string {
@@ -893,20 +973,221 @@ func (x *BuildPack_BaseImage) GetPassword() string {
 	return ""
 }
 
+type BuildPack_SigningKey struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PrivateKey string `protobuf:"bytes,1,opt,name=private_key,json=privateKey,proto3" json:"private_key,omitempty"`
+	Password   string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+}
+
+func (x *BuildPack_SigningKey) Reset() {
+	*x = BuildPack_SigningKey{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_buildman_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BuildPack_SigningKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildPack_SigningKey) ProtoMessage() {}
+
+func (x *BuildPack_SigningKey) ProtoReflect() protoreflect.Message {
+	mi := &file_buildman_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildPack_SigningKey.ProtoReflect.Descriptor instead.
+func (*BuildPack_SigningKey) Descriptor() ([]byte, []int) {
+	return file_buildman_proto_rawDescGZIP(), []int{3, 2}
+}
+
+func (x *BuildPack_SigningKey) GetPrivateKey() string {
+	if x != nil {
+		return x.PrivateKey
+	}
+	return ""
+}
+
+func (x *BuildPack_SigningKey) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type BuildPack_RegistryCredentials struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Username string `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Password string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	Auth     string `protobuf:"bytes,3,opt,name=auth,proto3" json:"auth,omitempty"`
+}
+
+func (x *BuildPack_RegistryCredentials) Reset() {
+	*x = BuildPack_RegistryCredentials{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_buildman_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BuildPack_RegistryCredentials) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildPack_RegistryCredentials) ProtoMessage() {}
+
+func (x *BuildPack_RegistryCredentials) ProtoReflect() protoreflect.Message {
+	mi := &file_buildman_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildPack_RegistryCredentials.ProtoReflect.Descriptor instead.
+func (*BuildPack_RegistryCredentials) Descriptor() ([]byte, []int) {
+	return file_buildman_proto_rawDescGZIP(), []int{3, 3}
+}
+
+func (x *BuildPack_RegistryCredentials) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *BuildPack_RegistryCredentials) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *BuildPack_RegistryCredentials) GetAuth() string {
+	if x != nil {
+		return x.Auth
+	}
+	return ""
+}
+
+type BuildPack_BaseImagePolicy struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AllowedRegistries   []string `protobuf:"bytes,1,rep,name=allowed_registries,json=allowedRegistries,proto3" json:"allowed_registries,omitempty"`
+	AllowedRepositories []string `protobuf:"bytes,2,rep,name=allowed_repositories,json=allowedRepositories,proto3" json:"allowed_repositories,omitempty"`
+	DeniedRepositories  []string `protobuf:"bytes,3,rep,name=denied_repositories,json=deniedRepositories,proto3" json:"denied_repositories,omitempty"`
+	RequireDigest       bool     `protobuf:"varint,4,opt,name=require_digest,json=requireDigest,proto3" json:"require_digest,omitempty"`
+	DenyLatest          bool     `protobuf:"varint,5,opt,name=deny_latest,json=denyLatest,proto3" json:"deny_latest,omitempty"`
+}
+
+func (x *BuildPack_BaseImagePolicy) Reset() {
+	*x = BuildPack_BaseImagePolicy{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_buildman_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BuildPack_BaseImagePolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildPack_BaseImagePolicy) ProtoMessage() {}
+
+func (x *BuildPack_BaseImagePolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_buildman_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildPack_BaseImagePolicy.ProtoReflect.Descriptor instead.
+func (*BuildPack_BaseImagePolicy) Descriptor() ([]byte, []int) {
+	return file_buildman_proto_rawDescGZIP(), []int{3, 4}
+}
+
+func (x *BuildPack_BaseImagePolicy) GetAllowedRegistries() []string {
+	if x != nil {
+		return x.AllowedRegistries
+	}
+	return nil
+}
+
+func (x *BuildPack_BaseImagePolicy) GetAllowedRepositories() []string {
+	if x != nil {
+		return x.AllowedRepositories
+	}
+	return nil
+}
+
+func (x *BuildPack_BaseImagePolicy) GetDeniedRepositories() []string {
+	if x != nil {
+		return x.DeniedRepositories
+	}
+	return nil
+}
+
+func (x *BuildPack_BaseImagePolicy) GetRequireDigest() bool {
+	if x != nil {
+		return x.RequireDigest
+	}
+	return false
+}
+
+func (x *BuildPack_BaseImagePolicy) GetDenyLatest() bool {
+	if x != nil {
+		return x.DenyLatest
+	}
+	return false
+}
+
 type BuildPack_GitPackage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Url        string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
-	Sha        string `protobuf:"bytes,2,opt,name=sha,proto3" json:"sha,omitempty"`
-	PrivateKey string `protobuf:"bytes,3,opt,name=private_key,json=privateKey,proto3" json:"private_key,omitempty"`
+	Url                string   `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Sha                string   `protobuf:"bytes,2,opt,name=sha,proto3" json:"sha,omitempty"`
+	PrivateKey         string   `protobuf:"bytes,3,opt,name=private_key,json=privateKey,proto3" json:"private_key,omitempty"`
+	TrustedSigningKeys []string `protobuf:"bytes,4,rep,name=trusted_signing_keys,json=trustedSigningKeys,proto3" json:"trusted_signing_keys,omitempty"`
+	Ref                string   `protobuf:"bytes,5,opt,name=ref,proto3" json:"ref,omitempty"`
+	IdleTimeoutSeconds uint32   `protobuf:"varint,6,opt,name=idle_timeout_seconds,json=idleTimeoutSeconds,proto3" json:"idle_timeout_seconds,omitempty"`
+	TimeoutSeconds     uint32   `protobuf:"varint,7,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
 }
 
 func (x *BuildPack_GitPackage) Reset() {
 	*x = BuildPack_GitPackage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_buildman_proto_msgTypes[13]
+		mi := &file_buildman_proto_msgTypes[17]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -919,7 +1200,7 @@ func (x *BuildPack_GitPackage) String() string {
 func (*BuildPack_GitPackage) ProtoMessage() {}
 
 func (x *BuildPack_GitPackage) ProtoReflect() protoreflect.Message {
-	mi := &file_buildman_proto_msgTypes[13]
+	mi := &file_buildman_proto_msgTypes[17]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -932,7 +1213,7 @@ func (x *BuildPack_GitPackage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BuildPack_GitPackage.ProtoReflect.Descriptor instead.
 func (*BuildPack_GitPackage) Descriptor() ([]byte, []int) {
-	return file_buildman_proto_rawDescGZIP(), []int{3, 1}
+	return file_buildman_proto_rawDescGZIP(), []int{3, 5}
 }
 
 func (x *BuildPack_GitPackage) GetUrl() string {
@@ -956,21 +1237,51 @@ func (x *BuildPack_GitPackage) GetPrivateKey() string {
 	return ""
 }
 
+func (x *BuildPack_GitPackage) GetTrustedSigningKeys() []string {
+	if x != nil {
+		return x.TrustedSigningKeys
+	}
+	return nil
+}
+
+func (x *BuildPack_GitPackage) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+func (x *BuildPack_GitPackage) GetIdleTimeoutSeconds() uint32 {
+	if x != nil {
+		return x.IdleTimeoutSeconds
+	}
+	return 0
+}
+
+func (x *BuildPack_GitPackage) GetTimeoutSeconds() uint32 {
+	if x != nil {
+		return x.TimeoutSeconds
+	}
+	return 0
+}
+
 type SetPhaseRequest_PullMetadata struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	RegistryUrl  string `protobuf:"bytes,1,opt,name=registry_url,json=registryUrl,proto3" json:"registry_url,omitempty"`
-	BaseImage    string `protobuf:"bytes,2,opt,name=base_image,json=baseImage,proto3" json:"base_image,omitempty"`
-	BaseImageTag string `protobuf:"bytes,3,opt,name=base_image_tag,json=baseImageTag,proto3" json:"base_image_tag,omitempty"`
-	PullUsername string `protobuf:"bytes,4,opt,name=pull_username,json=pullUsername,proto3" json:"pull_username,omitempty"`
+	RegistryUrl   string `protobuf:"bytes,1,opt,name=registry_url,json=registryUrl,proto3" json:"registry_url,omitempty"`
+	BaseImage     string `protobuf:"bytes,2,opt,name=base_image,json=baseImage,proto3" json:"base_image,omitempty"`
+	BaseImageTag  string `protobuf:"bytes,3,opt,name=base_image_tag,json=baseImageTag,proto3" json:"base_image_tag,omitempty"`
+	PullUsername  string `protobuf:"bytes,4,opt,name=pull_username,json=pullUsername,proto3" json:"pull_username,omitempty"`
+	MirrorUrl     string `protobuf:"bytes,5,opt,name=mirror_url,json=mirrorUrl,proto3" json:"mirror_url,omitempty"`
+	ContextDigest string `protobuf:"bytes,6,opt,name=context_digest,json=contextDigest,proto3" json:"context_digest,omitempty"`
 }
 
 func (x *SetPhaseRequest_PullMetadata) Reset() {
 	*x = SetPhaseRequest_PullMetadata{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_buildman_proto_msgTypes[14]
+		mi := &file_buildman_proto_msgTypes[18]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -983,7 +1294,7 @@ func (x *SetPhaseRequest_PullMetadata) String() string {
 func (*SetPhaseRequest_PullMetadata) ProtoMessage() {}
 
 func (x *SetPhaseRequest_PullMetadata) ProtoReflect() protoreflect.Message {
-	mi := &file_buildman_proto_msgTypes[14]
+	mi := &file_buildman_proto_msgTypes[18]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1027,6 +1338,139 @@ func (x *SetPhaseRequest_PullMetadata) GetPullUsername() string {
 	return ""
 }
 
+func (x *SetPhaseRequest_PullMetadata) GetMirrorUrl() string {
+	if x != nil {
+		return x.MirrorUrl
+	}
+	return ""
+}
+
+func (x *SetPhaseRequest_PullMetadata) GetContextDigest() string {
+	if x != nil {
+		return x.ContextDigest
+	}
+	return ""
+}
+
+type SetPhaseRequest_BuildMetadata struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ImageId       string   `protobuf:"bytes,1,opt,name=image_id,json=imageId,proto3" json:"image_id,omitempty"`
+	Digests       []string `protobuf:"bytes,2,rep,name=digests,proto3" json:"digests,omitempty"`
+	CommitSha     string   `protobuf:"bytes,3,opt,name=commit_sha,json=commitSha,proto3" json:"commit_sha,omitempty"`
+	ContextDigest string   `protobuf:"bytes,4,opt,name=context_digest,json=contextDigest,proto3" json:"context_digest,omitempty"`
+	Signatures    []string `protobuf:"bytes,5,rep,name=signatures,proto3" json:"signatures,omitempty"`
+	SbomDigest    string   `protobuf:"bytes,6,opt,name=sbom_digest,json=sbomDigest,proto3" json:"sbom_digest,omitempty"`
+	Provenance    string   `protobuf:"bytes,7,opt,name=provenance,proto3" json:"provenance,omitempty"`
+	Attestations  []string `protobuf:"bytes,8,rep,name=attestations,proto3" json:"attestations,omitempty"`
+	Tagged        []string `protobuf:"bytes,9,rep,name=tagged,proto3" json:"tagged,omitempty"`
+	FailedTags    []string `protobuf:"bytes,10,rep,name=failed_tags,json=failedTags,proto3" json:"failed_tags,omitempty"`
+}
+
+func (x *SetPhaseRequest_BuildMetadata) Reset() {
+	*x = SetPhaseRequest_BuildMetadata{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_buildman_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetPhaseRequest_BuildMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetPhaseRequest_BuildMetadata) ProtoMessage() {}
+
+func (x *SetPhaseRequest_BuildMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_buildman_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetPhaseRequest_BuildMetadata.ProtoReflect.Descriptor instead.
+func (*SetPhaseRequest_BuildMetadata) Descriptor() ([]byte, []int) {
+	return file_buildman_proto_rawDescGZIP(), []int{6, 1}
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetImageId() string {
+	if x != nil {
+		return x.ImageId
+	}
+	return ""
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetDigests() []string {
+	if x != nil {
+		return x.Digests
+	}
+	return nil
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetCommitSha() string {
+	if x != nil {
+		return x.CommitSha
+	}
+	return ""
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetContextDigest() string {
+	if x != nil {
+		return x.ContextDigest
+	}
+	return ""
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetSignatures() []string {
+	if x != nil {
+		return x.Signatures
+	}
+	return nil
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetSbomDigest() string {
+	if x != nil {
+		return x.SbomDigest
+	}
+	return ""
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetProvenance() string {
+	if x != nil {
+		return x.Provenance
+	}
+	return ""
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetAttestations() []string {
+	if x != nil {
+		return x.Attestations
+	}
+	return nil
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetTagged() []string {
+	if x != nil {
+		return x.Tagged
+	}
+	return nil
+}
+
+func (x *SetPhaseRequest_BuildMetadata) GetFailedTags() []string {
+	if x != nil {
+		return x.FailedTags
+	}
+	return nil
+}
+
 var File_buildman_proto protoreflect.FileDescriptor
 
 var file_buildman_proto_rawDesc = []byte{
@@ -1038,7 +1482,7 @@ var file_buildman_proto_rawDesc = []byte{
 	0x31, 0x0a, 0x0c, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x4a, 0x6f, 0x62, 0x41, 0x72, 0x67, 0x73, 0x12,
 	0x21, 0x0a, 0x0c, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x5f, 0x6a, 0x77, 0x74, 0x18,
 	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x4a,
-	0x77, 0x74, 0x22, 0xce, 0x04, 0x0a, 0x09, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b,
+	0x77, 0x74, 0x22, 0xb6, 0x0d, 0x0a, 0x09, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b,
 	0x12, 0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x6a, 0x77, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x09, 0x52, 0x06, 0x6a, 0x6f, 0x62, 0x4a, 0x77, 0x74, 0x12, 0x21, 0x0a, 0x0b, 0x70, 0x61, 0x63,
 	0x6b, 0x61, 0x67, 0x65, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00,
@@ -1064,118 +1508,218 @@ var file_buildman_proto_rawDesc = []byte{
 	0x62, 0x61, 0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b,
 	0x32, 0x20, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x42,
 	0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x2e, 0x42, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61,
-	0x67, 0x65, 0x52, 0x09, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x1a, 0x43, 0x0a,
-	0x09, 0x42, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x75, 0x73,
-	0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x75, 0x73,
-	0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f,
-	0x72, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f,
-	0x72, 0x64, 0x1a, 0x51, 0x0a, 0x0a, 0x47, 0x69, 0x74, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65,
-	0x12, 0x10, 0x0a, 0x03, 0x75, 0x72, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75,
-	0x72, 0x6c, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x68, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x03, 0x73, 0x68, 0x61, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x5f,
-	0x6b, 0x65, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x70, 0x72, 0x69, 0x76, 0x61,
-	0x74, 0x65, 0x4b, 0x65, 0x79, 0x42, 0x0c, 0x0a, 0x0a, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x5f, 0x70,
-	0x61, 0x63, 0x6b, 0x22, 0x2b, 0x0a, 0x10, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74,
+	0x67, 0x65, 0x52, 0x09, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x25, 0x0a,
+	0x0e, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18,
+	0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x44, 0x69,
+	0x67, 0x65, 0x73, 0x74, 0x12, 0x22, 0x0a, 0x0c, 0x72, 0x65, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63,
+	0x69, 0x62, 0x6c, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x72, 0x65, 0x70, 0x72,
+	0x6f, 0x64, 0x75, 0x63, 0x69, 0x62, 0x6c, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74, 0x72, 0x69,
+	0x63, 0x74, 0x5f, 0x6c, 0x69, 0x6e, 0x74, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x73,
+	0x74, 0x72, 0x69, 0x63, 0x74, 0x4c, 0x69, 0x6e, 0x74, 0x12, 0x52, 0x0a, 0x11, 0x62, 0x61, 0x73,
+	0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x0f,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x26, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f,
+	0x70, 0x62, 0x2e, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x2e, 0x42, 0x61, 0x73,
+	0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x0f, 0x62, 0x61,
+	0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x50, 0x0a,
+	0x0e, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x5f, 0x61, 0x75, 0x74, 0x68, 0x73, 0x18,
+	0x10, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x29, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e,
+	0x5f, 0x70, 0x62, 0x2e, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x2e, 0x52, 0x65,
+	0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x41, 0x75, 0x74, 0x68, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x52, 0x0d, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x41, 0x75, 0x74, 0x68, 0x73, 0x12,
+	0x42, 0x0a, 0x0b, 0x73, 0x69, 0x67, 0x6e, 0x69, 0x6e, 0x67, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x11,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f,
+	0x70, 0x62, 0x2e, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x2e, 0x53, 0x69, 0x67,
+	0x6e, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x52, 0x0a, 0x73, 0x69, 0x67, 0x6e, 0x69, 0x6e, 0x67,
+	0x4b, 0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x62, 0x6f, 0x6d, 0x5f, 0x66, 0x6f, 0x72, 0x6d,
+	0x61, 0x74, 0x18, 0x12, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x62, 0x6f, 0x6d, 0x46, 0x6f,
+	0x72, 0x6d, 0x61, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x70, 0x72, 0x6f, 0x76, 0x65, 0x6e, 0x61, 0x6e,
+	0x63, 0x65, 0x18, 0x13, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x70, 0x72, 0x6f, 0x76, 0x65, 0x6e,
+	0x61, 0x6e, 0x63, 0x65, 0x12, 0x24, 0x0a, 0x0e, 0x6c, 0x6f, 0x67, 0x5f, 0x62, 0x75, 0x6e, 0x64,
+	0x6c, 0x65, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x14, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x6c, 0x6f,
+	0x67, 0x42, 0x75, 0x6e, 0x64, 0x6c, 0x65, 0x55, 0x72, 0x6c, 0x1a, 0x6c, 0x0a, 0x12, 0x52, 0x65,
+	0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x41, 0x75, 0x74, 0x68, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
+	0x65, 0x79, 0x12, 0x40, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x2a, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e,
+	0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74,
+	0x72, 0x79, 0x43, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x73, 0x52, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x43, 0x0a, 0x09, 0x42, 0x61, 0x73, 0x65,
+	0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d,
+	0x65, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x1a, 0x49, 0x0a,
+	0x0a, 0x53, 0x69, 0x67, 0x6e, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x70,
+	0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0a, 0x70, 0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x1a, 0x0a, 0x08,
+	0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x1a, 0x61, 0x0a, 0x13, 0x52, 0x65, 0x67, 0x69,
+	0x73, 0x74, 0x72, 0x79, 0x43, 0x72, 0x65, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x73, 0x12,
+	0x1a, 0x0a, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x70,
+	0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70,
+	0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x75, 0x74, 0x68, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x61, 0x75, 0x74, 0x68, 0x1a, 0xec, 0x01, 0x0a, 0x0f,
+	0x42, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12,
+	0x2d, 0x0a, 0x12, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x72, 0x65, 0x67, 0x69, 0x73,
+	0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x11, 0x61, 0x6c, 0x6c,
+	0x6f, 0x77, 0x65, 0x64, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x69, 0x65, 0x73, 0x12, 0x31,
+	0x0a, 0x14, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x72, 0x65, 0x70, 0x6f, 0x73, 0x69,
+	0x74, 0x6f, 0x72, 0x69, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x13, 0x61, 0x6c,
+	0x6c, 0x6f, 0x77, 0x65, 0x64, 0x52, 0x65, 0x70, 0x6f, 0x73, 0x69, 0x74, 0x6f, 0x72, 0x69, 0x65,
+	0x73, 0x12, 0x2f, 0x0a, 0x13, 0x64, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x5f, 0x72, 0x65, 0x70, 0x6f,
+	0x73, 0x69, 0x74, 0x6f, 0x72, 0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x12,
+	0x64, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x52, 0x65, 0x70, 0x6f, 0x73, 0x69, 0x74, 0x6f, 0x72, 0x69,
+	0x65, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x5f, 0x64, 0x69,
+	0x67, 0x65, 0x73, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x72, 0x65, 0x71, 0x75,
+	0x69, 0x72, 0x65, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x64, 0x65, 0x6e,
+	0x79, 0x5f, 0x6c, 0x61, 0x74, 0x65, 0x73, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a,
+	0x64, 0x65, 0x6e, 0x79, 0x4c, 0x61, 0x74, 0x65, 0x73, 0x74, 0x1a, 0xf0, 0x01, 0x0a, 0x0a, 0x47,
+	0x69, 0x74, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x72, 0x6c,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x12, 0x10, 0x0a, 0x03, 0x73,
+	0x68, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x68, 0x61, 0x12, 0x1f, 0x0a,
+	0x0b, 0x70, 0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0a, 0x70, 0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x30,
+	0x0a, 0x14, 0x74, 0x72, 0x75, 0x73, 0x74, 0x65, 0x64, 0x5f, 0x73, 0x69, 0x67, 0x6e, 0x69, 0x6e,
+	0x67, 0x5f, 0x6b, 0x65, 0x79, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x09, 0x52, 0x12, 0x74, 0x72,
+	0x75, 0x73, 0x74, 0x65, 0x64, 0x53, 0x69, 0x67, 0x6e, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x73,
+	0x12, 0x10, 0x0a, 0x03, 0x72, 0x65, 0x66, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x72,
+	0x65, 0x66, 0x12, 0x30, 0x0a, 0x14, 0x69, 0x64, 0x6c, 0x65, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x6f,
+	0x75, 0x74, 0x5f, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x12, 0x69, 0x64, 0x6c, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x53, 0x65, 0x63,
+	0x6f, 0x6e, 0x64, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x5f,
+	0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x74,
+	0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x42, 0x0c, 0x0a,
+	0x0a, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x5f, 0x70, 0x61, 0x63, 0x6b, 0x22, 0x2b, 0x0a, 0x10, 0x48,
+	0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x6a, 0x77, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x6a, 0x6f, 0x62, 0x4a, 0x77, 0x74, 0x22, 0x29, 0x0a, 0x11, 0x48, 0x65, 0x61, 0x72,
+	0x74, 0x62, 0x65, 0x61, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x14, 0x0a,
+	0x05, 0x72, 0x65, 0x70, 0x6c, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x72, 0x65,
+	0x70, 0x6c, 0x79, 0x22, 0xcf, 0x06, 0x0a, 0x0f, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73, 0x65,
 	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x6a,
 	0x77, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6a, 0x6f, 0x62, 0x4a, 0x77, 0x74,
-	0x22, 0x29, 0x0a, 0x11, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x65, 0x70, 0x6c, 0x79, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x72, 0x65, 0x70, 0x6c, 0x79, 0x22, 0xeb, 0x02, 0x0a, 0x0f,
-	0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
-	0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x6a, 0x77, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x06, 0x6a, 0x6f, 0x62, 0x4a, 0x77, 0x74, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65, 0x71, 0x75,
-	0x65, 0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x05, 0x52, 0x0e, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x4e, 0x75, 0x6d, 0x62, 0x65,
-	0x72, 0x12, 0x28, 0x0a, 0x05, 0x70, 0x68, 0x61, 0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e,
-	0x32, 0x12, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x50,
-	0x68, 0x61, 0x73, 0x65, 0x52, 0x05, 0x70, 0x68, 0x61, 0x73, 0x65, 0x12, 0x4e, 0x0a, 0x0d, 0x70,
-	0x75, 0x6c, 0x6c, 0x5f, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01,
-	0x28, 0x0b, 0x32, 0x29, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62,
-	0x2e, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x2e, 0x50, 0x75, 0x6c, 0x6c, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x0c, 0x70,
-	0x75, 0x6c, 0x6c, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x1a, 0x9b, 0x01, 0x0a, 0x0c,
-	0x50, 0x75, 0x6c, 0x6c, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x21, 0x0a, 0x0c,
-	0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x55, 0x72, 0x6c, 0x12,
-	0x1d, 0x0a, 0x0a, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x09, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x24,
-	0x0a, 0x0e, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x74, 0x61, 0x67,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67,
-	0x65, 0x54, 0x61, 0x67, 0x12, 0x23, 0x0a, 0x0d, 0x70, 0x75, 0x6c, 0x6c, 0x5f, 0x75, 0x73, 0x65,
-	0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x70, 0x75, 0x6c,
-	0x6c, 0x55, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x55, 0x0a, 0x10, 0x53, 0x65, 0x74,
-	0x50, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a,
-	0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07,
-	0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65, 0x71, 0x75, 0x65,
-	0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05,
-	0x52, 0x0e, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72,
-	0x22, 0x8c, 0x01, 0x0a, 0x11, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x6a, 0x77,
-	0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6a, 0x6f, 0x62, 0x4a, 0x77, 0x74, 0x12,
-	0x27, 0x0a, 0x0f, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x75, 0x6d, 0x62,
-	0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e,
-	0x63, 0x65, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x6c, 0x6f, 0x67, 0x5f,
-	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6c,
-	0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x68, 0x61,
-	0x73, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x70, 0x68, 0x61, 0x73, 0x65, 0x22,
-	0x57, 0x0a, 0x12, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12,
-	0x27, 0x0a, 0x0f, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x75, 0x6d, 0x62,
-	0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e,
-	0x63, 0x65, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x22, 0x9d, 0x01, 0x0a, 0x10, 0x43, 0x61, 0x63,
-	0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a,
-	0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x6a, 0x77, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
-	0x6a, 0x6f, 0x62, 0x4a, 0x77, 0x74, 0x12, 0x26, 0x0a, 0x0f, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x69,
-	0x6d, 0x61, 0x67, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x0d, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x24,
-	0x0a, 0x0e, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x74, 0x61, 0x67,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67,
-	0x65, 0x54, 0x61, 0x67, 0x12, 0x22, 0x0a, 0x0d, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61,
-	0x67, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x62, 0x61, 0x73,
-	0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x49, 0x64, 0x22, 0x29, 0x0a, 0x09, 0x43, 0x61, 0x63, 0x68,
-	0x65, 0x64, 0x54, 0x61, 0x67, 0x12, 0x1c, 0x0a, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54,
-	0x61, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64,
-	0x54, 0x61, 0x67, 0x2a, 0x64, 0x0a, 0x05, 0x50, 0x68, 0x61, 0x73, 0x65, 0x12, 0x0b, 0x0a, 0x07,
-	0x57, 0x41, 0x49, 0x54, 0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x55, 0x4e, 0x50,
-	0x41, 0x43, 0x4b, 0x49, 0x4e, 0x47, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x50, 0x55, 0x4c, 0x4c,
-	0x49, 0x4e, 0x47, 0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x42, 0x55, 0x49, 0x4c, 0x44, 0x49, 0x4e,
-	0x47, 0x10, 0x03, 0x12, 0x0b, 0x0a, 0x07, 0x50, 0x55, 0x53, 0x48, 0x49, 0x4e, 0x47, 0x10, 0x04,
-	0x12, 0x0c, 0x0a, 0x08, 0x43, 0x4f, 0x4d, 0x50, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x05, 0x12, 0x09,
-	0x0a, 0x05, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x10, 0x06, 0x32, 0xd4, 0x03, 0x0a, 0x0c, 0x42, 0x75,
-	0x69, 0x6c, 0x64, 0x4d, 0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x12, 0x3a, 0x0a, 0x04, 0x50, 0x69,
-	0x6e, 0x67, 0x12, 0x18, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62,
-	0x2e, 0x50, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x62,
-	0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x52,
-	0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x47, 0x0a, 0x10, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74,
-	0x65, 0x72, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x4a, 0x6f, 0x62, 0x12, 0x19, 0x2e, 0x62, 0x75, 0x69,
-	0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x4a, 0x6f,
-	0x62, 0x41, 0x72, 0x67, 0x73, 0x1a, 0x16, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e,
-	0x5f, 0x70, 0x62, 0x2e, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x22, 0x00, 0x12,
-	0x50, 0x0a, 0x09, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x12, 0x1d, 0x2e, 0x62,
-	0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x48, 0x65, 0x61, 0x72, 0x74,
-	0x62, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x62, 0x75,
-	0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62,
-	0x65, 0x61, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x28, 0x01, 0x30,
-	0x01, 0x12, 0x49, 0x0a, 0x08, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73, 0x65, 0x12, 0x1c, 0x2e,
-	0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x53, 0x65, 0x74, 0x50,
-	0x68, 0x61, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x62, 0x75,
+	0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x75, 0x6d,
+	0x62, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x73, 0x65, 0x71, 0x75, 0x65,
+	0x6e, 0x63, 0x65, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x28, 0x0a, 0x05, 0x70, 0x68, 0x61,
+	0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x12, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64,
+	0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x50, 0x68, 0x61, 0x73, 0x65, 0x52, 0x05, 0x70, 0x68,
+	0x61, 0x73, 0x65, 0x12, 0x4e, 0x0a, 0x0d, 0x70, 0x75, 0x6c, 0x6c, 0x5f, 0x6d, 0x65, 0x74, 0x61,
+	0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x29, 0x2e, 0x62, 0x75, 0x69,
+	0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x50, 0x75, 0x6c, 0x6c, 0x4d, 0x65, 0x74,
+	0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x0c, 0x70, 0x75, 0x6c, 0x6c, 0x4d, 0x65, 0x74, 0x61, 0x64,
+	0x61, 0x74, 0x61, 0x12, 0x51, 0x0a, 0x0e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x5f, 0x6d, 0x65, 0x74,
+	0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x62, 0x75,
 	0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61,
-	0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x53, 0x0a, 0x0a,
-	0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x2e, 0x62, 0x75, 0x69,
-	0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x62, 0x75, 0x69,
-	0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x28, 0x01, 0x30,
-	0x01, 0x12, 0x4d, 0x0a, 0x12, 0x44, 0x65, 0x74, 0x65, 0x72, 0x6d, 0x69, 0x6e, 0x65, 0x43, 0x61,
-	0x63, 0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x12, 0x1d, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d,
-	0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61,
-	0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x22, 0x00,
-	0x42, 0x2a, 0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x71,
-	0x75, 0x61, 0x79, 0x2f, 0x71, 0x75, 0x61, 0x79, 0x2d, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x65, 0x72,
-	0x2f, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x33,
+	0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x4d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x52, 0x0d, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x4d, 0x65,
+	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x1a, 0xe1, 0x01, 0x0a, 0x0c, 0x50, 0x75, 0x6c, 0x6c, 0x4d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x21, 0x0a, 0x0c, 0x72, 0x65, 0x67, 0x69, 0x73,
+	0x74, 0x72, 0x79, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72,
+	0x65, 0x67, 0x69, 0x73, 0x74, 0x72, 0x79, 0x55, 0x72, 0x6c, 0x12, 0x1d, 0x0a, 0x0a, 0x62, 0x61,
+	0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x24, 0x0a, 0x0e, 0x62, 0x61, 0x73,
+	0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x74, 0x61, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0c, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x54, 0x61, 0x67, 0x12,
+	0x23, 0x0a, 0x0d, 0x70, 0x75, 0x6c, 0x6c, 0x5f, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x70, 0x75, 0x6c, 0x6c, 0x55, 0x73, 0x65, 0x72,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x6d, 0x69, 0x72, 0x72, 0x6f, 0x72, 0x5f, 0x75,
+	0x72, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6d, 0x69, 0x72, 0x72, 0x6f, 0x72,
+	0x55, 0x72, 0x6c, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x5f, 0x64,
+	0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6f, 0x6e,
+	0x74, 0x65, 0x78, 0x74, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x1a, 0xc8, 0x02, 0x0a, 0x0d, 0x42,
+	0x75, 0x69, 0x6c, 0x64, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x19, 0x0a, 0x08,
+	0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07,
+	0x69, 0x6d, 0x61, 0x67, 0x65, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x69, 0x67, 0x65, 0x73,
+	0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74,
+	0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x5f, 0x73, 0x68, 0x61, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x53, 0x68, 0x61,
+	0x12, 0x25, 0x0a, 0x0e, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x5f, 0x64, 0x69, 0x67, 0x65,
+	0x73, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x78,
+	0x74, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x69, 0x67, 0x6e, 0x61,
+	0x74, 0x75, 0x72, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x69, 0x67,
+	0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x62, 0x6f, 0x6d, 0x5f,
+	0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x62,
+	0x6f, 0x6d, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x70, 0x72, 0x6f, 0x76,
+	0x65, 0x6e, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x70, 0x72,
+	0x6f, 0x76, 0x65, 0x6e, 0x61, 0x6e, 0x63, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x61, 0x74, 0x74, 0x65,
+	0x73, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c,
+	0x61, 0x74, 0x74, 0x65, 0x73, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x16, 0x0a, 0x06,
+	0x74, 0x61, 0x67, 0x67, 0x65, 0x64, 0x18, 0x09, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61,
+	0x67, 0x67, 0x65, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x66, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x5f, 0x74,
+	0x61, 0x67, 0x73, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x66, 0x61, 0x69, 0x6c, 0x65,
+	0x64, 0x54, 0x61, 0x67, 0x73, 0x22, 0x55, 0x0a, 0x10, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73,
+	0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x63,
+	0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x73, 0x75, 0x63, 0x63,
+	0x65, 0x73, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x5f,
+	0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x73, 0x65,
+	0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x22, 0x8c, 0x01, 0x0a,
+	0x11, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x6a, 0x77, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x6a, 0x6f, 0x62, 0x4a, 0x77, 0x74, 0x12, 0x27, 0x0a, 0x0f, 0x73,
+	0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x4e, 0x75,
+	0x6d, 0x62, 0x65, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x6c, 0x6f, 0x67, 0x5f, 0x6d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6c, 0x6f, 0x67, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x68, 0x61, 0x73, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x70, 0x68, 0x61, 0x73, 0x65, 0x22, 0x57, 0x0a, 0x12, 0x4c,
+	0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x07, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x73,
+	0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x4e, 0x75,
+	0x6d, 0x62, 0x65, 0x72, 0x22, 0x9d, 0x01, 0x0a, 0x10, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54,
+	0x61, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62,
+	0x5f, 0x6a, 0x77, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6a, 0x6f, 0x62, 0x4a,
+	0x77, 0x74, 0x12, 0x26, 0x0a, 0x0f, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65,
+	0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x62, 0x61, 0x73,
+	0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x24, 0x0a, 0x0e, 0x62, 0x61,
+	0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x74, 0x61, 0x67, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0c, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x54, 0x61, 0x67,
+	0x12, 0x22, 0x0a, 0x0d, 0x62, 0x61, 0x73, 0x65, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x5f, 0x69,
+	0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x62, 0x61, 0x73, 0x65, 0x49, 0x6d, 0x61,
+	0x67, 0x65, 0x49, 0x64, 0x22, 0x29, 0x0a, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54, 0x61,
+	0x67, 0x12, 0x1c, 0x0a, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x2a,
+	0x64, 0x0a, 0x05, 0x50, 0x68, 0x61, 0x73, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x57, 0x41, 0x49, 0x54,
+	0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x55, 0x4e, 0x50, 0x41, 0x43, 0x4b, 0x49,
+	0x4e, 0x47, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x50, 0x55, 0x4c, 0x4c, 0x49, 0x4e, 0x47, 0x10,
+	0x02, 0x12, 0x0c, 0x0a, 0x08, 0x42, 0x55, 0x49, 0x4c, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x03, 0x12,
+	0x0b, 0x0a, 0x07, 0x50, 0x55, 0x53, 0x48, 0x49, 0x4e, 0x47, 0x10, 0x04, 0x12, 0x0c, 0x0a, 0x08,
+	0x43, 0x4f, 0x4d, 0x50, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x05, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x52,
+	0x52, 0x4f, 0x52, 0x10, 0x06, 0x32, 0xd4, 0x03, 0x0a, 0x0c, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x4d,
+	0x61, 0x6e, 0x61, 0x67, 0x65, 0x72, 0x12, 0x3a, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x18,
+	0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x50, 0x69, 0x6e,
+	0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64,
+	0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x22, 0x00, 0x12, 0x47, 0x0a, 0x10, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x42, 0x75,
+	0x69, 0x6c, 0x64, 0x4a, 0x6f, 0x62, 0x12, 0x19, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61,
+	0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x4a, 0x6f, 0x62, 0x41, 0x72, 0x67,
+	0x73, 0x1a, 0x16, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e,
+	0x42, 0x75, 0x69, 0x6c, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x22, 0x00, 0x12, 0x50, 0x0a, 0x09, 0x48,
+	0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x12, 0x1d, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64,
+	0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d,
+	0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12, 0x49, 0x0a,
+	0x08, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73, 0x65, 0x12, 0x1c, 0x2e, 0x62, 0x75, 0x69, 0x6c,
+	0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d,
+	0x61, 0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x53, 0x65, 0x74, 0x50, 0x68, 0x61, 0x73, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x53, 0x0a, 0x0a, 0x4c, 0x6f, 0x67, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61,
+	0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61,
+	0x6e, 0x5f, 0x70, 0x62, 0x2e, 0x4c, 0x6f, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12, 0x4d, 0x0a,
+	0x12, 0x44, 0x65, 0x74, 0x65, 0x72, 0x6d, 0x69, 0x6e, 0x65, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64,
+	0x54, 0x61, 0x67, 0x12, 0x1d, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70,
+	0x62, 0x2e, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x16, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62,
+	0x2e, 0x43, 0x61, 0x63, 0x68, 0x65, 0x64, 0x54, 0x61, 0x67, 0x22, 0x00, 0x42, 0x2a, 0x5a, 0x28,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x71, 0x75, 0x61, 0x79, 0x2f,
+	0x71, 0x75, 0x61, 0x79, 0x2d, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x65, 0x72, 0x2f, 0x62, 0x75, 0x69,
+	0x6c, 0x64, 0x6d, 0x61, 0x6e, 0x5f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -1191,47 +1735,57 @@ func file_buildman_proto_rawDescGZIP() []byte {
 }
 
 var file_buildman_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_buildman_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_buildman_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
 var file_buildman_proto_goTypes = []interface{}{
-	(Phase)(0),                           // 0: buildman_pb.Phase
-	(*PingRequest)(nil),                  // 1: buildman_pb.PingRequest
-	(*PingReply)(nil),                    // 2: buildman_pb.PingReply
-	(*BuildJobArgs)(nil),                 // 3: buildman_pb.BuildJobArgs
-	(*BuildPack)(nil),                    // 4: buildman_pb.BuildPack
-	(*HeartbeatRequest)(nil),             // 5: buildman_pb.HeartbeatRequest
-	(*HeartbeatResponse)(nil),            // 6: buildman_pb.HeartbeatResponse
-	(*SetPhaseRequest)(nil),              // 7: buildman_pb.SetPhaseRequest
-	(*SetPhaseResponse)(nil),             // 8: buildman_pb.SetPhaseResponse
-	(*LogMessageRequest)(nil),            // 9: buildman_pb.LogMessageRequest
-	(*LogMessageResponse)(nil),           // 10: buildman_pb.LogMessageResponse
-	(*CachedTagRequest)(nil),             // 11: buildman_pb.CachedTagRequest
-	(*CachedTag)(nil),                    // 12: buildman_pb.CachedTag
-	(*BuildPack_BaseImage)(nil),          // 13: buildman_pb.BuildPack.BaseImage
-	(*BuildPack_GitPackage)(nil),         // 14: buildman_pb.BuildPack.GitPackage
-	(*SetPhaseRequest_PullMetadata)(nil), // 15: buildman_pb.SetPhaseRequest.PullMetadata
+	(Phase)(0),                            // 0: buildman_pb.Phase
+	(*PingRequest)(nil),                   // 1: buildman_pb.PingRequest
+	(*PingReply)(nil),                     // 2: buildman_pb.PingReply
+	(*BuildJobArgs)(nil),                  // 3: buildman_pb.BuildJobArgs
+	(*BuildPack)(nil),                     // 4: buildman_pb.BuildPack
+	(*HeartbeatRequest)(nil),              // 5: buildman_pb.HeartbeatRequest
+	(*HeartbeatResponse)(nil),             // 6: buildman_pb.HeartbeatResponse
+	(*SetPhaseRequest)(nil),               // 7: buildman_pb.SetPhaseRequest
+	(*SetPhaseResponse)(nil),              // 8: buildman_pb.SetPhaseResponse
+	(*LogMessageRequest)(nil),             // 9: buildman_pb.LogMessageRequest
+	(*LogMessageResponse)(nil),            // 10: buildman_pb.LogMessageResponse
+	(*CachedTagRequest)(nil),              // 11: buildman_pb.CachedTagRequest
+	(*CachedTag)(nil),                     // 12: buildman_pb.CachedTag
+	nil,                                   // 13: buildman_pb.BuildPack.RegistryAuthsEntry
+	(*BuildPack_BaseImage)(nil),           // 14: buildman_pb.BuildPack.BaseImage
+	(*BuildPack_SigningKey)(nil),          // 15: buildman_pb.BuildPack.SigningKey
+	(*BuildPack_RegistryCredentials)(nil), // 16: buildman_pb.BuildPack.RegistryCredentials
+	(*BuildPack_BaseImagePolicy)(nil),     // 17: buildman_pb.BuildPack.BaseImagePolicy
+	(*BuildPack_GitPackage)(nil),          // 18: buildman_pb.BuildPack.GitPackage
+	(*SetPhaseRequest_PullMetadata)(nil),  // 19: buildman_pb.SetPhaseRequest.PullMetadata
+	(*SetPhaseRequest_BuildMetadata)(nil), // 20: buildman_pb.SetPhaseRequest.BuildMetadata
 }
 var file_buildman_proto_depIdxs = []int32{
-	14, // 0: buildman_pb.BuildPack.git_package:type_name -> buildman_pb.BuildPack.GitPackage
-	13, // 1: buildman_pb.BuildPack.base_image:type_name -> buildman_pb.BuildPack.BaseImage
-	0,  // 2: buildman_pb.SetPhaseRequest.phase:type_name -> buildman_pb.Phase
-	15, // 3: buildman_pb.SetPhaseRequest.pull_metadata:type_name -> buildman_pb.SetPhaseRequest.PullMetadata
-	1,  // 4: buildman_pb.BuildManager.Ping:input_type -> buildman_pb.PingRequest
-	3,  // 5: buildman_pb.BuildManager.RegisterBuildJob:input_type -> buildman_pb.BuildJobArgs
-	5,  // 6: buildman_pb.BuildManager.Heartbeat:input_type -> buildman_pb.HeartbeatRequest
-	7,  // 7: buildman_pb.BuildManager.SetPhase:input_type -> buildman_pb.SetPhaseRequest
-	9,  // 8: buildman_pb.BuildManager.LogMessage:input_type -> buildman_pb.LogMessageRequest
-	11, // 9: buildman_pb.BuildManager.DetermineCachedTag:input_type -> buildman_pb.CachedTagRequest
-	2,  // 10: buildman_pb.BuildManager.Ping:output_type -> buildman_pb.PingReply
-	4,  // 11: buildman_pb.BuildManager.RegisterBuildJob:output_type -> buildman_pb.BuildPack
-	6,  // 12: buildman_pb.BuildManager.Heartbeat:output_type -> buildman_pb.HeartbeatResponse
-	8,  // 13: buildman_pb.BuildManager.SetPhase:output_type -> buildman_pb.SetPhaseResponse
-	10, // 14: buildman_pb.BuildManager.LogMessage:output_type -> buildman_pb.LogMessageResponse
-	12, // 15: buildman_pb.BuildManager.DetermineCachedTag:output_type -> buildman_pb.CachedTag
-	10, // [10:16] is the sub-list for method output_type
-	4,  // [4:10] is the sub-list for method input_type
-	4,  // [4:4] is the sub-list for extension type_name
-	4,  // [4:4] is the sub-list for extension extendee
-	0,  // [0:4] is the sub-list for field type_name
+	18, // 0: buildman_pb.BuildPack.git_package:type_name -> buildman_pb.BuildPack.GitPackage
+	14, // 1: buildman_pb.BuildPack.base_image:type_name -> buildman_pb.BuildPack.BaseImage
+	17, // 2: buildman_pb.BuildPack.base_image_policy:type_name -> buildman_pb.BuildPack.BaseImagePolicy
+	13, // 3: buildman_pb.BuildPack.registry_auths:type_name -> buildman_pb.BuildPack.RegistryAuthsEntry
+	15, // 4: buildman_pb.BuildPack.signing_key:type_name -> buildman_pb.BuildPack.SigningKey
+	0,  // 5: buildman_pb.SetPhaseRequest.phase:type_name -> buildman_pb.Phase
+	19, // 6: buildman_pb.SetPhaseRequest.pull_metadata:type_name -> buildman_pb.SetPhaseRequest.PullMetadata
+	20, // 7: buildman_pb.SetPhaseRequest.build_metadata:type_name -> buildman_pb.SetPhaseRequest.BuildMetadata
+	16, // 8: buildman_pb.BuildPack.RegistryAuthsEntry.value:type_name -> buildman_pb.BuildPack.RegistryCredentials
+	1,  // 9: buildman_pb.BuildManager.Ping:input_type -> buildman_pb.PingRequest
+	3,  // 10: buildman_pb.BuildManager.RegisterBuildJob:input_type -> buildman_pb.BuildJobArgs
+	5,  // 11: buildman_pb.BuildManager.Heartbeat:input_type -> buildman_pb.HeartbeatRequest
+	7,  // 12: buildman_pb.BuildManager.SetPhase:input_type -> buildman_pb.SetPhaseRequest
+	9,  // 13: buildman_pb.BuildManager.LogMessage:input_type -> buildman_pb.LogMessageRequest
+	11, // 14: buildman_pb.BuildManager.DetermineCachedTag:input_type -> buildman_pb.CachedTagRequest
+	2,  // 15: buildman_pb.BuildManager.Ping:output_type -> buildman_pb.PingReply
+	4,  // 16: buildman_pb.BuildManager.RegisterBuildJob:output_type -> buildman_pb.BuildPack
+	6,  // 17: buildman_pb.BuildManager.Heartbeat:output_type -> buildman_pb.HeartbeatResponse
+	8,  // 18: buildman_pb.BuildManager.SetPhase:output_type -> buildman_pb.SetPhaseResponse
+	10, // 19: buildman_pb.BuildManager.LogMessage:output_type -> buildman_pb.LogMessageResponse
+	12, // 20: buildman_pb.BuildManager.DetermineCachedTag:output_type -> buildman_pb.CachedTag
+	15, // [15:21] is the sub-list for method output_type
+	9,  // [9:15] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_buildman_proto_init() }
@@ -1384,7 +1938,7 @@ func file_buildman_proto_init() {
 				return nil
 			}
 		}
-		file_buildman_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+		file_buildman_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*BuildPack_BaseImage); i {
 			case 0:
 				return &v.state
@@ -1396,7 +1950,43 @@ func file_buildman_proto_init() {
 				return nil
 			}
 		}
-		file_buildman_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+		file_buildman_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BuildPack_SigningKey); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_buildman_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BuildPack_RegistryCredentials); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_buildman_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BuildPack_BaseImagePolicy); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_buildman_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*BuildPack_GitPackage); i {
 			case 0:
 				return &v.state
@@ -1408,7 +1998,7 @@ func file_buildman_proto_init() {
 				return nil
 			}
 		}
-		file_buildman_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+		file_buildman_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*SetPhaseRequest_PullMetadata); i {
 			case 0:
 				return &v.state
@@ -1420,6 +2010,18 @@ func file_buildman_proto_init() {
 				return nil
 			}
 		}
+		file_buildman_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetPhaseRequest_BuildMetadata); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	file_buildman_proto_msgTypes[3].OneofWrappers = []interface{}{
 		(*BuildPack_PackageUrl)(nil),
@@ -1431,7 +2033,7 @@ func file_buildman_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_buildman_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   15,
+			NumMessages:   20,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -8,13 +8,16 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"code.cloudfoundry.org/archiver/extractor"
+	digest "github.com/opencontainers/go-digest"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/quay/quay-builder/rpc"
@@ -22,85 +25,187 @@ import (
 
 const (
 	quayDocsSubmoduleURL = "http://docs.quay.io/guides/git-submodules.html"
-	processIdleTimeout   = time.Minute * 3
-	processTimeout       = time.Minute * 15
+
+	// processIdleTimeout and processTimeout are the default git timeouts,
+	// used unless they are overridden by the environment or the build args.
+	processIdleTimeout = time.Minute * 3
+	processTimeout     = time.Minute * 15
+
+	// killWaitDelay is how long to wait for the output of a command to be
+	// closed after it exits or is killed.
+	killWaitDelay = time.Second * 10
+
+	// progressInterval is the minimum time between progress updates (lines
+	// that git ends with a carriage return) written to the build logs.
+	progressInterval = time.Second
 )
 
 // Download downloads the build package found at the given URL, returning the
 // path to a temporary directory on the file system with those contents,
-// extracted if necessary.
-func Download(args *rpc.BuildArgs) (string, error) {
-	var buildPackDir string
+// extracted if necessary. If the build package was cloned from git, the SHA
+// of the commit that was checked out is also returned, and the progress of the
+// git commands is written line by line to progress.
+func Download(args *rpc.BuildArgs, progress io.Writer) (string, string, error) {
+	var buildPackDir, commitSHA string
 
 	switch {
 	// Clone the git repository.
 	case args.Git != nil:
-		log.Infof("cloning buildpack: %s at %s", args.Git.SHA, args.Git.URL)
-		repoDir, err := Clone(args.Git.URL, args.Git.SHA, args.Git.PrivateKey)
+		gitRef := args.Git.SHA
+		if gitRef == "" {
+			gitRef = args.Git.Ref
+		}
+		log.Infof("cloning buildpack: %s at %s", gitRef, args.Git.URL)
+		repoDir, sha, err := Clone(args.Git, progress)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 		buildPackDir = repoDir
+		commitSHA = sha
 
 	// Download the buildpack.
 	case args.BuildPackage != "":
 		log.Infof("downloading buildpack: %s", args.BuildPackage)
-		bpDir, err := download(args.BuildPackage)
+		bpDir, err := download(args)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 		buildPackDir = bpDir
 
 	// This should never happen!
 	default:
 		log.Errorf("insufficient buildpack args: %#v", args)
-		return "", rpc.BuildPackError{Err: "insufficient buildpack args"}
+		return "", "", rpc.BuildPackError{Err: "insufficient buildpack args"}
 	}
 
-	return filepath.Join(buildPackDir, args.Context), nil
+	return filepath.Join(buildPackDir, args.Context), commitSHA, nil
 }
 
-// download downloads (and potentially extracts) non-git buildpacks.
-func download(url string) (string, error) {
-	// Load the build package from the URL.
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", rpc.BuildPackError{Err: err.Error()}
-	}
-	defer resp.Body.Close()
-
-	// Find the MIME type of the build package and use it to untar/unzip.
-	mimetype := resp.Header.Get("Content-Type")
-
-	r := resp.Body
-	if mimetype == "" {
-		br := bufio.NewReaderSize(resp.Body, 4096)
-		r = struct {
-			*bufio.Reader
-			io.Closer
-		}{
-			Reader: br,
-			Closer: resp.Body,
+// download downloads (and potentially extracts) non-git buildpacks. If an
+// expected digest is provided, the downloaded build package must match it. A
+// build package that changes while it is being downloaded is downloaded again
+// once.
+func download(args *rpc.BuildArgs) (string, error) {
+	dir, changed, err := downloadOnce(args)
+	if changed {
+		log.Warningf("build package changed during download, downloading it again")
+		dir, _, err = downloadOnce(args)
+	}
+	return dir, err
+}
+
+// downloadOnce downloads and extracts the build package, also reporting
+// whether it failed because the build package changed during the download.
+func downloadOnce(args *rpc.BuildArgs) (string, bool, error) {
+	var verifier digest.Verifier
+	if args.BuildPackageDigest != "" {
+		d, err := digest.Parse(args.BuildPackageDigest)
+		if err != nil {
+			return "", false, rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package digest %q: %s", args.BuildPackageDigest, err)}
 		}
-		const detectContentLen = 512
-		b, _ := br.Peek(detectContentLen)
-		mimetype = http.DetectContentType(b)
+		verifier = d.Verifier()
 	}
 
-	// Remove any extra data found on the mimetype (i.e. charset).
-	mimetype = strings.Split(mimetype, ";")[0]
+	// Load the build package from wherever its URL points to.
+	body, size, err := openBuildPackage(args)
+	if err != nil {
+		return "", false, err
+	}
+	defer body.Close()
+	changed := func() bool {
+		rb, ok := body.(*resumableBody)
+		return ok && rb.changed
+	}
+
+	// Don't bother downloading a build package that is known to be too large.
+	if size > defaultExtractLimits.maxArchiveSize {
+		return "", false, archiveError("", reasonDownloadTooBig)
+	}
+
+	var r io.Reader = &sizeLimitedReader{r: body, remaining: defaultExtractLimits.maxArchiveSize}
+	if verifier != nil {
+		r = io.TeeReader(r, verifier)
+	}
 
 	// Extract the build package into a temp folder.
-	return extractBuildPackage(r, mimetype)
+	dir, err := extractBuildPackage(r)
+	if err != nil {
+		return "", changed(), err
+	}
+
+	if verifier != nil {
+		// Anything the extractor didn't need to read (such as padding at the end
+		// of an archive) still needs to be included in the digest.
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			os.RemoveAll(dir)
+			return "", changed(), buildPackError(err)
+		}
+
+		if !verifier.Verified() {
+			os.RemoveAll(dir)
+			return "", false, rpc.BuildPackError{Err: fmt.Sprintf("Build package does not match digest %s", args.BuildPackageDigest)}
+		}
+		log.Infof("verified buildpack digest: %s", args.BuildPackageDigest)
+	}
+
+	return dir, false, nil
+}
+
+// openBuildPackage starts downloading the build package, choosing where from
+// based on the scheme of its URL:
+//
+//	http://, https:// - a plain download, resumed if it is interrupted
+//	s3://bucket/key   - an object in S3-compatible storage, signed with the
+//	                    AWS credentials found in the environment
+//	oci://reference   - the single layer of an OCI artifact in a registry
+//
+// It also returns the size of the build package, or -1 if it is unknown.
+func openBuildPackage(args *rpc.BuildArgs) (io.ReadCloser, int64, error) {
+	u, err := url.Parse(args.BuildPackage)
+	if err != nil {
+		return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package URL: %s", err)}
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		body, err := openResumable(args.BuildPackage, nil)
+		if err != nil {
+			return nil, 0, rpc.BuildPackError{Err: err.Error()}
+		}
+
+		// The format of the build package is identified from its contents, as
+		// the Content-Type cannot be relied upon.
+		log.Infof("buildpack served with Content-Type: %s", body.resp.Header.Get("Content-Type"))
+		return body, body.contentLength, nil
+
+	case "s3":
+		creds := s3CredentialsFromEnv()
+		objectURL, err := s3ObjectURL(u, creds.region)
+		if err != nil {
+			return nil, 0, rpc.BuildPackError{Err: err.Error()}
+		}
+
+		body, err := openResumable(objectURL, func(req *http.Request) { creds.sign(req, time.Now()) })
+		if err != nil {
+			return nil, 0, rpc.BuildPackError{Err: err.Error()}
+		}
+		return body, body.contentLength, nil
+
+	case "oci":
+		return openOCIArtifact(strings.TrimPrefix(args.BuildPackage, "oci://"), args)
+	}
+
+	return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Unsupported build package URL scheme %q", u.Scheme)}
 }
 
 // extractToTempDir extracts a body into a temporary directory and returns the path.
-func extractToTempDir(body io.Reader, xtractor extractor.Extractor) (string, error) {
-	// Create a temporary file.
+func extractToTempDir(body io.Reader, extract func(archivePath, dir string) error) (string, error) {
+	// Create a temporary file, which is removed once it has been extracted.
 	archiveFile, err := ioutil.TempFile("", "build_archive")
 	if err != nil {
 		return "", err
 	}
+	defer os.Remove(archiveFile.Name())
 	defer archiveFile.Close()
 
 	// Copy the build archive to a temporary file (this forces the actual
@@ -116,9 +221,42 @@ func extractToTempDir(body io.Reader, xtractor extractor.Extractor) (string, err
 		return "", err
 	}
 
-	// Extract the contents of the archive into the temporary directory.
-	err = xtractor.Extract(archiveFile.Name(), tempDir)
+	// Extract the contents of the archive into the temporary directory,
+	// removing anything that was extracted if the archive is rejected.
+	err = extract(archiveFile.Name(), tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	return tempDir, nil
+}
+
+// extractZipFile extracts the zip archive at archivePath into dir.
+func extractZipFile(archivePath, dir string) error {
+	return extractZip(archivePath, dir, defaultExtractLimits)
+}
+
+// streamToTempDir extracts a tar-based body, compressed with the given format,
+// directly into a temporary directory and returns the path.
+func streamToTempDir(body io.Reader, format buildPackFormat) (string, error) {
+	r, err := decompress(format, body)
+	if err != nil {
+		return "", rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package: %s", err)}
+	}
+	defer r.Close()
+
+	// Create a temporary directory for the build pack.
+	tempDir, err := ioutil.TempDir("", "build_pack")
+	if err != nil {
+		return "", err
+	}
+
+	// Extract the contents of the archive into the temporary directory,
+	// removing anything that was extracted if the archive is rejected.
+	err = extractTar(r, tempDir, defaultExtractLimits)
 	if err != nil {
+		os.RemoveAll(tempDir)
 		return "", err
 	}
 
@@ -157,42 +295,66 @@ func dockerfileTempDir(dockerfile io.Reader) (string, error) {
 }
 
 // extractBuildPackage extracts body into a temporary directory and returns the path.
-func extractBuildPackage(body io.Reader, mimetype string) (string, error) {
-	switch mimetype {
-	case "application/zip", "application/x-zip-compressed":
+func extractBuildPackage(body io.Reader) (string, error) {
+	// Identify the format of the build package from its leading bytes.
+	br := bufio.NewReaderSize(body, sniffLen)
+	header, _ := br.Peek(sniffLen)
+	format := sniffFormat(header)
+
+	switch format {
+	case formatZip:
 		log.Info("buildpack identified as zip")
-		dir, err := extractToTempDir(body, extractor.NewZip())
+		dir, err := extractToTempDir(br, extractZipFile)
 		if err != nil {
-			return "", rpc.BuildPackError{Err: err.Error()}
+			return "", buildPackError(err)
 		}
 		return dir, nil
 
-	case "application/x-tar", "application/gzip", "application/x-gzip":
-		log.Info("buildpack identified as tar")
-		dir, err := extractToTempDir(body, extractor.NewTgz())
+	case formatTar, formatGzip, formatBzip2, formatXz, formatZstd:
+		log.Infof("buildpack identified as %s", format)
+		dir, err := streamToTempDir(br, format)
 		if err != nil {
-			return "", rpc.BuildPackError{Err: err.Error()}
+			return "", buildPackError(err)
 		}
 		return dir, nil
 
-	case "text/plain", "application/octet-stream":
+	case formatPlain:
 		log.Info("buildpack identified as plain")
-		dir, err := dockerfileTempDir(body)
+		dir, err := dockerfileTempDir(br)
 		if err != nil {
-			return "", rpc.BuildPackError{Err: err.Error()}
+			return "", buildPackError(err)
 		}
 		return dir, nil
 	}
 
-	return "", rpc.InvalidDockerfileError{Err: "Unsupported kind of build package: " + mimetype}
+	return "", rpc.InvalidDockerfileError{Err: "Unsupported kind of build package: " + http.DetectContentType(header)}
+}
+
+// buildPackError wraps err in a rpc.BuildPackError, unless it already is one.
+func buildPackError(err error) error {
+	if _, ok := err.(rpc.BuildPackError); ok {
+		return err
+	}
+	return rpc.BuildPackError{Err: err.Error()}
 }
 
-// Clone creates a temporary directory and `git clone`s a repository into it.
-func Clone(url, sha, privateKey string) (string, error) {
+// Clone creates a temporary directory and `git clone`s a repository into it,
+// returning the path and the SHA of the commit that was checked out. If no SHA
+// is provided, the branch or tag named by the ref is resolved instead. If the
+// args list any trusted signing keys, the checked out commit must be signed by
+// one of them. The output of each git command is written line by line to
+// progress as it runs.
+func Clone(args *rpc.BuildArgsGit, progress io.Writer) (string, string, error) {
+	url, sha := args.URL, args.SHA
+	if sha == "" && args.Ref == "" {
+		return "", "", rpc.BuildPackError{Err: "insufficient git args: missing sha or ref"}
+	}
+	idleTimeout, timeout := gitTimeouts(args)
+
 	// Create a temp file for the ssh key.
 	keyFile, err := ioutil.TempFile("", "ssh_key")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	keyPath := keyFile.Name()
@@ -205,19 +367,19 @@ func Clone(url, sha, privateKey string) (string, error) {
 	// Give the file the proper permissions.
 	err = keyFile.Chmod(0600)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// Write the key to the file.
-	_, err = io.WriteString(keyFile, privateKey)
+	_, err = io.WriteString(keyFile, args.PrivateKey)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// Create a temp directory to clone the buildpack into.
 	bpPath, err := ioutil.TempDir("", "build_pack")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// In order to specify ssh keys per clone, we use option 1 of
@@ -225,20 +387,20 @@ func Clone(url, sha, privateKey string) (string, error) {
 	// We assume that ssh-git.sh is located at the root of the filesystem.
 	err = os.Setenv("GIT_SSH", "/ssh-git.sh")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	err = os.Setenv("PKEY", keyPath)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// Clone into the temp directory by shelling out to git.
-	output, err := timeoutActiveCommand("git", "clone", "--progress", url, bpPath)
+	output, err := cloneRepository(url, bpPath, idleTimeout, progress)
 	if err != nil {
 		if err == ErrKilledInactiveProcess {
-			return "", rpc.GitCloneError{Err: fmt.Sprintf("Timed out while trying to cloning git repository\n%s", output)}
+			return "", "", rpc.GitCloneError{Err: fmt.Sprintf("Timed out while trying to cloning git repository\n%s", output)}
 		}
-		return "", rpc.GitCloneError{Err: fmt.Sprintf("Error cloning git repository (%s)\n%s", err, output)}
+		return "", "", rpc.GitCloneError{Err: fmt.Sprintf("Error cloning git repository (%s)\n%s", err, output)}
 	}
 	log.Infof("git clone output: %s", output)
 
@@ -261,90 +423,309 @@ func Clone(url, sha, privateKey string) (string, error) {
 		}
 	}()
 
+	// Resolve the branch or tag to build to the commit it points to.
+	if sha == "" {
+		sha, err = resolveRef(bpPath, args.Ref)
+		if err != nil {
+			return "", "", err
+		}
+		log.Infof("resolved git ref %s to %s", args.Ref, sha)
+	}
+
 	// Checkout the specific SHA for the build.
-	output, err = timeoutActiveCommand("git", "checkout", sha)
+	output, err = timeoutActiveCommand(idleTimeout, progress, "git", "checkout", "--progress", sha)
 	if err != nil {
 		if err == ErrKilledInactiveProcess {
-			return "", rpc.GitCloneError{Err: fmt.Sprintf("Timed out while trying to checkout SHA %s in git repository\n%s", sha, output)}
+			return "", "", rpc.GitCloneError{Err: fmt.Sprintf("Timed out while trying to checkout SHA %s in git repository\n%s", sha, output)}
 		}
-		return "", rpc.GitCheckoutError{Err: fmt.Sprintf("Error checking out git commit (%s)\n%s", err, output)}
+		return "", "", rpc.GitCheckoutError{Err: fmt.Sprintf("Error checking out git commit (%s)\n%s", err, output)}
 	}
 	log.Infof("git checkout output: %s", output)
 
+	// Verify the commit is signed by a trusted key before building anything
+	// from it.
+	if err := verifyCommitSignature(bpPath, sha, args.TrustedSigningKeys); err != nil {
+		return "", "", err
+	}
+
 	// Initialize any submodules. This will still have an exit code of 0 if there
 	// are no submodules.
-	output, err = timeoutCommand("git", "submodule", "update", "--init", "--recursive")
+	output, err = timeoutCommand(timeout, progress, "git", "submodule", "update", "--init", "--recursive", "--progress")
 	if err != nil {
 		if err == ErrKilledInactiveProcess {
-			return "", rpc.GitCloneError{Err: fmt.Sprintf("Timed out while trying to update submodules in git repository\n%s", output)}
+			return "", "", rpc.GitCloneError{Err: fmt.Sprintf("Timed out while trying to update submodules in git repository\n%s", output)}
 		}
-		return "", rpc.GitCheckoutError{Err: fmt.Sprintf("Error initializing git submodules (%s): See submodule documentation at %s\n%s", err, quayDocsSubmoduleURL, output)}
+		return "", "", rpc.GitCheckoutError{Err: fmt.Sprintf("Error initializing git submodules (%s): See submodule documentation at %s\n%s", err, quayDocsSubmoduleURL, output)}
 	}
 	log.Infof("git submodule output: %s", output)
 
-	return bpPath, nil
+	return bpPath, sha, nil
+}
+
+// CommitTime returns the committer timestamp of the commit identified by sha in
+// the repository containing dir.
+func CommitTime(dir, sha string) (time.Time, error) {
+	output, err := exec.Command("git", "-C", dir, "show", "-s", "--format=%ct", sha).Output()
+	if err != nil {
+		return time.Time{}, rpc.GitCheckoutError{Err: fmt.Sprintf("Error reading time of git commit %s (%s)", sha, err)}
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return time.Time{}, rpc.GitCheckoutError{Err: fmt.Sprintf("Invalid time of git commit %s: %q", sha, output)}
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// cloneRepository clones the repository at url into dir. If a mirror cache is
+// configured, the objects are copied from an up to date mirror so that only
+// what is new has to be fetched from the remote.
+func cloneRepository(url, dir string, idleTimeout time.Duration, progress io.Writer) ([]byte, error) {
+	cache := mirrorCacheFromEnv()
+	if cache == nil {
+		return timeoutActiveCommand(idleTimeout, progress, "git", "clone", "--progress", url, dir)
+	}
+
+	mirror, output, err := cache.prepare(url, idleTimeout, progress)
+	if err != nil {
+		return output, err
+	}
+	if mirror == nil {
+		return timeoutActiveCommand(idleTimeout, progress, "git", "clone", "--progress", url, dir)
+	}
+	defer cache.evict()
+	defer mirror.release()
+
+	// Dissociate from the mirror once the clone is done, so the clone doesn't
+	// break if the mirror is evicted.
+	output, err = timeoutActiveCommand(idleTimeout, progress,
+		"git", "clone", "--progress", "--reference", mirror.path, "--dissociate", url, dir)
+	if err == nil || err == ErrKilledInactiveProcess {
+		return output, err
+	}
+
+	// The remote was just fetched into the mirror, so the mirror itself is the
+	// most likely problem. Throw it away and clone from scratch.
+	log.Warningf("failed to clone using git mirror %s, cloning without it (%s)\n%s", mirror.path, err, output)
+	mirror.discard()
+	if err := emptyDir(dir); err != nil {
+		return output, err
+	}
+	return timeoutActiveCommand(idleTimeout, progress, "git", "clone", "--progress", url, dir)
+}
+
+// emptyDir removes everything inside dir.
+func emptyDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitTimeouts returns the idle and overall timeouts for git commands. Timeouts
+// given in the build args take precedence over the GIT_IDLE_TIMEOUT and
+// GIT_TIMEOUT environment variables, which take precedence over the defaults.
+func gitTimeouts(args *rpc.BuildArgsGit) (time.Duration, time.Duration) {
+	idleTimeout := durationFromEnv("GIT_IDLE_TIMEOUT", processIdleTimeout)
+	if args.IdleTimeout > 0 {
+		idleTimeout = args.IdleTimeout
+	}
+
+	timeout := durationFromEnv("GIT_TIMEOUT", processTimeout)
+	if args.Timeout > 0 {
+		timeout = args.Timeout
+	}
+
+	return idleTimeout, timeout
+}
+
+// durationFromEnv parses the duration (e.g. "10m") in the environment variable
+// key, returning def if it is unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Warningf("ignoring invalid %s %q, using %v", key, value, def)
+		return def
+	}
+
+	return d
+}
+
+// resolveRef finds the commit that a branch or tag points to on the remote
+// that the repository at repoDir was cloned from. Branches take precedence
+// over tags with the same name.
+func resolveRef(repoDir, ref string) (string, error) {
+	var candidates []string
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		candidates = []string{"refs/remotes/origin/" + strings.TrimPrefix(ref, "refs/heads/")}
+	case strings.HasPrefix(ref, "refs/tags/"):
+		candidates = []string{ref}
+	default:
+		candidates = []string{"refs/remotes/origin/" + ref, "refs/tags/" + ref}
+	}
+
+	for _, candidate := range candidates {
+		output, err := exec.Command("git", "-C", repoDir, "rev-parse", "--verify", "--quiet", candidate+"^{commit}").Output()
+		if err == nil {
+			return strings.TrimSpace(string(output)), nil
+		}
+	}
+
+	return "", rpc.GitCheckoutError{Err: fmt.Sprintf("Could not find branch or tag %s in git repository", ref)}
 }
 
 type notifyingWriter struct {
 	notifyChan chan error
-	buf        *bytes.Buffer
+	w          io.Writer
 }
 
 func (w notifyingWriter) Write(p []byte) (n int, err error) {
-	n, err = w.buf.Write(p)
+	n, err = w.w.Write(p)
 	w.notifyChan <- err
 	return
 }
 
+// lineWriter splits the output of a command into lines, writing each one to w
+// as soon as it is complete. Progress updates, which git ends with a carriage
+// return rather than a newline, are only written every progressInterval.
+type lineWriter struct {
+	w            io.Writer
+	buf          []byte
+	lastProgress time.Time
+}
+
+func newLineWriter(w io.Writer) *lineWriter {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	return &lineWriter{w: w}
+}
+
+// Write implements the io.Writer interface for lineWriter. It never fails, so
+// that a problem publishing the logs doesn't kill the command.
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexAny(l.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		line, progress := l.buf[:i], l.buf[i] == '\r'
+		l.buf = l.buf[i+1:]
+
+		if progress {
+			if time.Since(l.lastProgress) < progressInterval {
+				continue
+			}
+			l.lastProgress = time.Now()
+		}
+		l.writeLine(line)
+	}
+
+	return len(p), nil
+}
+
+// Flush writes anything left over that didn't end with a newline.
+func (l *lineWriter) Flush() {
+	l.writeLine(l.buf)
+	l.buf = nil
+}
+
+func (l *lineWriter) writeLine(line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	if _, err := l.w.Write(append(line[:len(line):len(line)], '\n')); err != nil {
+		log.Warningf("failed to write command output to the build logs: %s", err)
+	}
+}
+
+// newKillableCommand creates a command that is run in its own process group, so
+// that any processes it starts (such as ssh for git) can be killed with it.
+func newKillableCommand(command ...string) *exec.Cmd {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Don't wait forever for output from anything that survived being killed.
+	cmd.WaitDelay = killWaitDelay
+	return cmd
+}
+
+// killProcessGroup kills a command started by newKillableCommand along with
+// everything it started.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
 // ErrKilledInactiveProcess is used to indicate that a subprocess was killed
 // due to a timeout.
 var ErrKilledInactiveProcess = errors.New("killed process due to inactivity")
 
 // timeoutCommand executes a command and kills the process if it doesn't exit
-// before processTimeout. It should only be used if the command doesn't write
+// before timeout. It should only be used if the command doesn't write
 // frequently enough to standard out, thus timeoutActiveCommand cannot be used.
-func timeoutCommand(command ...string) ([]byte, error) {
+// The output of the command is also written line by line to progress.
+func timeoutCommand(timeout time.Duration, progress io.Writer, command ...string) ([]byte, error) {
 	if len(command) <= 0 {
 		panic("buildpack: not enough arguments provided to timeoutCommand")
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := newKillableCommand(command...)
 
-	type execResponse struct {
-		data []byte
-		err  error
-	}
+	var output bytes.Buffer
+	lines := newLineWriter(progress)
+	defer lines.Flush()
+	w := io.MultiWriter(&output, lines)
+	cmd.Stdout = w
+	cmd.Stderr = w
 
-	done := make(chan *execResponse)
+	done := make(chan error)
 	go func() {
-		data, err := cmd.CombinedOutput()
-		done <- &execResponse{data, err}
+		done <- cmd.Run()
 	}()
 
 	select {
-	case resp := <-done:
-		return resp.data, resp.err
-	case <-time.Tick(processTimeout):
-		log.Warningf("command `%v` timed out after %v\n", command, processTimeout)
-		if err := cmd.Process.Kill(); err != nil {
+	case err := <-done:
+		return output.Bytes(), err
+	case <-time.After(timeout):
+		log.Warningf("command `%v` timed out after %v\n", command, timeout)
+		if err := killProcessGroup(cmd); err != nil {
 			log.Fatalf("failed to kill long-running process: %s", err)
 		}
-		return nil, ErrKilledInactiveProcess
+		<-done
+		return output.Bytes(), ErrKilledInactiveProcess
 	}
 }
 
 // timeoutActiveCommand executes a commmand and kills the process if it doesn't
-// output anything for more than the duration of processIdleTimeout.
+// output anything for more than the duration of idleTimeout. The output of the
+// command is also written line by line to progress.
 // This function panics if you don't provide at least one string for commands.
-func timeoutActiveCommand(command ...string) ([]byte, error) {
+func timeoutActiveCommand(idleTimeout time.Duration, progress io.Writer, command ...string) ([]byte, error) {
 	if len(command) <= 0 {
 		panic("buildpack: not enough arguments provided to timeoutActiveCommand")
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := newKillableCommand(command...)
+
+	var output bytes.Buffer
+	lines := newLineWriter(progress)
+	defer lines.Flush()
 
 	notifyChan := make(chan error, 1)
-	notifyWriter := notifyingWriter{notifyChan, new(bytes.Buffer)}
+	notifyWriter := notifyingWriter{notifyChan, io.MultiWriter(&output, lines)}
 
 	cmd.Stdout = &notifyWriter
 	cmd.Stderr = &notifyWriter
@@ -355,25 +736,33 @@ func timeoutActiveCommand(command ...string) ([]byte, error) {
 		doneChan <- err
 	}()
 
-	timeout := time.After(processIdleTimeout)
+	timeout := time.After(idleTimeout)
 	for {
 		select {
 		case err := <-notifyChan:
 			if err != nil {
-				return notifyWriter.buf.Bytes(), err
+				return output.Bytes(), err
 			}
 
-			timeout = time.After(processIdleTimeout)
+			timeout = time.After(idleTimeout)
 
 		case <-timeout:
-			log.Warningf("active command `%v` timed out after %v with output: %s\n", command, processTimeout, notifyWriter.buf.String())
-			if err := cmd.Process.Kill(); err != nil {
+			log.Warningf("active command `%v` timed out after %v with output: %s\n", command, idleTimeout, output.String())
+			if err := killProcessGroup(cmd); err != nil {
 				log.Fatalf("failed to kill hung process: %s", err)
 			}
-			return notifyWriter.buf.Bytes(), ErrKilledInactiveProcess
+
+			// Wait for the output to stop before returning it.
+			for {
+				select {
+				case <-notifyChan:
+				case <-doneChan:
+					return output.Bytes(), ErrKilledInactiveProcess
+				}
+			}
 
 		case err := <-doneChan:
-			return notifyWriter.buf.Bytes(), err
+			return output.Bytes(), err
 		}
 	}
 }
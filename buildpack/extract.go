@@ -0,0 +1,334 @@
+package buildpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+// Reasons that an archive is rejected during extraction.
+const (
+	reasonAbsolutePath   = "absolute paths are not allowed"
+	reasonPathTraversal  = "path escapes the build context"
+	reasonSymlinkEscape  = "symlink escapes the build context"
+	reasonDeviceFile     = "device files are not allowed"
+	reasonTooManyFiles   = "archive contains too many files"
+	reasonTooLarge       = "archive is too large when extracted"
+	reasonDownloadTooBig = "build package is too large to download"
+)
+
+// extractLimits bounds the resources a build package may consume while it is
+// downloaded and extracted.
+type extractLimits struct {
+	// maxArchiveSize is the largest build package that will be downloaded.
+	maxArchiveSize int64
+	// maxExtractedSize is the total size of all files in an archive.
+	maxExtractedSize int64
+	// maxFiles is the number of entries in an archive.
+	maxFiles int
+}
+
+var defaultExtractLimits = extractLimits{
+	maxArchiveSize:   1 << 30,
+	maxExtractedSize: 4 << 30,
+	maxFiles:         100000,
+}
+
+// archiveError builds the error returned when an archive is rejected.
+func archiveError(name, reason string) error {
+	if name == "" {
+		return rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package: %s", reason)}
+	}
+	return rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package entry %q: %s", name, reason)}
+}
+
+// archiveExtractor writes the entries of an archive into a directory, making
+// sure nothing is written outside of it and the limits are respected.
+type archiveExtractor struct {
+	root   string
+	limits extractLimits
+	files  int
+	size   int64
+}
+
+func newArchiveExtractor(dir string, limits extractLimits) (*archiveExtractor, error) {
+	// Resolve the root so that symlinks can be compared against it.
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveExtractor{root: root, limits: limits}, nil
+}
+
+// countEntry records that another entry is being extracted.
+func (x *archiveExtractor) countEntry() error {
+	x.files++
+	if x.files > x.limits.maxFiles {
+		return archiveError("", reasonTooManyFiles)
+	}
+	return nil
+}
+
+// entryPath validates the name of an archive entry and returns the path it
+// should be extracted to. Symlinks in the parent directories of the entry are
+// resolved within the root, but the entry itself is not.
+func (x *archiveExtractor) entryPath(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", archiveError(name, reasonAbsolutePath)
+	}
+
+	cleaned := filepath.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", archiveError(name, reasonPathTraversal)
+	}
+
+	parent, err := securejoin.SecureJoin(x.root, filepath.Dir(cleaned))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(parent, filepath.Base(cleaned)), nil
+}
+
+// removeExisting removes anything but a directory found at path, so that
+// entries repeated in an archive never write through a symlink.
+func removeExisting(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func (x *archiveExtractor) mkdir(name string) error {
+	path, err := x.entryPath(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+func (x *archiveExtractor) writeFile(name string, r io.Reader, mode os.FileMode) error {
+	path, err := x.entryPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := removeExisting(path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Never copy more than the remaining allowance, regardless of what the
+	// archive claims the size of the entry is.
+	remaining := x.limits.maxExtractedSize - x.size
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	x.size += n
+	if err != nil {
+		return err
+	}
+	if x.size > x.limits.maxExtractedSize {
+		return archiveError("", reasonTooLarge)
+	}
+
+	return nil
+}
+
+func (x *archiveExtractor) symlink(name, target string) error {
+	path, err := x.entryPath(name)
+	if err != nil {
+		return err
+	}
+
+	if filepath.IsAbs(target) {
+		return archiveError(name, reasonSymlinkEscape)
+	}
+	resolved := filepath.Clean(filepath.Join(filepath.Dir(filepath.Clean(name)), target))
+	if resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+		return archiveError(name, reasonSymlinkEscape)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := removeExisting(path); err != nil {
+		return err
+	}
+
+	return os.Symlink(target, path)
+}
+
+func (x *archiveExtractor) link(name, target string) error {
+	path, err := x.entryPath(name)
+	if err != nil {
+		return err
+	}
+
+	// The target of a hard link is another entry in the archive.
+	targetPath, err := x.entryPath(target)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := removeExisting(path); err != nil {
+		return err
+	}
+
+	return os.Link(targetPath, path)
+}
+
+// checkSymlinks walks the extracted files to make sure that no combination of
+// symlinks resolves to a location outside of the root.
+func (x *archiveExtractor) checkSymlinks() error {
+	return filepath.Walk(x.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			// Dangling symlinks cannot be used to read anything.
+			return nil
+		}
+
+		if resolved != x.root && !strings.HasPrefix(resolved, x.root+string(filepath.Separator)) {
+			name, _ := filepath.Rel(x.root, path)
+			return archiveError(name, reasonSymlinkEscape)
+		}
+		return nil
+	})
+}
+
+// extractTar extracts an uncompressed tar stream into dir.
+func extractTar(r io.Reader, dir string, limits extractLimits) error {
+	x, err := newArchiveExtractor(dir, limits)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package: %s", err)}
+		}
+
+		if err := x.countEntry(); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(hdr.Name)
+		case tar.TypeReg:
+			err = x.writeFile(hdr.Name, tr, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = x.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			err = x.link(hdr.Name, hdr.Linkname)
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			err = archiveError(hdr.Name, reasonDeviceFile)
+		default:
+			log.Warningf("skipping unsupported entry %s in build package (type %c)", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return x.checkSymlinks()
+}
+
+// extractZip extracts the zip archive at archivePath into dir.
+func extractZip(archivePath, dir string, limits extractLimits) error {
+	x, err := newArchiveExtractor(dir, limits)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package: %s", err)}
+	}
+	defer zr.Close()
+
+	// Reject archives that are too large before extracting anything.
+	var declaredSize uint64
+	for _, f := range zr.File {
+		if err := x.countEntry(); err != nil {
+			return err
+		}
+
+		declaredSize += f.UncompressedSize64
+		if declaredSize > uint64(limits.maxExtractedSize) {
+			return archiveError("", reasonTooLarge)
+		}
+	}
+
+	for _, f := range zr.File {
+		if err := x.extractZipFile(f); err != nil {
+			return err
+		}
+	}
+
+	return x.checkSymlinks()
+}
+
+func (x *archiveExtractor) extractZipFile(f *zip.File) error {
+	mode := f.Mode()
+	switch {
+	case mode.IsDir():
+		return x.mkdir(f.Name)
+	case mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket) != 0:
+		return archiveError(f.Name, reasonDeviceFile)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package entry %q: %s", f.Name, err)}
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		return x.symlink(f.Name, string(target))
+	}
+
+	return x.writeFile(f.Name, rc, mode)
+}
@@ -0,0 +1,279 @@
+package buildpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// downloadAttempts is the number of times a build package download is
+	// attempted (or resumed) before giving up.
+	downloadAttempts = 5
+
+	// downloadRetryDelay is multiplied by the attempt number to find how long
+	// to wait before retrying a failed download.
+	downloadRetryDelay = time.Second
+
+	// downloadIdleTimeout is how long a download may go without receiving any
+	// data before it is aborted and resumed.
+	downloadIdleTimeout = time.Minute
+)
+
+// downloadClient is the HTTP client used to download build packages. There is
+// no overall timeout, as large build packages can legitimately take a long
+// time to download; stalled downloads are caught by downloadIdleTimeout.
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+}
+
+// resumableBody is the body of an HTTP GET request that is transparently
+// resumed with a Range request when the connection fails part way through.
+type resumableBody struct {
+	url string
+
+	// sign, if set, is called to authenticate every request just before it
+	// is sent.
+	sign func(*http.Request)
+
+	// validator is the ETag or Last-Modified of the first response, used to
+	// make sure that a resumed download is of the same content.
+	validator string
+
+	// acceptRanges is whether the first response said that the server
+	// supports Range requests.
+	acceptRanges bool
+
+	// contentLength is the size of the whole body, or -1 if it is unknown.
+	contentLength int64
+
+	// changed is set if the body changed part way through the download, so
+	// it has to be downloaded again from the start.
+	changed bool
+
+	resp   *http.Response
+	cancel context.CancelFunc
+	idle   *time.Timer
+	offset int64
+	failed int
+}
+
+// openResumable starts downloading the body found at url, retrying until the
+// server responds successfully. If sign is not nil, it is used to authenticate
+// each request.
+func openResumable(url string, sign func(*http.Request)) (*resumableBody, error) {
+	b := &resumableBody{url: url, sign: sign}
+	for {
+		err := b.open()
+		if err == nil {
+			break
+		}
+
+		if err := b.retry(err); err != nil {
+			return nil, err
+		}
+	}
+
+	b.contentLength = b.resp.ContentLength
+	b.validator = responseValidator(b.resp)
+	b.acceptRanges = b.resp.Header.Get("Accept-Ranges") == "bytes"
+
+	return b, nil
+}
+
+// responseValidator returns the ETag or, failing that, the Last-Modified time
+// of the response, or "" if it has neither.
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// open requests the body starting from the current offset.
+func (b *resumableBody) open() error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if b.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+		if b.validator != "" {
+			req.Header.Set("If-Range", b.validator)
+		}
+	}
+	if b.sign != nil {
+		b.sign(req)
+	}
+
+	// Abort the request if it stops making progress.
+	b.idle = time.AfterFunc(downloadIdleTimeout, cancel)
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		b.idle.Stop()
+		cancel()
+		return err
+	}
+	b.resp, b.cancel = resp, cancel
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && b.offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(b.offset, 10)+"-") {
+			b.close()
+			return fmt.Errorf("unexpected Content-Range resuming download: %s", resp.Header.Get("Content-Range"))
+		}
+
+	case resp.StatusCode == http.StatusOK:
+		if b.offset == 0 {
+			break
+		}
+
+		// The whole body was sent again. If it is the same content, because
+		// its validator matches or the server has neither validators nor
+		// ranges, the server ignores ranges, so throw away everything that
+		// has already been read. Otherwise the content changed, and what has
+		// already been read can't be taken back.
+		validator := responseValidator(resp)
+		same := validator == b.validator && (validator != "" || !b.acceptRanges)
+		if !same {
+			b.close()
+			b.changed = true
+			return permanentError{errors.New("build package changed during download")}
+		}
+
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, b.offset); err != nil {
+			b.close()
+			return err
+		}
+
+	default:
+		b.close()
+		err := fmt.Errorf("unexpected status downloading build package: %s", resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return permanentError{err}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// close releases the current response, if any.
+func (b *resumableBody) close() {
+	if b.resp == nil {
+		return
+	}
+	b.idle.Stop()
+	b.resp.Body.Close()
+	b.cancel()
+	b.resp = nil
+}
+
+// retry decides whether the download can be attempted again after err,
+// waiting before returning if it can.
+func (b *resumableBody) retry(err error) error {
+	var perr permanentError
+	if errors.As(err, &perr) {
+		return perr.err
+	}
+
+	b.failed++
+	if b.failed >= downloadAttempts {
+		return fmt.Errorf("failed to download build package after %d attempts: %s", b.failed, err)
+	}
+
+	log.Warningf("failed to download build package (attempt %d, offset %d): %s", b.failed, b.offset, err)
+	time.Sleep(downloadRetryDelay * time.Duration(b.failed))
+	return nil
+}
+
+// Read implements the io.Reader interface for resumableBody.
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		if b.resp == nil {
+			if err := b.open(); err != nil {
+				if err := b.retry(err); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		n, err := b.resp.Body.Read(p)
+		b.offset += int64(n)
+		if n > 0 {
+			b.idle.Reset(downloadIdleTimeout)
+		}
+
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		// The connection failed part way through the body, so resume it.
+		b.close()
+		if err := b.retry(err); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close implements the io.Closer interface for resumableBody.
+func (b *resumableBody) Close() error {
+	b.close()
+	return nil
+}
+
+// permanentError is an error that retrying a download will not fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// sizeLimitedReader is a reader that fails once more than a given number of
+// bytes have been read from it.
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, archiveError("", reasonDownloadTooBig)
+	}
+
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, archiveError("", reasonDownloadTooBig)
+	}
+
+	return n, err
+}
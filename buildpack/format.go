@@ -0,0 +1,98 @@
+package buildpack
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// sniffLen is the number of bytes needed to identify a build package. It must
+// be large enough to find the magic of an uncompressed tar header.
+const sniffLen = 512
+
+// buildPackFormat is the kind of build package identified by sniffFormat.
+type buildPackFormat string
+
+const (
+	formatZip   buildPackFormat = "zip"
+	formatTar   buildPackFormat = "tar"
+	formatGzip  buildPackFormat = "tar+gzip"
+	formatBzip2 buildPackFormat = "tar+bzip2"
+	formatXz    buildPackFormat = "tar+xz"
+	formatZstd  buildPackFormat = "tar+zstd"
+	formatPlain buildPackFormat = "plain"
+)
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1f, 0x8b}
+	bzip2Magic    = []byte("BZh")
+	xzMagic       = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic     = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// tarMagicOffset is the offset of the magic field in a POSIX or GNU tar
+	// header.
+	tarMagicOffset = 257
+	tarMagic       = []byte("ustar")
+)
+
+// sniffFormat identifies the format of a build package from its leading bytes.
+// It returns an empty format if the contents are neither an archive nor text
+// that could be a Dockerfile.
+func sniffFormat(header []byte) buildPackFormat {
+	switch {
+	case bytes.HasPrefix(header, zipMagic), bytes.HasPrefix(header, emptyZipMagic):
+		return formatZip
+	case bytes.HasPrefix(header, gzipMagic):
+		return formatGzip
+	case bytes.HasPrefix(header, bzip2Magic):
+		return formatBzip2
+	case bytes.HasPrefix(header, xzMagic):
+		return formatXz
+	case bytes.HasPrefix(header, zstdMagic):
+		return formatZstd
+	case len(header) >= tarMagicOffset+len(tarMagic) && bytes.Equal(header[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return formatTar
+	}
+
+	// Anything else is only accepted if it looks like a Dockerfile.
+	mimetype := strings.Split(http.DetectContentType(header), ";")[0]
+	if mimetype == "text/plain" {
+		return formatPlain
+	}
+
+	return ""
+}
+
+// decompress wraps r in a reader that decompresses the given tar-based
+// format.
+func decompress(format buildPackFormat, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case formatGzip:
+		return gzip.NewReader(r)
+	case formatBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case formatXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	case formatZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
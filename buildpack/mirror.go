@@ -0,0 +1,226 @@
+package buildpack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	units "github.com/docker/go-units"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultMirrorCacheSize is the size the mirror cache is trimmed to when
+// GIT_MIRROR_CACHE_SIZE is not set.
+const defaultMirrorCacheSize = 10 << 30
+
+// mirrorCache is a directory of bare mirrors of the repositories that have
+// been built on this host, which are used to avoid cloning a repository from
+// scratch every time it is built.
+//
+// Each mirror is kept in a directory named after a hash of the repository URL,
+// next to a lock file that is held while the mirror is in use.
+type mirrorCache struct {
+	dir     string
+	maxSize int64
+}
+
+// mirrorCacheFromEnv returns the cache configured by GIT_MIRROR_CACHE_DIR and
+// GIT_MIRROR_CACHE_SIZE (e.g. "20g"), or nil if the cache is disabled.
+func mirrorCacheFromEnv() *mirrorCache {
+	dir := os.Getenv("GIT_MIRROR_CACHE_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	maxSize := int64(defaultMirrorCacheSize)
+	if value := os.Getenv("GIT_MIRROR_CACHE_SIZE"); value != "" {
+		size, err := units.RAMInBytes(value)
+		if err != nil || size <= 0 {
+			log.Warningf("ignoring invalid GIT_MIRROR_CACHE_SIZE %q, using %s", value, units.BytesSize(float64(maxSize)))
+		} else {
+			maxSize = size
+		}
+	}
+
+	return &mirrorCache{dir: dir, maxSize: maxSize}
+}
+
+// gitMirror is a mirror that is locked for the duration of a clone.
+type gitMirror struct {
+	path string
+	lock *os.File
+}
+
+// prepare locks the mirror of the repository at url and brings it up to date,
+// creating it if it doesn't exist yet. A mirror that can't be updated is only
+// recreated if it is corrupt; otherwise the remote is the problem, and the
+// output and error of the fetch are returned. If no usable mirror can be
+// made, nil is returned and the repository should be cloned without one.
+//
+// The mirror is always fetched with the credentials of the current build
+// before it is used, so a repository's objects are never handed to a build
+// that couldn't have cloned it.
+func (c *mirrorCache) prepare(url string, idleTimeout time.Duration, progress io.Writer) (*gitMirror, []byte, error) {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		log.Warningf("failed to create git mirror cache: %s", err)
+		return nil, nil, nil
+	}
+
+	key := mirrorKey(url)
+	lock, err := lockFile(filepath.Join(c.dir, key+".lock"), true)
+	if err != nil {
+		log.Warningf("failed to lock git mirror: %s", err)
+		return nil, nil, nil
+	}
+	m := &gitMirror{path: filepath.Join(c.dir, key+".git"), lock: lock}
+
+	if _, err := os.Stat(m.path); err == nil {
+		output, err := timeoutActiveCommand(idleTimeout, progress, "git", "-C", m.path, "fetch", "--prune", "--progress", "origin")
+		if err == nil {
+			log.Infof("updated git mirror %s", m.path)
+			return m, nil, nil
+		}
+		if !m.corrupt() {
+			log.Warningf("failed to update git mirror %s (%s)\n%s", m.path, err, output)
+			m.release()
+			return nil, output, err
+		}
+		log.Warningf("failed to update corrupt git mirror %s, recreating it (%s)\n%s", m.path, err, output)
+		m.discard()
+	}
+
+	output, err := timeoutActiveCommand(idleTimeout, progress, "git", "clone", "--mirror", "--progress", url, m.path)
+	if err != nil {
+		log.Warningf("failed to create git mirror %s (%s)\n%s", m.path, err, output)
+		m.discard()
+		m.release()
+		return nil, nil, nil
+	}
+	log.Infof("created git mirror %s", m.path)
+
+	return m, nil, nil
+}
+
+// corrupt reports whether the mirror is not a valid repository, or is missing
+// objects that its refs point to.
+func (m *gitMirror) corrupt() bool {
+	for _, args := range [][]string{
+		{"rev-parse", "--is-bare-repository"},
+		{"fsck", "--connectivity-only", "--no-progress"},
+	} {
+		output, err := exec.Command("git", append([]string{"--git-dir", m.path}, args...)...).CombinedOutput()
+		if err != nil {
+			log.Warningf("git mirror %s is corrupt: git %s failed (%s)\n%s", m.path, args[0], err, output)
+			return true
+		}
+	}
+	return false
+}
+
+// discard removes the contents of the mirror, so that it is recreated the next
+// time it is needed.
+func (m *gitMirror) discard() {
+	if err := os.RemoveAll(m.path); err != nil {
+		log.Errorf("failed to remove git mirror %s: %s", m.path, err)
+	}
+}
+
+// release marks the mirror as used and unlocks it.
+func (m *gitMirror) release() {
+	now := time.Now()
+	os.Chtimes(m.lock.Name(), now, now)
+	m.lock.Close()
+}
+
+// evict removes the least recently used mirrors until the cache is no larger
+// than its maximum size. Mirrors that are in use are skipped.
+func (c *mirrorCache) evict() {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.git"))
+	if err != nil {
+		log.Warningf("failed to list git mirrors: %s", err)
+		return
+	}
+
+	type cachedMirror struct {
+		path     string
+		size     int64
+		lastUsed time.Time
+	}
+
+	var mirrors []cachedMirror
+	var total int64
+	for _, path := range paths {
+		m := cachedMirror{path: path, size: dirSize(path)}
+		if fi, err := os.Stat(strings.TrimSuffix(path, ".git") + ".lock"); err == nil {
+			m.lastUsed = fi.ModTime()
+		}
+		mirrors = append(mirrors, m)
+		total += m.size
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].lastUsed.Before(mirrors[j].lastUsed) })
+	for _, m := range mirrors {
+		if total <= c.maxSize {
+			return
+		}
+
+		lock, err := lockFile(strings.TrimSuffix(m.path, ".git")+".lock", false)
+		if err != nil {
+			// The mirror is being used by another build.
+			continue
+		}
+		if err := os.RemoveAll(m.path); err != nil {
+			log.Warningf("failed to evict git mirror %s: %s", m.path, err)
+		} else {
+			log.Infof("evicted git mirror %s (%s)", m.path, units.BytesSize(float64(m.size)))
+			total -= m.size
+		}
+		lock.Close()
+	}
+}
+
+// mirrorKey names the mirror of the repository at url.
+func mirrorKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+// lockFile opens and exclusively locks path. The lock is released when the
+// file is closed. If wait is false and the file is already locked, an error
+// is returned instead of waiting.
+func lockFile(path string, wait bool) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// dirSize returns the total size of the files in dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
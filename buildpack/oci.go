@@ -0,0 +1,64 @@
+package buildpack
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+// openOCIArtifact starts downloading the build package stored as the single
+// layer of the OCI artifact found at reference. Artifacts in the registry being
+// built for are pulled with the build's tokens; any other registry is accessed
+// anonymously.
+func openOCIArtifact(reference string, args *rpc.BuildArgs) (io.ReadCloser, int64, error) {
+	ref, err := name.ParseReference(reference)
+	if err != nil {
+		return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Invalid build package reference %q: %s", reference, err)}
+	}
+
+	auth := authn.Anonymous
+	if ref.Context().RegistryStr() == args.Registry {
+		token := args.PullToken
+		if token == "" {
+			token = args.PushToken
+		}
+		if token != "" {
+			auth = &authn.Basic{Username: "$token", Password: token}
+		}
+	}
+
+	img, err := remote.Image(ref, remote.WithAuth(auth), remote.WithTransport(downloadClient.Transport))
+	if err != nil {
+		return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Error fetching build package artifact %s: %s", reference, err)}
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Error fetching build package artifact %s: %s", reference, err)}
+	}
+	if len(manifest.Layers) != 1 {
+		return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Build package artifact %s must contain exactly one layer, found %d", reference, len(manifest.Layers))}
+	}
+	desc := manifest.Layers[0]
+	log.Infof("buildpack artifact layer %s (%s)", desc.Digest, desc.MediaType)
+
+	layer, err := img.LayerByDigest(desc.Digest)
+	if err != nil {
+		return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Error fetching build package artifact %s: %s", reference, err)}
+	}
+
+	// The layer is read as it is stored, as the build package is identified
+	// from its contents rather than its media type.
+	body, err := layer.Compressed()
+	if err != nil {
+		return nil, 0, rpc.BuildPackError{Err: fmt.Sprintf("Error fetching build package artifact %s: %s", reference, err)}
+	}
+
+	return body, desc.Size, nil
+}
@@ -0,0 +1,152 @@
+package buildpack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+const (
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+
+	// allowedSignersPrincipal is the principal given to every trusted SSH key
+	// in the allowed signers file. Git only requires that the principal found
+	// for a key is the one it is verified against.
+	allowedSignersPrincipal = "quay-builder"
+)
+
+// verifyCommitSignature checks that the commit identified by sha in the
+// repository at repoDir is signed by one of trustedKeys. If no keys are
+// trusted, no verification is performed.
+func verifyCommitSignature(repoDir, sha string, trustedKeys []string) error {
+	if len(trustedKeys) == 0 {
+		return nil
+	}
+
+	// Find which kind of signature (if any) is attached to the commit.
+	rawCommit, err := exec.Command("git", "-C", repoDir, "cat-file", "commit", sha).Output()
+	if err != nil {
+		return rpc.GitSignatureError{Err: fmt.Sprintf("Error reading git commit %s (%s)", sha, err)}
+	}
+
+	var sshKeys, gpgKeys []string
+	for _, key := range trustedKeys {
+		if isSSHPublicKey(key) {
+			sshKeys = append(sshKeys, strings.TrimSpace(key))
+		} else {
+			gpgKeys = append(gpgKeys, key)
+		}
+	}
+
+	var output []byte
+	switch commitSignatureHeader(rawCommit) {
+	case "":
+		return rpc.GitSignatureError{Err: fmt.Sprintf("Commit %s is not signed", sha)}
+	case pgpSignatureHeader:
+		output, err = verifyGPGSignature(repoDir, sha, gpgKeys)
+	case sshSignatureHeader:
+		output, err = verifySSHSignature(repoDir, sha, sshKeys)
+	default:
+		return rpc.GitSignatureError{Err: fmt.Sprintf("Commit %s has an unsupported kind of signature", sha)}
+	}
+	if err != nil {
+		return rpc.GitSignatureError{Err: fmt.Sprintf("Commit %s is not signed by a trusted key (%s)\n%s", sha, err, output)}
+	}
+	log.Infof("git verify-commit output: %s", output)
+
+	return nil
+}
+
+// commitSignatureHeader returns the first line of the signature found in the
+// headers of a raw commit object, or an empty string if it is unsigned.
+func commitSignatureHeader(rawCommit []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(rawCommit))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// The headers end at the first empty line.
+			break
+		}
+
+		for _, header := range []string{"gpgsig ", "gpgsig-sha256 "} {
+			if strings.HasPrefix(line, header) {
+				return strings.TrimSpace(strings.TrimPrefix(line, header))
+			}
+		}
+	}
+
+	return ""
+}
+
+// isSSHPublicKey reports whether key is in the authorized_keys format rather
+// than an armored GPG key.
+func isSSHPublicKey(key string) bool {
+	key = strings.TrimSpace(key)
+	for _, prefix := range []string{"ssh-", "ecdsa-", "sk-"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyGPGSignature imports the trusted keys into an empty keyring and
+// verifies the commit against it.
+func verifyGPGSignature(repoDir, sha string, keys []string) ([]byte, error) {
+	gnupgHome, err := ioutil.TempDir("", "gnupg")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(gnupgHome)
+
+	env := append(os.Environ(), "GNUPGHOME="+gnupgHome)
+
+	if len(keys) > 0 {
+		importCmd := exec.Command("gpg", "--batch", "--import")
+		importCmd.Env = env
+		importCmd.Stdin = strings.NewReader(strings.Join(keys, "\n"))
+		if output, err := importCmd.CombinedOutput(); err != nil {
+			return output, fmt.Errorf("failed to import trusted keys: %s", err)
+		}
+	}
+
+	cmd := exec.Command("git", "-C", repoDir, "verify-commit", "--raw", sha)
+	cmd.Env = env
+	return cmd.CombinedOutput()
+}
+
+// verifySSHSignature writes the trusted keys to an allowed signers file and
+// verifies the commit against it.
+func verifySSHSignature(repoDir, sha string, keys []string) ([]byte, error) {
+	signersDir, err := ioutil.TempDir("", "allowed_signers")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(signersDir)
+
+	var signers bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&signers, "%s %s\n", allowedSignersPrincipal, key)
+	}
+
+	signersPath := filepath.Join(signersDir, "allowed_signers")
+	if err := ioutil.WriteFile(signersPath, signers.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+
+	return exec.Command(
+		"git", "-C", repoDir,
+		"-c", "gpg.ssh.allowedSignersFile="+signersPath,
+		"verify-commit", sha,
+	).CombinedOutput()
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -12,6 +16,7 @@ import (
 	"google.golang.org/grpc/credentials"
 
 	"github.com/quay/quay-builder/buildctx"
+	"github.com/quay/quay-builder/buildlog"
 	"github.com/quay/quay-builder/rpc"
 	"github.com/quay/quay-builder/rpc/grpcbuild"
 	"github.com/quay/quay-builder/version"
@@ -87,74 +92,146 @@ func main() {
 		log.Fatalf("failed to register job to build manager: %s", err)
 	}
 
+	// Record the build locally, in case the connection to the build manager
+	// is lost.
+	client := rpcClient
+	recorder, err := buildlog.NewRecorder(rpcClient, buildLogFile())
+	if err != nil {
+		log.Warningf("not recording the build locally: %s", err)
+	} else {
+		log.Infof("recording build to %s", recorder.Path())
+		client = recorder
+		// Logs that can't be sent are still delivered in the log bundle.
+		if buildargs.LogBundleURL != "" {
+			recorder.TolerateSendErrors()
+		}
+	}
+
+	buildCtx, err := buildctx.New(client, buildargs, dockerHost, containerRuntime)
+	if err != nil {
+		finish(recorder, nil, buildargs, nil, err)
+		log.Fatalf("failed to build buildpack: %s", err)
+	}
+
+	// The builder exits if the connection to the build manager is lost, so
+	// the log bundle is uploaded first.
+	log.RegisterExitHandler(func() {
+		finish(recorder, buildCtx, buildargs, nil, errConnectionLost)
+	})
+
 	// Start heartbeating
 	log.Infof("starting heartbeat to buildmanager")
 	hbCtx, hbCancel := context.WithCancel(context.Background())
 	defer hbCancel()
-	go rpcClient.Heartbeat(hbCtx)
+	go func() {
+		if err := rpcClient.Heartbeat(hbCtx); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
 	// Start build
 	log.Infof("starting build")
-	_, err = build(dockerHost, containerRuntime, rpcClient, buildargs, hbCancel)
-	if err != nil {
+	bmd, err := build(buildCtx, hbCancel)
+	finish(recorder, buildCtx, buildargs, bmd, err)
+
+	if partial, ok := err.(rpc.PartialPushError); ok {
+		log.Warningf("build completed without tags %s: %s", strings.Join(partial.Failed, ", "), err)
+	} else if err != nil {
 		log.Fatalf("failed to build buildpack: %s", err)
 	}
 
 	log.Infof("done")
 }
 
-func build(dockerHost, containerRuntime string, client rpc.Client, args *rpc.BuildArgs, hbCanceller context.CancelFunc) (*rpc.BuildMetadata, error) {
-	var buildCtx *buildctx.Context
-	buildCtx, err := buildctx.New(client, args, dockerHost, containerRuntime)
-	if err != nil {
-		return nil, err
-	}
+// errConnectionLost is the outcome recorded for a build that is stopped
+// because the connection to the build manager was lost.
+var errConnectionLost = errors.New("lost connection to the build manager")
 
+// finishOnce makes sure the outcome of the build is only recorded once.
+var finishOnce sync.Once
+
+// finish records the outcome of the build and uploads its log bundle, if the
+// build manager asked for one.
+func finish(recorder *buildlog.Recorder, buildCtx *buildctx.Context, args *rpc.BuildArgs, bmd *rpc.BuildMetadata, err error) {
+	finishOnce.Do(func() {
+		if recorder == nil {
+			return
+		}
+
+		if ferr := recorder.Finish(err); ferr != nil {
+			log.Warningf("failed to write build log file: %s", ferr)
+		}
+
+		if buildCtx != nil && args.LogBundleURL != "" {
+			log.Infof("uploading log bundle")
+			if uerr := buildCtx.UploadLogBundle(recorder.Path(), bmd, err); uerr != nil {
+				log.Warningf("failed to upload log bundle: %s", uerr)
+			}
+		}
+	})
+}
+
+func build(buildCtx *buildctx.Context, hbCanceller context.CancelFunc) (*rpc.BuildMetadata, error) {
 	// Unpack the buildpack.
 	log.Infof("build: upacking build")
-	if err = buildCtx.Unpack(); err != nil {
+	if err := buildCtx.Unpack(); err != nil {
+		return nil, err
+	}
+
+	// Check the base images against the base image policy.
+	log.Infof("build: checking base images")
+	if err := buildCtx.CheckBaseImages(); err != nil {
 		return nil, err
 	}
 
 	// Pull the base image.
 	log.Infof("build: pulling base image")
-	if err = buildCtx.Pull(); err != nil {
+	if err := buildCtx.Pull(); err != nil {
 		return nil, err
 	}
 
 	// Prime the cache.
 	log.Infof("build: priming cache")
-	if err = buildCtx.Cache(); err != nil {
+	if err := buildCtx.Cache(); err != nil {
 		return nil, err
 	}
 
 	// Kick off the build.
 	log.Infof("build: building")
-	if err = buildCtx.Build(); err != nil {
+	if err := buildCtx.Build(); err != nil {
 		return nil, err
 	}
 
 	// Push the newly created image to the requested tag(s).
 	log.Infof("build: pushing")
-	bmd, err := buildCtx.Push()
-	if err != nil {
-		return nil, err
+	// A push that failed to create some of the tags still completes the
+	// build, reporting which tags are missing.
+	bmd, pushErr := buildCtx.Push()
+	if _, partial := pushErr.(rpc.PartialPushError); pushErr != nil && !partial {
+		return nil, pushErr
 	}
 
 	// Stop heartbeats
 	hbCanceller()
 
-	// Move build to completed phase
-	if err := client.SetPhase(rpc.Complete, nil); err != nil {
-		log.Errorf("failed to update phase to `complete`")
+	// Move build to completed phase and cleanup any pulled images.
+	log.Infof("build: completing")
+	if err := buildCtx.Complete(bmd); err != nil {
+		log.Errorf("failed to complete the build")
 		return nil, err
 	}
 
-	// Cleanup any pulled images.
-	log.Infof("build: cleanup")
-	if err = buildCtx.Cleanup(bmd.ImageID); err != nil {
-		return nil, err
+	return bmd, pushErr
+}
+
+// buildLogFile returns the path of the file the build is recorded in: a file
+// named after the time the build started in BUILD_LOG_DIR, or the temporary
+// directory if it isn't set.
+func buildLogFile() string {
+	dir := os.Getenv("BUILD_LOG_DIR")
+	if dir == "" {
+		dir = os.TempDir()
 	}
 
-	return bmd, nil
+	return filepath.Join(dir, fmt.Sprintf("quay-builder-%s.jsonl", time.Now().UTC().Format("20060102T150405Z")))
 }
@@ -0,0 +1,171 @@
+package containerclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	units "github.com/docker/go-units"
+	controlapi "github.com/moby/buildkit/api/services/control"
+)
+
+// buildKitTraceID is the ID of the aux messages in which Docker streams the
+// progress of a build run with BuildKit, instead of the plain text output of
+// the classic builder.
+const buildKitTraceID = "moby.buildkit.trace"
+
+// traceRenderer renders the progress of a BuildKit build, which Docker streams
+// as StatusResponse protobufs, into lines of text in the format of
+// "docker build --progress=plain" (e.g. "#5 [2/3] RUN make"), so that it can
+// be logged like the output of the other builders.
+type traceRenderer struct {
+	vertices map[string]*traceVertex
+	// startedJobs and completedJobs are the jobs of each vertex, such as
+	// pulling a layer, whose progress has been rendered.
+	startedJobs   map[string]bool
+	completedJobs map[string]bool
+}
+
+// traceVertex is a step of a BuildKit build.
+type traceVertex struct {
+	index     int
+	name      string
+	started   bool
+	completed bool
+	// partial is the end of the vertex's output that isn't followed by a
+	// newline yet.
+	partial []byte
+}
+
+// render decodes a trace message and returns the lines describing the
+// progress it reports.
+func (r *traceRenderer) render(aux json.RawMessage) ([]string, error) {
+	// The protobuf is encoded as a JSON string, which encoding/json decodes
+	// from base64.
+	var dt []byte
+	if err := json.Unmarshal(aux, &dt); err != nil {
+		return nil, err
+	}
+	var status controlapi.StatusResponse
+	if err := status.UnmarshalVT(dt); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, v := range status.Vertexes {
+		vertex := r.vertex(v.Digest)
+		vertex.name = v.Name
+		if (v.Started != nil || v.Completed != nil) && !vertex.started {
+			vertex.started = true
+			lines = append(lines, fmt.Sprintf("#%d %s\n", vertex.index, vertex.name))
+		}
+	}
+
+	// Only the start and end of each job are rendered, as BuildKit reports
+	// its progress many times a second.
+	for _, s := range status.Statuses {
+		vertex := r.vertex(s.Vertex)
+		job := s.Vertex + "/" + s.ID
+		if s.Completed != nil {
+			if !r.completedJobs[job] {
+				r.completedJobs[job] = true
+				lines = append(lines, fmt.Sprintf("#%d %s%s done\n", vertex.index, s.ID, progress(s)))
+			}
+		} else if !r.startedJobs[job] {
+			r.startedJobs[job] = true
+			lines = append(lines, fmt.Sprintf("#%d %s%s\n", vertex.index, s.ID, progress(s)))
+		}
+	}
+
+	for _, l := range status.Logs {
+		vertex := r.vertex(l.Vertex)
+		data := append(vertex.partial, l.Msg...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			lines = append(lines, fmt.Sprintf("#%d %s", vertex.index, data[:i+1]))
+			data = data[i+1:]
+		}
+		vertex.partial = append([]byte{}, data...)
+	}
+
+	for _, w := range status.Warnings {
+		vertex := r.vertex(w.Vertex)
+		lines = append(lines, fmt.Sprintf("#%d WARNING: %s\n", vertex.index, w.Short))
+	}
+
+	for _, v := range status.Vertexes {
+		vertex := r.vertex(v.Digest)
+		if v.Completed == nil || vertex.completed {
+			continue
+		}
+		vertex.completed = true
+		lines = append(lines, r.flushVertex(vertex)...)
+
+		switch {
+		case v.Error != "":
+			lines = append(lines, fmt.Sprintf("#%d ERROR: %s\n", vertex.index, v.Error))
+		case v.Cached:
+			lines = append(lines, fmt.Sprintf("#%d CACHED\n", vertex.index))
+		case v.Started != nil:
+			elapsed := v.Completed.AsTime().Sub(v.Started.AsTime())
+			lines = append(lines, fmt.Sprintf("#%d DONE %.1fs\n", vertex.index, elapsed.Seconds()))
+		default:
+			lines = append(lines, fmt.Sprintf("#%d DONE\n", vertex.index))
+		}
+	}
+
+	return lines, nil
+}
+
+// flush returns the output of every vertex that isn't followed by a newline,
+// such as at the end of a build.
+func (r *traceRenderer) flush() []string {
+	vertices := make([]*traceVertex, 0, len(r.vertices))
+	for _, vertex := range r.vertices {
+		vertices = append(vertices, vertex)
+	}
+	sort.Slice(vertices, func(i, j int) bool { return vertices[i].index < vertices[j].index })
+
+	var lines []string
+	for _, vertex := range vertices {
+		lines = append(lines, r.flushVertex(vertex)...)
+	}
+	return lines
+}
+
+func (r *traceRenderer) flushVertex(vertex *traceVertex) []string {
+	if len(vertex.partial) == 0 {
+		return nil
+	}
+	line := fmt.Sprintf("#%d %s\n", vertex.index, vertex.partial)
+	vertex.partial = nil
+	return []string{line}
+}
+
+// vertex returns the vertex with the digest, numbering it in the order it was
+// first seen.
+func (r *traceRenderer) vertex(digest string) *traceVertex {
+	if r.vertices == nil {
+		r.vertices = map[string]*traceVertex{}
+		r.startedJobs = map[string]bool{}
+		r.completedJobs = map[string]bool{}
+	}
+	vertex, ok := r.vertices[digest]
+	if !ok {
+		vertex = &traceVertex{index: len(r.vertices) + 1}
+		r.vertices[digest] = vertex
+	}
+	return vertex
+}
+
+// progress describes how much of a job is done, if BuildKit reported it.
+func progress(s *controlapi.VertexStatus) string {
+	if s.Total == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" %s / %s", units.HumanSize(float64(s.Current)), units.HumanSize(float64(s.Total)))
+}
@@ -1,5 +1,17 @@
 package containerclient
 
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+
+	"github.com/quay/quay-builder/containerclient/dockerfile"
+)
+
 type TestDockerClient struct {
 	err          error
 	ImagePulled  bool
@@ -25,9 +37,9 @@ func (c *TestDockerClient) PullImage(PullImageOptions, AuthConfiguration) error
 	return c.err
 }
 
-func (c *TestDockerClient) PushImage(PushImageOptions, AuthConfiguration) error {
+func (c *TestDockerClient) PushImage(PushImageOptions, AuthConfiguration) (string, error) {
 	c.ImagePushed = true
-	return c.err
+	return "", c.err
 }
 
 func (c *TestDockerClient) TagImage(string, TagImageOptions) error {
@@ -47,3 +59,75 @@ func (c *TestDockerClient) RemoveImageExtended(string, RemoveImageOptions) error
 	c.ImageRemoved = true
 	return c.err
 }
+
+func (c *TestDockerClient) UsesBuildKit() bool {
+	return false
+}
+
+func (c *TestDockerClient) IgnoreFiles() []string {
+	return dockerfile.DockerIgnoreFiles
+}
+
+func (c *TestDockerClient) InsecureRegistry(string) bool {
+	return false
+}
+
+func TestDockerAuthConfigs(t *testing.T) {
+	configs := dockerAuthConfigs(map[string]AuthConfiguration{
+		"docker.io": {Username: "hub", Password: "hubpass"},
+		"ghcr.io":   {Username: "gh", Password: "ghpass"},
+	})
+
+	expected := map[string]docker.AuthConfiguration{
+		dockerHubAuthKey: {Username: "hub", Password: "hubpass", ServerAddress: dockerHubAuthKey},
+		"ghcr.io":        {Username: "gh", Password: "ghpass", ServerAddress: "ghcr.io"},
+	}
+	if !reflect.DeepEqual(configs.Configs, expected) {
+		t.Errorf("got %+v, wanted %+v", configs.Configs, expected)
+	}
+}
+
+func TestWriteAuthFile(t *testing.T) {
+	path, err := writeAuthFile(map[string]AuthConfiguration{"ghcr.io": {Username: "gh", Password: "ghpass"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"auths":{"ghcr.io":{"auth":"Z2g6Z2hwYXNz"}}}` + "\n"; string(data) != expected {
+		t.Errorf("got %s, wanted %s", data, expected)
+	}
+}
+
+func TestPushDigestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &pushDigestWriter{w: &out}
+	messages := `{"status":"The push refers to repository [quay.io/org/repo]"}` + "\r\n" +
+		`{"status":"Pushed","progressDetail":{},"id":"0123abcd"}` + "\r\n" +
+		`{"status":"latest: digest: sha256:abc size: 528"}` + "\r\n" +
+		`{"progressDetail":{},"aux":{"Tag":"latest","Digest":"sha256:abc","Size":528}}`
+
+	// The messages are split across writes, and the last isn't followed by
+	// a newline.
+	for i := 0; i < len(messages); i += 7 {
+		end := i + 7
+		if end > len(messages) {
+			end = len(messages)
+		}
+		if _, err := w.Write([]byte(messages[i:end])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.flush()
+
+	if w.digest != "sha256:abc" {
+		t.Errorf("got digest %q, wanted sha256:abc", w.digest)
+	}
+	if out.String() != messages {
+		t.Errorf("got output %q, wanted %q", out.String(), messages)
+	}
+}
@@ -1,14 +1,23 @@
 package containerclient
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 
 	"github.com/fsouza/go-dockerclient"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/quay/quay-builder/containerclient/dockerfile"
 )
 
 func buildTLSTransport(basePath string) (*http.Transport, error) {
@@ -40,7 +49,8 @@ func buildTLSTransport(basePath string) (*http.Transport, error) {
 }
 
 type dockerClient struct {
-	client *docker.Client
+	client   *docker.Client
+	buildKit bool
 }
 
 func NewDockerClient(host string) (*dockerClient, error) {
@@ -69,11 +79,32 @@ func NewDockerClient(host string) (*dockerClient, error) {
 		c.HTTPClient = &http.Client{Transport: transport}
 	}
 
-	return &dockerClient{client: c}, nil
+	// As with the docker CLI, DOCKER_BUILDKIT=1 builds images with BuildKit
+	// rather than the classic builder.
+	var buildKit bool
+	if value := os.Getenv("DOCKER_BUILDKIT"); value != "" {
+		buildKit, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Warningf("ignoring invalid DOCKER_BUILDKIT %q", value)
+		}
+	}
+
+	return &dockerClient{client: c, buildKit: buildKit}, nil
 }
 
 func (c *dockerClient) BuildImage(opts BuildImageOptions) error {
-	return c.client.BuildImage(docker.BuildImageOptions{
+	return c.client.BuildImage(c.buildImageOptions(opts))
+}
+
+// reproducibleOutputs is the BuildKit output of reproducible builds, which
+// clamps the timestamps of the files in new layers to SOURCE_DATE_EPOCH.
+const reproducibleOutputs = `[{"Type":"moby","Attrs":{"rewrite-timestamp":"true"}}]`
+
+// buildImageOptions converts the options to the form expected by the Docker
+// client. Reproducible builds are always built with BuildKit, as the classic
+// builder ignores SOURCE_DATE_EPOCH.
+func (c *dockerClient) buildImageOptions(opts BuildImageOptions) docker.BuildImageOptions {
+	buildOpts := docker.BuildImageOptions{
 		Name:                opts.Name,
 		NoCache:             opts.NoCache,
 		CacheFrom:           opts.CacheFrom,
@@ -84,7 +115,111 @@ func (c *dockerClient) BuildImage(opts BuildImageOptions) error {
 		RawJSONStream:       true,
 		Dockerfile:          opts.Dockerfile,
 		ContextDir:          opts.ContextDir,
-	})
+		Labels:              opts.Labels,
+		BuildArgs:           dockerBuildArgs(opts),
+		Version:             c.builderVersion(),
+		AuthConfigs:         dockerAuthConfigs(opts.AuthConfigs),
+	}
+	if opts.SourceDateEpoch != nil {
+		buildOpts.Version = docker.BuilderBuildKit
+		buildOpts.Outputs = reproducibleOutputs
+	}
+	return buildOpts
+}
+
+// dockerHubAuthKey is the key the Docker daemon expects for Docker Hub
+// credentials.
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// dockerAuthConfigs converts credentials keyed by registry hostname to the
+// form expected by the Docker daemon.
+func dockerAuthConfigs(auths map[string]AuthConfiguration) docker.AuthConfigurations {
+	configs := docker.AuthConfigurations{Configs: map[string]docker.AuthConfiguration{}}
+	for registry, auth := range auths {
+		if registry == "docker.io" {
+			registry = dockerHubAuthKey
+		}
+		configs.Configs[registry] = docker.AuthConfiguration{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: registry,
+		}
+	}
+	return configs
+}
+
+// builderVersion selects BuildKit if it is enabled, and otherwise leaves the
+// choice of builder to the daemon.
+func (c *dockerClient) builderVersion() docker.BuilderVersion {
+	if c.buildKit {
+		return docker.BuilderBuildKit
+	}
+	return ""
+}
+
+func (c *dockerClient) UsesBuildKit() bool {
+	return c.buildKit
+}
+
+// IgnoreFiles is only .dockerignore, as Docker doesn't read .containerignore.
+func (c *dockerClient) IgnoreFiles() []string {
+	return dockerfile.DockerIgnoreFiles
+}
+
+// InsecureRegistry asks the daemon whether the registry is one of its
+// insecure registries, either by name or by being in an insecure IP range.
+func (c *dockerClient) InsecureRegistry(registry string) bool {
+	info, err := c.client.Info()
+	if err != nil {
+		log.Warningf("failed to read the registry configuration of the docker daemon: %s", err)
+		return false
+	}
+	if info.RegistryConfig == nil {
+		return false
+	}
+
+	if index, ok := info.RegistryConfig.IndexConfigs[registry]; ok {
+		return !index.Secure
+	}
+
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, cidr := range info.RegistryConfig.InsecureRegistryCIDRs {
+			if (*net.IPNet)(cidr).Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// dockerBuildArgs converts the build args to the form expected by the Docker
+// client, sorted so that they are always sent in the same order. BuildKit
+// timestamps the image with the SOURCE_DATE_EPOCH build arg.
+func dockerBuildArgs(opts BuildImageOptions) []docker.BuildArg {
+	args := map[string]string{}
+	for name, value := range opts.BuildArgs {
+		args[name] = value
+	}
+	if opts.SourceDateEpoch != nil {
+		args[sourceDateEpochArg] = strconv.FormatInt(opts.SourceDateEpoch.Unix(), 10)
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buildArgs []docker.BuildArg
+	for _, name := range names {
+		buildArgs = append(buildArgs, docker.BuildArg{Name: name, Value: args[name]})
+	}
+	return buildArgs
 }
 
 func (c *dockerClient) PullImage(opts PullImageOptions, auth AuthConfiguration) error {
@@ -103,13 +238,14 @@ func (c *dockerClient) PullImage(opts PullImageOptions, auth AuthConfiguration)
 	)
 }
 
-func (c *dockerClient) PushImage(opts PushImageOptions, auth AuthConfiguration) error {
-	return c.client.PushImage(
+func (c *dockerClient) PushImage(opts PushImageOptions, auth AuthConfiguration) (string, error) {
+	out := &pushDigestWriter{w: opts.OutputStream}
+	err := c.client.PushImage(
 		docker.PushImageOptions{
 			Name:          opts.Repository,
 			Registry:      opts.Registry,
 			Tag:           opts.Tag,
-			OutputStream:  opts.OutputStream,
+			OutputStream:  out,
 			RawJSONStream: true,
 		},
 		docker.AuthConfiguration{
@@ -117,6 +253,51 @@ func (c *dockerClient) PushImage(opts PushImageOptions, auth AuthConfiguration)
 			Password: auth.Password,
 		},
 	)
+	out.flush()
+	return out.digest, err
+}
+
+// pushDigestWriter passes on the JSON messages Docker streams while pushing an
+// image, and keeps the digest from the message reporting the pushed manifest
+// (e.g. {"aux":{"Tag":"latest","Digest":"sha256:...","Size":528}}).
+type pushDigestWriter struct {
+	w       io.Writer
+	partial []byte
+	digest  string
+}
+
+func (pw *pushDigestWriter) Write(p []byte) (int, error) {
+	pw.partial = append(pw.partial, p...)
+	for {
+		i := bytes.IndexByte(pw.partial, '\n')
+		if i < 0 {
+			break
+		}
+		pw.parse(pw.partial[:i])
+		pw.partial = pw.partial[i+1:]
+	}
+
+	if pw.w == nil {
+		return len(p), nil
+	}
+	return pw.w.Write(p)
+}
+
+// flush parses the last message, if it wasn't followed by a newline.
+func (pw *pushDigestWriter) flush() {
+	pw.parse(pw.partial)
+	pw.partial = nil
+}
+
+func (pw *pushDigestWriter) parse(line []byte) {
+	var m struct {
+		Aux struct {
+			Digest string `json:"Digest"`
+		} `json:"aux"`
+	}
+	if json.Unmarshal(line, &m) == nil && m.Aux.Digest != "" {
+		pw.digest = m.Aux.Digest
+	}
 }
 
 func (c *dockerClient) TagImage(name string, opts TagImageOptions) error {
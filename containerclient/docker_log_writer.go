@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"runtime"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,11 +15,26 @@ import (
 )
 
 const (
+	// minProgressDelta is the fewest bytes a layer must have progressed by
+	// for its progress to be sent again.
 	minProgressDelta = 10000000
-	bufferingStatus  = "Buffering to disk"
-	pushingStatus    = "Pushing"
+	// minProgressInterval is the shortest time between the progress messages
+	// sent for a layer.
+	minProgressInterval = 500 * time.Millisecond
+	// maxProgressInterval is the longest time progress messages for a layer
+	// are held back for, however little it has progressed.
+	maxProgressInterval = 5 * time.Second
 )
 
+// progressStatuses are the statuses of the progress messages that are
+// throttled.
+var progressStatuses = map[string]bool{
+	"Buffering to disk": true,
+	"Downloading":       true,
+	"Extracting":        true,
+	"Pushing":           true,
+}
+
 // partialBuffer represents a buffer of data that was unable to be previously
 // serialized because it was not enough data was provided to form valid JSON.
 type partialBuffer []byte
@@ -42,6 +58,9 @@ type DockerRPCWriter struct {
 	errResponse      *Response
 	partialBuffer    *partialBuffer
 	hasPartialBuffer bool
+	events           eventParser
+	filter           filter
+	trace            traceRenderer
 }
 
 // Write implements the io.Writer interface for RPCWriter.
@@ -56,7 +75,6 @@ func (w *DockerRPCWriter) Write(p []byte) (n int, err error) {
 
 	buf := bytes.NewBuffer(p)
 	dec := json.NewDecoder(buf)
-	f := &filter{}
 
 	for {
 		// Yield to the Go scheduler. Sometimes, when we have very large number of
@@ -93,17 +111,28 @@ func (w *DockerRPCWriter) Write(p []byte) (n int, err error) {
 			continue
 		}
 
-		if f.shouldSkip(&m) {
+		// BuildKit's progress is only sent as trace messages, which are
+		// rendered into the lines "docker build --progress=plain" shows.
+		if m.ID == buildKitTraceID {
+			lines, err := w.trace.render(m.Aux)
+			if err != nil {
+				log.Warningf("Failed to decode BuildKit progress: %v", err)
+				continue
+			}
+			for _, line := range lines {
+				if err := w.publish(&Response{Stream: line}); err != nil {
+					log.Fatalf("Failed to publish log entry: %v", err)
+				}
+			}
 			continue
 		}
+		m.Aux = nil
 
-		jsonData, err := json.Marshal(&m)
-		if err != nil {
-			log.Fatalf("Error when marshaling logs: %v", err)
+		if w.filter.shouldSkip(&m) {
+			continue
 		}
 
-		err = w.client.PublishBuildLogEntry(string(jsonData))
-		if err != nil {
+		if err := w.publish(&m); err != nil {
 			log.Fatalf("Failed to publish log entry: %v", err)
 		}
 	}
@@ -111,6 +140,50 @@ func (w *DockerRPCWriter) Write(p []byte) (n int, err error) {
 	return originalLength, nil
 }
 
+// publish annotates a log entry with the event it describes, if any, and
+// publishes it.
+func (w *DockerRPCWriter) publish(m *Response) error {
+	w.events.annotate(m)
+
+	jsonData, err := json.Marshal(m)
+	if err != nil {
+		log.Fatalf("Error when marshaling logs: %v", err)
+	}
+
+	return w.client.PublishBuildLogEntry(string(jsonData))
+}
+
+// WriteStream implements the LogWriter interface for DockerRPCWriter.
+func (w *DockerRPCWriter) WriteStream(s string) error {
+	return w.publish(&Response{Stream: s})
+}
+
+// Flush implements the LogWriter interface for DockerRPCWriter. Docker's output
+// is JSON, so an incomplete message can't be published, and is thrown away so
+// that it isn't joined to the next output. The last line of output of each
+// BuildKit step is published if it wasn't followed by a newline.
+func (w *DockerRPCWriter) Flush() error {
+	if w.partialBuffer.hasContents() {
+		log.Warningf("discarding incomplete log entry: %s", w.partialBuffer.getAndEmpty(nil))
+	}
+	for _, line := range w.trace.flush() {
+		if err := w.publish(&Response{Stream: line}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteError implements the LogWriter interface for DockerRPCWriter.
+func (w *DockerRPCWriter) WriteError(s string) error {
+	jsonData, err := json.Marshal(&Response{Error: s})
+	if err != nil {
+		return err
+	}
+
+	return w.client.PublishBuildLogEntry(string(jsonData))
+}
+
 // ErrResponse returns an error that occurred from Docker and then calls
 // ResetError().
 func (w *DockerRPCWriter) ErrResponse() (error, bool) {
@@ -129,39 +202,53 @@ func (w *DockerRPCWriter) ResetError() {
 	w.errResponse = nil
 }
 
+// filter throttles the progress messages of each layer, so that large pulls
+// and pushes don't flood the build logs.
 type filter struct {
-	lastSent *Response
+	// lastSent is the last progress message sent for each layer and status.
+	lastSent map[string]sentProgress
+	// now returns the current time, and is replaced in tests.
+	now func() time.Time
 }
 
-func (f filter) shouldSkip(resp *Response) bool {
-	if f.lastSent == nil {
-		f.lastSent = resp
+type sentProgress struct {
+	current int
+	at      time.Time
+}
+
+// shouldSkip returns whether the message is progress that doesn't need to be
+// sent. A layer's first progress message with a status, and the message that
+// completes it, are always sent. Others are sent once the layer has progressed
+// by minProgressDelta, but at most every minProgressInterval, and at least
+// every maxProgressInterval.
+func (f *filter) shouldSkip(resp *Response) bool {
+	if !progressStatuses[resp.Status] {
 		return false
 	}
 
-	// Don't send the response if it hasn't transfered the minimum amount across
-	// the docker socket.
-	if resp.Status == bufferingStatus && f.lastSent.Status == bufferingStatus {
-		switch {
-		case resp.ProgressDetail.Current < f.lastSent.ProgressDetail.Current+minProgressDelta:
-			return true
-		default:
-			return false
-		}
+	now := time.Now()
+	if f.now != nil {
+		now = f.now()
+	}
+	if f.lastSent == nil {
+		f.lastSent = map[string]sentProgress{}
 	}
 
-	// Don't send the push response unless it has pushed more than the minimum.
-	if resp.Status == pushingStatus && f.lastSent.Status == pushingStatus {
-		switch {
-		case resp.ProgressDetail.Current == f.lastSent.ProgressDetail.Total:
-			// Always send the final response.
-			return false
-		case resp.ProgressDetail.Current < f.lastSent.ProgressDetail.Current+minProgressDelta:
+	key := resp.ID + "/" + resp.Status
+	current := resp.ProgressDetail.Current
+	last, sent := f.lastSent[key]
+
+	finished := resp.ProgressDetail.Total > 0 && current >= resp.ProgressDetail.Total
+	if sent && !finished {
+		elapsed := now.Sub(last.at)
+		if elapsed < minProgressInterval {
+			return true
+		}
+		if current < last.current+minProgressDelta && elapsed < maxProgressInterval {
 			return true
-		default:
-			return false
 		}
 	}
 
+	f.lastSent[key] = sentProgress{current: current, at: now}
 	return false
 }
@@ -1,73 +1,241 @@
 package dockerfile
 
 import (
-	"io/ioutil"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
-	"github.com/docker/docker/pkg/archive"
-	"github.com/docker/docker/pkg/tarsum"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/quay/quay-builder/rpc"
 )
 
-const unix1980 int64 = 315532800
+// contextDigestVersion is included in every context digest, so that changing
+// what is hashed never produces a digest that matches an older one.
+const contextDigestVersion = 2
+
+// contextDigestHeader is the first record hashed by ContextDigest.
+type contextDigestHeader struct {
+	Version    int               `json:"version"`
+	Dockerfile string            `json:"dockerfile"`
+	BuildArgs  map[string]string `json:"build_args,omitempty"`
+}
+
+// contextDigestEntry is the record hashed for each file in the build context.
+type contextDigestEntry struct {
+	Path   string      `json:"path"`
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size,omitempty"`
+	Link   string      `json:"link,omitempty"`
+	Digest string      `json:"digest,omitempty"`
+}
+
+// ContextDigest computes a stable digest of the effective build context (after
+// applying the first of ignoreFiles found), the name of the Dockerfile and the
+// build args passed to the build. Only the paths, types, permissions and
+// contents of the files are included, so the digest doesn't change when the
+// same sources are extracted again at a different time or by a different user.
+func ContextDigest(buildContextDirectory, dockerfileName string, ignoreFiles []string, buildArgs map[string]string) (digest.Digest, error) {
+	digester := digest.Canonical.Digester()
+	enc := json.NewEncoder(digester.Hash())
 
-// loadBuildContext loads the build context into a tarsum.
-func loadBuildContext(buildContextDirectory string) (tarsum.TarSum, error) {
-	// Zero out mtimes so that they don't effect the outcome of our tarsum.
-	err := chtimesDir(buildContextDirectory)
+	// encoding/json sorts the keys of maps, so the build args are hashed in a
+	// stable order.
+	err := enc.Encode(contextDigestHeader{
+		Version:    contextDigestVersion,
+		Dockerfile: filepath.ToSlash(filepath.Clean(dockerfileName)),
+		BuildArgs:  buildArgs,
+	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	// Compress our build context directory into a tar.
-	tarred, err := archive.Tar(buildContextDirectory, archive.Uncompressed)
+	_, err = WalkContext(buildContextDirectory, dockerfileName, ignoreFiles, func(relPath string, info os.FileInfo) error {
+		entry := contextDigestEntry{
+			Path: filepath.ToSlash(relPath),
+			Mode: info.Mode() & (os.ModeType | os.ModePerm),
+		}
+
+		switch {
+		case info.Mode().IsRegular():
+			d, err := fileDigest(filepath.Join(buildContextDirectory, relPath))
+			if err != nil {
+				return err
+			}
+			entry.Size, entry.Digest = info.Size(), d.String()
+
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(filepath.Join(buildContextDirectory, relPath))
+			if err != nil {
+				return err
+			}
+			entry.Link = link
+		}
+
+		return enc.Encode(entry)
+	})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	// Create a tarsum of the tar.
-	buildContext, err := tarsum.NewTarSum(tarred, true, tarsum.Version0)
+	return digester.Digest(), nil
+}
+
+// fileDigest computes the digest of the contents of the file at path.
+func fileDigest(path string) (digest.Digest, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	defer f.Close()
+
+	return digest.Canonical.FromReader(f)
+}
+
+// SetTimestamps walks a directory and sets the atime and mtime of everything in
+// it to t, so that the files copied into an image don't depend on when the
+// build package was extracted. Symlinks are left alone, as changing their
+// times would change the times of their targets instead.
+func SetTimestamps(root string, t time.Time) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		return os.Chtimes(path, t, t)
+	})
+}
+
+var (
+	// DockerIgnoreFiles are the files, relative to the root of the build
+	// context, that Docker excludes files from the context with.
+	DockerIgnoreFiles = []string{".dockerignore"}
 
-	// Create a temporary directory.
-	tmpdirPath, err := ioutil.TempDir("", "docker-build")
+	// PodmanIgnoreFiles are the files that Podman excludes files from the
+	// context with, in order of precedence.
+	PodmanIgnoreFiles = []string{".containerignore", ".dockerignore"}
+)
+
+// ContextStats describes the files that are sent to the container runtime as
+// the build context.
+type ContextStats struct {
+	// Files is the number of files (of any type) in the context.
+	Files int
+	// Size is the total size of the regular files in the context.
+	Size int64
+	// IgnoreFile is the ignore file that was applied, if any.
+	IgnoreFile string
+}
+
+// WalkContext calls walkFn with the path (relative to buildContextDirectory)
+// of every file and directory that is part of the effective build context, in
+// lexical order. Files are excluded by the first of ignoreFiles found, except
+// for the Dockerfile and the ignore file themselves, which are always sent. It
+// returns the name of the ignore file that was applied, if any.
+func WalkContext(buildContextDirectory, dockerfileName string, ignoreFiles []string, walkFn func(relPath string, info os.FileInfo) error) (string, error) {
+	patterns, ignoreFile, err := readIgnorePatterns(buildContextDirectory, ignoreFiles)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer os.RemoveAll(tmpdirPath)
 
-	// Extract the tar to the temporary directory.
-	// This is required in order for the tarsum to be calculated.
-	if err := archive.Untar(buildContext, tmpdirPath, nil); err != nil {
-		return nil, err
+	pm, err := patternmatcher.New(patterns)
+	if err != nil {
+		return "", rpc.InvalidDockerfileError{Err: fmt.Sprintf("Invalid pattern in %s: %s", ignoreFile, err)}
 	}
 
-	return buildContext, nil
-}
+	alwaysIncluded := map[string]bool{filepath.Clean(dockerfileName): true}
+	if ignoreFile != "" {
+		alwaysIncluded[ignoreFile] = true
+	}
 
-// chtimesDir walks a directory and sets the atime and mtime to 1 Jan 1980 --
-// the earliest timestamp supported by zip.
-func chtimesDir(root string) error {
-	return filepath.Walk(root, walkFunc)
+	// The results of matching each directory are kept, so that the files in
+	// it are matched without matching the directory again.
+	dirMatches := map[string]patternmatcher.MatchInfo{}
+
+	return ignoreFile, filepath.Walk(buildContextDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(buildContextDirectory, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+
+		if !alwaysIncluded[relPath] && len(patterns) > 0 {
+			excluded, matchInfo, err := pm.MatchesUsingParentResults(filepath.ToSlash(relPath), dirMatches[filepath.Dir(relPath)])
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				dirMatches[relPath] = matchInfo
+			}
+			if excluded {
+				// Nothing inside an excluded directory can be included again
+				// unless there are exception patterns.
+				if info.IsDir() && !pm.Exclusions() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		return walkFn(relPath, info)
+	})
 }
 
-func walkFunc(path string, info os.FileInfo, err error) error {
-	// This handles any errors we got walking the filesystem.
+// MeasureContext counts the files in the effective build context and their
+// total size.
+func MeasureContext(buildContextDirectory, dockerfileName string, ignoreFiles []string) (*ContextStats, error) {
+	stats := &ContextStats{}
+
+	ignoreFile, err := WalkContext(buildContextDirectory, dockerfileName, ignoreFiles, func(relPath string, info os.FileInfo) error {
+		if info.IsDir() {
+			return nil
+		}
+
+		stats.Files++
+		if info.Mode().IsRegular() {
+			stats.Size += info.Size()
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	stats.IgnoreFile = ignoreFile
+
+	return stats, nil
+}
 
-	err = os.Chtimes(path, time.Unix(unix1980, 0), time.Unix(unix1980, 0))
+// readIgnorePatterns reads the patterns from the first of ignoreFiles found at
+// the root of the build context.
+func readIgnorePatterns(buildContextDirectory string, ignoreFiles []string) ([]string, string, error) {
+	for _, name := range ignoreFiles {
+		f, err := os.Open(filepath.Join(buildContextDirectory, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
 
-	// If we can't find the file we just walked to, it's a broken symlink.
-	// Just ignore these.
-	if err != nil && strings.Contains(err.Error(), "no such file or directory") {
-		err = nil
+		patterns, err := ignorefile.ReadAll(f)
+		if err != nil {
+			return nil, "", rpc.InvalidDockerfileError{Err: fmt.Sprintf("Could not read %s: %s", name, err)}
+		}
+		return patterns, name, nil
 	}
 
-	return err
+	return nil, "", nil
 }
@@ -2,7 +2,9 @@ package dockerfile
 
 import (
 	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -23,3 +25,174 @@ func TestWalkFunc(t *testing.T) {
 		}
 	}
 }
+
+func TestMeasureContext(t *testing.T) {
+	table := []struct {
+		name           string
+		files          map[string]string
+		ignoreFiles    []string
+		expectedFiles  int
+		expectedSize   int64
+		expectedIgnore string
+	}{
+		{
+			"no ignore file",
+			map[string]string{"Dockerfile": "FROM scratch", "src/main.go": "package main"},
+			DockerIgnoreFiles,
+			2, 24, "",
+		},
+		{
+			"excluded directory",
+			map[string]string{
+				"Dockerfile":        "FROM scratch",
+				".dockerignore":     "node_modules\n*.log",
+				"app.js":            "1234",
+				"debug.log":         "12345678",
+				"node_modules/a.js": "12345678",
+			},
+			DockerIgnoreFiles,
+			3, 34, ".dockerignore",
+		},
+		{
+			"exceptions and an ignored Dockerfile",
+			map[string]string{
+				"Dockerfile":    "FROM scratch",
+				".dockerignore": "*\n!keep.txt",
+				"keep.txt":      "12",
+				"drop.txt":      "12345678",
+			},
+			DockerIgnoreFiles,
+			3, 25, ".dockerignore",
+		},
+		{
+			"exceptions in an excluded directory",
+			map[string]string{
+				"Dockerfile":     "FROM scratch",
+				".dockerignore":  "src\n!src/keep/*.go",
+				"src/drop.go":    "12345678",
+				"src/keep/a.go":  "12",
+				"src/keep/b.txt": "12345678",
+				"other/c.go":     "1234",
+			},
+			DockerIgnoreFiles,
+			4, 36, ".dockerignore",
+		},
+		{
+			".containerignore takes precedence for Podman",
+			map[string]string{
+				"Dockerfile":       "FROM scratch",
+				".containerignore": "a.txt",
+				".dockerignore":    "b.txt",
+				"a.txt":            "1",
+				"b.txt":            "2",
+			},
+			PodmanIgnoreFiles,
+			4, 23, ".containerignore",
+		},
+		{
+			".containerignore is not read by Docker",
+			map[string]string{
+				"Dockerfile":       "FROM scratch",
+				".containerignore": "a.txt",
+				".dockerignore":    "b.txt",
+				"a.txt":            "1",
+				"b.txt":            "2",
+			},
+			DockerIgnoreFiles,
+			4, 23, ".dockerignore",
+		},
+	}
+
+	for _, tt := range table {
+		dir := t.TempDir()
+		for name, contents := range tt.files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		stats, err := MeasureContext(dir, "Dockerfile", tt.ignoreFiles)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if stats.Files != tt.expectedFiles || stats.Size != tt.expectedSize || stats.IgnoreFile != tt.expectedIgnore {
+			t.Errorf("%s: got %+v, wanted %d files, %d bytes, ignore file %q", tt.name, stats, tt.expectedFiles, tt.expectedSize, tt.expectedIgnore)
+		}
+	}
+}
+
+func TestContextDigest(t *testing.T) {
+	writeContext := func(files map[string]string) string {
+		dir := t.TempDir()
+		for name, contents := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+
+	files := map[string]string{
+		"Dockerfile":    "FROM scratch\nCOPY . /",
+		".dockerignore": "*.log",
+		"src/main.go":   "package main",
+	}
+	base := writeContext(files)
+	expected, err := ContextDigest(base, "Dockerfile", DockerIgnoreFiles, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same sources extracted at a different time hash the same, even with
+	// changes to ignored files.
+	same := writeContext(files)
+	if err := ioutil.WriteFile(filepath.Join(same, "debug.log"), []byte("ignored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := chtimesDir(same); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ContextDigest(same, "Dockerfile", DockerIgnoreFiles, nil); err != nil || got != expected {
+		t.Errorf("expected an identical context to hash to %s, got: %s (%v)", expected, got, err)
+	}
+
+	changedContents := writeContext(files)
+	if err := ioutil.WriteFile(filepath.Join(changedContents, "src/main.go"), []byte("package other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changedMode := writeContext(files)
+	if err := os.Chmod(filepath.Join(changedMode, "src/main.go"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		name       string
+		dir        string
+		dockerfile string
+		buildArgs  map[string]string
+	}{
+		{"contents", changedContents, "Dockerfile", nil},
+		{"mode", changedMode, "Dockerfile", nil},
+		{"dockerfile", base, "src/../Dockerfile.other", nil},
+		{"build args", base, "Dockerfile", map[string]string{"SOURCE_DATE_EPOCH": "0"}},
+	}
+
+	for _, tt := range table {
+		got, err := ContextDigest(tt.dir, tt.dockerfile, DockerIgnoreFiles, tt.buildArgs)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		} else if got == expected {
+			t.Errorf("%s: expected a change to alter the digest", tt.name)
+		}
+	}
+}
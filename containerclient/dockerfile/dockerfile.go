@@ -1,17 +1,20 @@
 package dockerfile
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/distribution/reference"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/moby/buildkit/frontend/dockerfile/instructions"
-	"github.com/moby/buildkit/frontend/dockerfile/linter"
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
 	"github.com/moby/buildkit/frontend/dockerfile/shell"
 
@@ -45,6 +48,51 @@ var (
 type Metadata struct {
 	BaseImage    string
 	BaseImageTag string
+
+	// BaseImages are the images that the stages of the Dockerfile are built
+	// on, other than scratch and earlier stages, with build args expanded.
+	// Base images that depend on build args without a default are left as
+	// written.
+	BaseImages []string
+
+	// CopiedImages are the images, rather than earlier stages, that files are
+	// copied from with COPY --from or mounted from with RUN --mount=from=.
+	CopiedImages []string
+
+	// Syntax is the frontend image named by a "# syntax=" directive, if any.
+	Syntax string
+
+	// EscapeToken is the escape character, which is set with a "# escape="
+	// directive and is otherwise a backslash.
+	EscapeToken rune
+
+	// LintWarnings are the problems found by linting the Dockerfile, in the
+	// order of the lines they were found on.
+	LintWarnings []LintWarning
+
+	// lintErrors is set when the Dockerfile asks for lint warnings to be
+	// treated as errors, with a "# check=error=true" directive.
+	lintErrors bool
+}
+
+// LintError returns an InvalidDockerfileError naming the rules that were
+// violated if the Dockerfile has any lint warnings and either strict is set or
+// the Dockerfile asks for warnings to be treated as errors.
+func (m *Metadata) LintError(strict bool) error {
+	if len(m.LintWarnings) == 0 || !(strict || m.lintErrors) {
+		return nil
+	}
+
+	var rules []string
+	seen := map[string]bool{}
+	for _, w := range m.LintWarnings {
+		if !seen[w.Rule] {
+			seen[w.Rule] = true
+			rules = append(rules, w.Rule)
+		}
+	}
+
+	return rpc.InvalidDockerfileError{Err: fmt.Sprintf("Dockerfile has lint warnings: %s", strings.Join(rules, ", "))}
 }
 
 type envGetter struct {
@@ -71,14 +119,19 @@ func (e *envGetter) Keys() []string {
 func NewMetadataFromReader(r io.Reader, buildContextDirectory string) (*Metadata, error) {
 	var imageAndTag string
 
+	dt, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, ErrInvalidDockerfile
+	}
+
 	// Parse the Dockerfile.
-	parsed, err := parser.Parse(bufio.NewReader(r))
+	parsed, err := parser.Parse(bytes.NewReader(dt))
 	if err != nil {
 		log.Errorf("Could not parse Dockerfile: %v", err)
 		if strings.Contains(err.Error(), "file with no instructions") {
 			return nil, ErrEmptyDockerfile
 		}
-		return nil, ErrInvalidDockerfile
+		return nil, parseError(err, dt)
 	}
 
 	ast := parsed.AST
@@ -93,8 +146,17 @@ func NewMetadataFromReader(r io.Reader, buildContextDirectory string) (*Metadata
 		return nil, ErrDockerfileMissingFROMorARG
 	}
 
-	linter := linter.New(&linter.Config{})
-	stages, metaArgs, _ := instructions.Parse(ast, linter)
+	var lintWarnings []LintWarning
+	lint, err := newLinter(dt, &lintWarnings)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, metaArgs, err := instructions.Parse(ast, lint)
+	if err != nil {
+		log.Errorf("Could not parse Dockerfile: %v", err)
+		return nil, parseError(err, dt)
+	}
 	envGetter := &envGetter{env: map[string]string{}, keys: []string{}}
 	if first_cmd == "arg" {
 		for _, metaArg := range metaArgs {
@@ -134,12 +196,187 @@ func NewMetadataFromReader(r io.Reader, buildContextDirectory string) (*Metadata
 		tag = "latest"
 	}
 
+	images := externalBaseImages(shell.NewLex(parsed.EscapeToken), stages, envGetter)
+	var baseImages []string
+	for _, image := range images {
+		baseImages = append(baseImages, image.name)
+	}
+
+	lintDockerfile(lint, parsed, stages, images)
+	sortLintWarnings(lintWarnings)
+
+	syntax, _, _, _ := parser.DetectSyntax(dt)
+
 	return &Metadata{
 		BaseImage:    image,
 		BaseImageTag: tag,
+		BaseImages:   baseImages,
+		CopiedImages: copiedImages(stages),
+		Syntax:       syntax,
+		EscapeToken:  parsed.EscapeToken,
+		LintWarnings: lintWarnings,
+		lintErrors:   lint.ReturnAsError,
 	}, nil
 }
 
+// baseImage is an image, rather than an earlier stage, that a stage of a
+// Dockerfile is built on.
+type baseImage struct {
+	name     string
+	location []parser.Range
+	// resolved is false if the name refers to build args that have no
+	// default, in which case it is left unexpanded.
+	resolved bool
+}
+
+// externalBaseImages returns the images the stages are built on, skipping
+// scratch and stages built on earlier stages.
+func externalBaseImages(shlex *shell.Lex, stages []instructions.Stage, env *envGetter) []baseImage {
+	var images []baseImage
+	stageNames := map[string]bool{}
+	for _, stage := range stages {
+		image := baseImage{name: stage.BaseName, location: stage.Location}
+		name, unmatched, err := shlex.ProcessWord(stage.BaseName, env)
+		if err == nil && len(unmatched) == 0 {
+			image.name, image.resolved = name, true
+		}
+
+		if !stageNames[strings.ToLower(image.name)] && image.name != "scratch" {
+			images = append(images, image)
+		}
+		if stage.Name != "" {
+			stageNames[strings.ToLower(stage.Name)] = true
+		}
+	}
+
+	return images
+}
+
+// copiedImages returns the images named by COPY --from and by the mounts of
+// RUN --mount, skipping references to stages by name or index. Unlike FROM,
+// these don't expand build args.
+func copiedImages(stages []instructions.Stage) []string {
+	stageNames := map[string]bool{}
+	for _, stage := range stages {
+		if stage.Name != "" {
+			stageNames[strings.ToLower(stage.Name)] = true
+		}
+	}
+
+	var images []string
+	add := func(from string) {
+		if from == "" {
+			return
+		}
+		if _, err := strconv.Atoi(from); err == nil || stageNames[strings.ToLower(from)] {
+			return
+		}
+		images = append(images, from)
+	}
+
+	for _, stage := range stages {
+		for _, cmd := range stage.Commands {
+			switch cmd := cmd.(type) {
+			case *instructions.CopyCommand:
+				add(cmd.From)
+			case *instructions.RunCommand:
+				for _, mount := range instructions.GetMounts(cmd) {
+					add(mount.From)
+				}
+			}
+		}
+	}
+
+	return images
+}
+
+// sourceContextLines is the number of lines of the Dockerfile shown before and
+// after the line that caused a parse error.
+const sourceContextLines = 2
+
+// parseError converts an error from parsing the Dockerfile (dt) into an
+// InvalidDockerfileError describing the line that caused it, if the parser
+// reported one.
+func parseError(err error, dt []byte) error {
+	lines := strings.Split(string(dt), "\n")
+
+	var start, end int
+	var locErr *parser.LocationError
+	if errors.As(err, &locErr) && len(locErr.Locations) > 0 && len(locErr.Locations[0]) > 0 {
+		location := locErr.Locations[0]
+		start, end = location[0].Start.Line, location[len(location)-1].End.Line
+	}
+	if start < 1 || start > len(lines) {
+		return rpc.InvalidDockerfileError{
+			Err:     fmt.Sprintf("%s: %s", ErrInvalidDockerfile.Err, err),
+			Message: err.Error(),
+		}
+	}
+	if end < start || end > len(lines) {
+		end = start
+	}
+
+	var instruction string
+	if fields := strings.Fields(lines[start-1]); len(fields) > 0 {
+		instruction = strings.ToUpper(fields[0])
+	}
+
+	// Show the offending lines marked with ">>>", along with a few lines on
+	// either side.
+	var source strings.Builder
+	first, last := start-sourceContextLines, end+sourceContextLines
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(strconv.Itoa(last))
+	for i := first; i <= last; i++ {
+		marker := "   "
+		if i >= start && i <= end {
+			marker = ">>>"
+		}
+		fmt.Fprintf(&source, "%*d | %s %s\n", width, i, marker, strings.TrimRight(lines[i-1], "\r"))
+	}
+
+	message := locErr.Unwrap().Error()
+	return rpc.InvalidDockerfileError{
+		Err:         fmt.Sprintf("%s: line %d: %s", ErrInvalidDockerfile.Err, start, message),
+		Line:        start,
+		Instruction: instruction,
+		Message:     message,
+		Source:      source.String(),
+	}
+}
+
+// containerfileName is the name used for Dockerfiles meant for Podman and
+// Buildah, which Docker also accepts when given the name explicitly.
+const containerfileName = "Containerfile"
+
+// FindDockerfile returns the path, relative to buildContextDirectory, of the
+// Dockerfile to build. If dockerfilePath doesn't exist, or is empty, and names
+// the default Dockerfile, a Containerfile in the same directory is used
+// instead.
+func FindDockerfile(buildContextDirectory, dockerfilePath string) (string, error) {
+	if dockerfilePath == "" {
+		dockerfilePath = "Dockerfile"
+	}
+
+	if _, err := os.Stat(path.Join(buildContextDirectory, dockerfilePath)); err == nil {
+		return dockerfilePath, nil
+	}
+
+	if path.Base(dockerfilePath) == "Dockerfile" {
+		containerfilePath := path.Join(path.Dir(dockerfilePath), containerfileName)
+		if _, err := os.Stat(path.Join(buildContextDirectory, containerfilePath)); err == nil {
+			return containerfilePath, nil
+		}
+	}
+
+	return "", ErrMissingDockerfile
+}
+
 // NewMetadataFromDir parses a Dockerfile located within the provided directory
 // and generates metadata based on the contents.
 func NewMetadataFromDir(buildContextDirectory, dockerfileName string) (*Metadata, error) {
@@ -2,7 +2,15 @@ package dockerfile
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/quay/quay-builder/rpc"
 )
 
 func TestNewMetadataFailures(t *testing.T) {
@@ -112,13 +120,330 @@ func TestValidParsing(t *testing.T) {
 		}
 
 		if m.BaseImage != tt.expectedMetadata.BaseImage {
-			t.Fatalf("unexpected metadata: got: %s. expected: %s", m, tt.expectedMetadata)
+			t.Fatalf("unexpected metadata: got: %+v. expected: %+v", m, tt.expectedMetadata)
 			continue
 		}
 
 		if m.BaseImageTag != tt.expectedMetadata.BaseImageTag {
-			t.Fatalf("unexpected metadata: got: %s. expected: %s", m, tt.expectedMetadata)
+			t.Fatalf("unexpected metadata: got: %+v. expected: %+v", m, tt.expectedMetadata)
 			continue
 		}
 	}
 }
+
+func TestLintWarnings(t *testing.T) {
+	var table = []struct {
+		name       string
+		dockerfile string
+		expected   []string
+		strict     bool
+		expectErr  bool
+	}{
+		{
+			"clean",
+			"FROM alpine:3.20\nUSER nobody\nCMD [\"true\"]",
+			nil,
+			true,
+			false,
+		},
+		{
+			"latest and untagged base images",
+			"FROM alpine AS build\nFROM alpine:latest\nCOPY --from=build / /\nUSER 1000",
+			[]string{"1:LatestBaseImage", "2:LatestBaseImage"},
+			false,
+			false,
+		},
+		{
+			"base image from a global ARG",
+			"ARG TAG=latest\nFROM alpine:$TAG\nUSER nobody",
+			[]string{"2:LatestBaseImage"},
+			false,
+			false,
+		},
+		{
+			"no USER",
+			"FROM alpine:3.20\nRUN true",
+			[]string{"1:RootUser"},
+			false,
+			false,
+		},
+		{
+			"root USER",
+			"FROM alpine:3.20\nUSER root:root",
+			[]string{"2:RootUser"},
+			false,
+			false,
+		},
+		{
+			"USER inherited from an earlier stage",
+			"FROM alpine:3.20 AS base\nUSER nobody\nFROM base",
+			nil,
+			false,
+			false,
+		},
+		{
+			"root USER inherited from an earlier stage",
+			"FROM alpine:3.20 AS base\nUSER 0\nFROM base\nRUN true",
+			[]string{"2:RootUser"},
+			false,
+			false,
+		},
+		{
+			"buildkit rules",
+			"FROM alpine:3.20 AS Build\nMAINTAINER me\nworkdir app\nCMD true\nCMD false\nUSER nobody",
+			[]string{"1:StageNameCasing", "2:MaintainerDeprecated", "3:ConsistentInstructionCasing", "3:WorkdirRelativePath", "4:JSONArgsRecommended", "4:MultipleInstructionsDisallowed", "5:JSONArgsRecommended"},
+			false,
+			false,
+		},
+		{
+			"duplicate and reserved stage names",
+			"FROM alpine:3.20 AS a\nFROM alpine:3.20 AS a\nFROM alpine:3.20 AS context\nUSER nobody",
+			[]string{"2:DuplicateStageName", "3:ReservedStageName"},
+			false,
+			false,
+		},
+		{
+			"empty continuation line",
+			"FROM alpine:3.20\nRUN echo \\\n\n  hello\nUSER nobody",
+			[]string{"4:NoEmptyContinuation"},
+			false,
+			false,
+		},
+		{
+			"rules skipped by check directive",
+			"# check=skip=RootUser,LatestBaseImage\nFROM alpine",
+			nil,
+			true,
+			false,
+		},
+		{
+			"strict",
+			"FROM alpine\nUSER root",
+			[]string{"1:LatestBaseImage", "2:RootUser"},
+			true,
+			true,
+		},
+		{
+			"strict without USER",
+			"FROM alpine",
+			[]string{"1:LatestBaseImage", "1:RootUser"},
+			true,
+			true,
+		},
+		{
+			"errors requested by check directive",
+			"# check=error=true\nFROM alpine:3.20\nUSER root",
+			[]string{"3:RootUser"},
+			false,
+			true,
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMetadataFromReader(bytes.NewBufferString(tt.dockerfile), "testdata")
+			if err != nil {
+				t.Fatalf("unexpected error: got: %s", err)
+			}
+
+			var warnings []string
+			for _, w := range m.LintWarnings {
+				warnings = append(warnings, fmt.Sprintf("%d:%s", w.Line, w.Rule))
+			}
+			if !reflect.DeepEqual(warnings, tt.expected) {
+				t.Fatalf("unexpected warnings: got: %v wanted: %v", warnings, tt.expected)
+			}
+
+			if err := m.LintError(tt.strict); (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected lint error: got: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var table = []struct {
+		name        string
+		dockerfile  string
+		line        int
+		instruction string
+		message     string
+		source      string
+	}{
+		{
+			"unknown instruction",
+			"FROM alpine:3.20\nRUN true\nFOO bar\nRUN false\nUSER nobody\nCMD [\"true\"]",
+			3,
+			"FOO",
+			"unknown instruction: FOO",
+			"1 |     FROM alpine:3.20\n2 |     RUN true\n3 | >>> FOO bar\n4 |     RUN false\n5 |     USER nobody\n",
+		},
+		{
+			"unknown flag",
+			"FROM alpine:3.20\nrun --bad true",
+			2,
+			"RUN",
+			"unknown flag: --bad",
+			"1 |     FROM alpine:3.20\n2 | >>> run --bad true\n",
+		},
+		{
+			"unterminated heredoc",
+			"FROM alpine:3.20\nRUN <<EOF\ntrue",
+			2,
+			"RUN",
+			"unterminated heredoc",
+			"1 |     FROM alpine:3.20\n2 | >>> RUN <<EOF\n3 | >>> true\n",
+		},
+		{
+			"wrong number of arguments to FROM",
+			"ARG TAG=3.20\nFROM alpine:$TAG AS build extra",
+			2,
+			"FROM",
+			"FROM requires either one or three arguments",
+			"1 |     ARG TAG=3.20\n2 | >>> FROM alpine:$TAG AS build extra\n",
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMetadataFromReader(bytes.NewBufferString(tt.dockerfile), "testdata")
+			dockerfileErr, ok := err.(rpc.InvalidDockerfileError)
+			if !ok {
+				t.Fatalf("unexpected error: got: %v", err)
+			}
+
+			if dockerfileErr.Line != tt.line || dockerfileErr.Instruction != tt.instruction {
+				t.Fatalf("unexpected location: got: %d %s wanted: %d %s", dockerfileErr.Line, dockerfileErr.Instruction, tt.line, tt.instruction)
+			}
+			if !strings.HasPrefix(dockerfileErr.Message, tt.message) {
+				t.Fatalf("unexpected message: got: %q wanted: %q", dockerfileErr.Message, tt.message)
+			}
+			if dockerfileErr.Source != tt.source {
+				t.Fatalf("unexpected source: got:\n%s\nwanted:\n%s", dockerfileErr.Source, tt.source)
+			}
+		})
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	var table = []struct {
+		name           string
+		dockerfile     string
+		expectedSyntax string
+		expectedEscape rune
+	}{
+		{"none", "FROM alpine:3.20", "", '\\'},
+		{"syntax", "# syntax=docker/dockerfile:1.7\nFROM alpine:3.20", "docker/dockerfile:1.7", '\\'},
+		{"escape", "# escape=`\nFROM alpine:3.20\nRUN echo `\n  hello", "", '`'},
+		{
+			"syntax and escape",
+			"# syntax = docker.io/docker/dockerfile@sha256:4c68376a702446fc3c79af22de146a148bc3367e73c25a5803d453b6b3f722fb\n# escape=`\nFROM alpine:3.20",
+			"docker.io/docker/dockerfile@sha256:4c68376a702446fc3c79af22de146a148bc3367e73c25a5803d453b6b3f722fb",
+			'`',
+		},
+		{"not a directive after an instruction", "FROM alpine:3.20\n# syntax=docker/dockerfile:1", "", '\\'},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMetadataFromReader(bytes.NewBufferString(tt.dockerfile), "testdata")
+			if err != nil {
+				t.Fatalf("unexpected error: got: %s", err)
+			}
+			if m.Syntax != tt.expectedSyntax || m.EscapeToken != tt.expectedEscape {
+				t.Fatalf("unexpected directives: got: %q %q wanted: %q %q", m.Syntax, m.EscapeToken, tt.expectedSyntax, tt.expectedEscape)
+			}
+		})
+	}
+}
+
+func TestFindDockerfile(t *testing.T) {
+	var table = []struct {
+		name           string
+		files          []string
+		dockerfilePath string
+		expectedPath   string
+		expectedErr    error
+	}{
+		{"Dockerfile", []string{"Dockerfile", "Containerfile"}, "Dockerfile", "Dockerfile", nil},
+		{"Containerfile", []string{"Containerfile"}, "Dockerfile", "Containerfile", nil},
+		{"default name", []string{"Containerfile"}, "", "Containerfile", nil},
+		{"subdirectory", []string{"app/Containerfile"}, "app/Dockerfile", "app/Containerfile", nil},
+		{"custom name", []string{"Dockerfile.prod"}, "Dockerfile.prod", "Dockerfile.prod", nil},
+		{"custom name is not replaced", []string{"Containerfile"}, "Dockerfile.prod", "", ErrMissingDockerfile},
+		{"missing", nil, "Dockerfile", "", ErrMissingDockerfile},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(path, []byte("FROM scratch"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path, err := FindDockerfile(dir, tt.dockerfilePath)
+			if path != tt.expectedPath || err != tt.expectedErr {
+				t.Fatalf("unexpected result: got: %q, %v wanted: %q, %v", path, err, tt.expectedPath, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestBaseImages(t *testing.T) {
+	var table = []struct {
+		dockerfile string
+		expected   []string
+	}{
+		{"FROM alpine:3.20", []string{"alpine:3.20"}},
+		{"FROM scratch", nil},
+		{
+			"ARG BASE=quay.io/myorg/base\nARG TAG\nFROM $BASE:1.0 AS build\nFROM build\nFROM --platform=linux/amd64 golang:$TAG\nFROM scratch",
+			[]string{"quay.io/myorg/base:1.0", "golang:$TAG"},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.dockerfile, func(t *testing.T) {
+			m, err := NewMetadataFromReader(bytes.NewBufferString(tt.dockerfile), "testdata")
+			if err != nil {
+				t.Fatalf("unexpected error: got: %s", err)
+			}
+			if !reflect.DeepEqual(m.BaseImages, tt.expected) {
+				t.Fatalf("unexpected base images: got: %q wanted: %q", m.BaseImages, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCopiedImages(t *testing.T) {
+	var table = []struct {
+		dockerfile string
+		expected   []string
+	}{
+		{"FROM alpine\nCOPY . /src", nil},
+		{"FROM alpine AS build\nFROM alpine\nCOPY --from=build /out /out\nCOPY --from=0 /out /out", nil},
+		{"FROM alpine\nCOPY --from=quay.io/myorg/tools:1.0 /bin/tool /bin/tool", []string{"quay.io/myorg/tools:1.0"}},
+		{
+			"FROM alpine AS build\nFROM alpine\nRUN --mount=type=bind,from=quay.io/myorg/tools,target=/tools /tools/run\nRUN --mount=from=Build,target=/out ls /out\nRUN --mount=type=cache,from=busybox:1.36,target=/cache ls",
+			[]string{"quay.io/myorg/tools", "busybox:1.36"},
+		},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.dockerfile, func(t *testing.T) {
+			m, err := NewMetadataFromReader(bytes.NewBufferString(tt.dockerfile), "testdata")
+			if err != nil {
+				t.Fatalf("unexpected error: got: %s", err)
+			}
+			if !reflect.DeepEqual(m.CopiedImages, tt.expected) {
+				t.Fatalf("unexpected copied images: got: %q wanted: %q", m.CopiedImages, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package dockerfile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/linter"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+
+	"github.com/quay/quay-builder/rpc"
+)
+
+// LintWarning is a problem found in a Dockerfile that doesn't prevent it from
+// being built.
+type LintWarning struct {
+	Rule    string
+	Message string
+	URL     string
+	// Line is the line of the Dockerfile the problem was found on, or zero if
+	// it applies to the whole file.
+	Line int
+}
+
+func (w LintWarning) String() string {
+	if w.URL == "" {
+		return fmt.Sprintf("%s: %s", w.Rule, w.Message)
+	}
+	return fmt.Sprintf("%s: %s (%s)", w.Rule, w.Message, w.URL)
+}
+
+// Rules specific to images built by Quay, in addition to the ones from
+// buildkit.
+var (
+	ruleLatestBaseImage = linter.LinterRule[func(string) string]{
+		Name:        "LatestBaseImage",
+		Description: "Base images should be pinned to a specific tag or digest",
+		Format: func(image string) string {
+			return fmt.Sprintf("Base image %s uses the latest tag, so the build may change whenever it is updated", image)
+		},
+	}
+	ruleRootUser = linter.LinterRule[func(string) string]{
+		Name:        "RootUser",
+		Description: "The final stage should set a USER other than root",
+		Format: func(user string) string {
+			if user == "" {
+				return "No USER is set in the final stage, so containers run as the base image's user, which is usually root"
+			}
+			return fmt.Sprintf("USER %s runs containers as root", user)
+		},
+	}
+)
+
+// reservedStageNames are the names buildkit gives a special meaning to.
+var reservedStageNames = map[string]bool{
+	"context": true,
+	"scratch": true,
+}
+
+// newLinter returns a linter that appends the warnings it finds to warnings,
+// configured by any "# check=" directive in the Dockerfile (dt).
+func newLinter(dt []byte, warnings *[]LintWarning) (*linter.Linter, error) {
+	config := &linter.Config{}
+	if check, _, _, ok := parser.ParseDirective("check", dt); ok {
+		var err error
+		config, err = linter.ParseLintOptions(check)
+		if err != nil {
+			return nil, rpc.InvalidDockerfileError{Err: fmt.Sprintf("Invalid check directive: %s", err)}
+		}
+	}
+
+	config.Warn = func(rulename, description, url, fmtmsg string, location []parser.Range) {
+		w := LintWarning{Rule: rulename, Message: fmtmsg, URL: url}
+		if len(location) > 0 {
+			w.Line = location[0].Start.Line
+		}
+		*warnings = append(*warnings, w)
+	}
+
+	return linter.New(config), nil
+}
+
+// lintDockerfile runs the rules that buildkit only checks while converting a
+// Dockerfile to LLB, and Quay's own rules, over the parsed Dockerfile.
+func lintDockerfile(lint *linter.Linter, parsed *parser.Result, stages []instructions.Stage, images []baseImage) {
+	for _, w := range parsed.Warnings {
+		if w.URL == linter.RuleNoEmptyContinuation.URL && w.Location != nil {
+			lint.Run(&linter.RuleNoEmptyContinuation, []parser.Range{*w.Location}, linter.RuleNoEmptyContinuation.Format())
+		}
+	}
+
+	lintCommandCasing(lint, stages)
+	lintStageNames(lint, stages)
+
+	for _, stage := range stages {
+		lintStageCommands(lint, stage)
+	}
+	for _, image := range images {
+		lintBaseImage(lint, image)
+	}
+
+	if len(stages) > 0 {
+		lintFinalUser(lint, stages)
+	}
+}
+
+// lintCommandCasing reports instructions whose casing doesn't match the
+// majority of the instructions in the Dockerfile.
+func lintCommandCasing(lint *linter.Linter, stages []instructions.Stage) {
+	var lower, upper int
+	count := func(name string) {
+		switch name {
+		case strings.ToLower(name):
+			lower++
+		case strings.ToUpper(name):
+			upper++
+		}
+	}
+	for _, stage := range stages {
+		count(stage.OrigCmd)
+		for _, cmd := range stage.Commands {
+			count(cmd.Name())
+		}
+	}
+
+	check := func(name string, location []parser.Range) {
+		var casing string
+		if lower > upper && strings.ToLower(name) != name {
+			casing = "lowercase"
+		} else if lower <= upper && strings.ToUpper(name) != name {
+			casing = "uppercase"
+		}
+		if casing != "" {
+			lint.Run(&linter.RuleConsistentInstructionCasing, location, linter.RuleConsistentInstructionCasing.Format(name, casing))
+		}
+	}
+	for _, stage := range stages {
+		check(stage.OrigCmd, stage.Location)
+		for _, cmd := range stage.Commands {
+			check(cmd.Name(), cmd.Location())
+		}
+	}
+}
+
+// lintStageNames reports stages named after reserved words or after an earlier
+// stage.
+func lintStageNames(lint *linter.Linter, stages []instructions.Stage) {
+	seen := map[string]bool{}
+	for _, stage := range stages {
+		if stage.Name == "" {
+			continue
+		}
+		if reservedStageNames[stage.Name] {
+			lint.Run(&linter.RuleReservedStageName, stage.Location, linter.RuleReservedStageName.Format(stage.Name))
+		}
+		if seen[stage.Name] {
+			lint.Run(&linter.RuleDuplicateStageName, stage.Location, linter.RuleDuplicateStageName.Format(stage.Name))
+		}
+		seen[stage.Name] = true
+	}
+}
+
+// lintStageCommands reports problems with the instructions of a single stage.
+func lintStageCommands(lint *linter.Linter, stage instructions.Stage) {
+	// Only the last of each of these instructions has any effect.
+	used := map[string][]parser.Range{}
+	usedOnce := func(cmd instructions.Command) {
+		name := strings.ToLower(cmd.Name())
+		if previous, ok := used[name]; ok {
+			lint.Run(&linter.RuleMultipleInstructionsDisallowed, previous, linter.RuleMultipleInstructionsDisallowed.Format(cmd.Name()))
+		}
+		used[name] = cmd.Location()
+	}
+
+	var shellSet, workdirSet bool
+	for _, cmd := range stage.Commands {
+		switch c := cmd.(type) {
+		case *instructions.ShellCommand:
+			shellSet = true
+
+		case *instructions.WorkdirCommand:
+			// Only the first WORKDIR matters: fixing it fixes the rest.
+			if !workdirSet && !strings.HasPrefix(c.Path, "/") && !strings.HasPrefix(c.Path, "$") {
+				lint.Run(&linter.RuleWorkdirRelativePath, c.Location(), linter.RuleWorkdirRelativePath.Format(c.Path))
+			}
+			workdirSet = true
+
+		case *instructions.CmdCommand:
+			usedOnce(c)
+			if c.PrependShell && !shellSet {
+				lint.Run(&linter.RuleJSONArgsRecommended, c.Location(), linter.RuleJSONArgsRecommended.Format(c.Name()))
+			}
+
+		case *instructions.EntrypointCommand:
+			usedOnce(c)
+			if c.PrependShell && !shellSet {
+				lint.Run(&linter.RuleJSONArgsRecommended, c.Location(), linter.RuleJSONArgsRecommended.Format(c.Name()))
+			}
+
+		case *instructions.HealthCheckCommand:
+			usedOnce(c)
+		}
+	}
+}
+
+// lintBaseImage reports a base image that isn't pinned to a tag other than
+// latest or to a digest. Base images that can't be resolved without build
+// arguments are skipped.
+func lintBaseImage(lint *linter.Linter, image baseImage) {
+	if !image.resolved {
+		return
+	}
+
+	named, err := reference.ParseNormalizedNamed(image.name)
+	if err != nil {
+		return
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return
+	}
+	if tagged, ok := named.(reference.Tagged); ok && tagged.Tag() != "latest" {
+		return
+	}
+
+	lint.Run(&ruleLatestBaseImage, image.location, ruleLatestBaseImage.Format(image.name))
+}
+
+// lintFinalUser reports a final stage that runs as root, either because the
+// last USER set by it or the stages it is built on is root, or because none of
+// them set a USER. The user of a base image is unknown without pulling it, so
+// this is only ever a warning.
+func lintFinalUser(lint *linter.Linter, stages []instructions.Stage) {
+	final := stages[len(stages)-1]
+
+	var user *instructions.UserCommand
+	for i := len(stages) - 1; i >= 0 && user == nil; {
+		for _, cmd := range stages[i].Commands {
+			if c, ok := cmd.(*instructions.UserCommand); ok {
+				user = c
+			}
+		}
+
+		// Follow the stage this one is built on, if any.
+		base := strings.ToLower(stages[i].BaseName)
+		i--
+		for i >= 0 && strings.ToLower(stages[i].Name) != base {
+			i--
+		}
+	}
+
+	if user == nil {
+		lint.Run(&ruleRootUser, final.Location, ruleRootUser.Format(""))
+		return
+	}
+
+	name, _, _ := strings.Cut(user.User, ":")
+	if name == "root" || name == "0" {
+		lint.Run(&ruleRootUser, user.Location(), ruleRootUser.Format(user.User))
+	}
+}
+
+// sortLintWarnings orders warnings by the line they were found on.
+func sortLintWarnings(warnings []LintWarning) {
+	sort.SliceStable(warnings, func(i, j int) bool { return warnings[i].Line < warnings[j].Line })
+}
@@ -2,11 +2,16 @@ package dockerfile
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/pkg/tarsum"
 )
 
+const unix1980 int64 = 315532800
+
 var mobyHash string
 
 func TestMain(m *testing.M) {
@@ -22,3 +27,26 @@ func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+// chtimesDir walks a directory and sets the atime and mtime to 1 Jan 1980 --
+// the earliest timestamp supported by zip.
+func chtimesDir(root string) error {
+	return filepath.Walk(root, walkFunc)
+}
+
+func walkFunc(path string, info os.FileInfo, err error) error {
+	// This handles any errors we got walking the filesystem.
+	if err != nil {
+		return err
+	}
+
+	err = os.Chtimes(path, time.Unix(unix1980, 0), time.Unix(unix1980, 0))
+
+	// If we can't find the file we just walked to, it's a broken symlink.
+	// Just ignore these.
+	if err != nil && strings.Contains(err.Error(), "no such file or directory") {
+		err = nil
+	}
+
+	return err
+}
@@ -0,0 +1,203 @@
+package containerclient
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The types of the structured events that log entries are annotated with, so
+// that progress can be shown the same way whichever container runtime ran the
+// build.
+const (
+	// StepEvent is logged when a build step starts.
+	StepEvent = "step"
+	// CacheHitEvent is logged when a build step is reused from the cache.
+	CacheHitEvent = "cache_hit"
+	// LayerEvent is logged for the progress of pulling or pushing a layer.
+	LayerEvent = "layer"
+	// WarningEvent is logged for a warning from the runtime or the builder.
+	WarningEvent = "warning"
+)
+
+// Step identifies a step of a build.
+type Step struct {
+	Number      int    `json:"number"`
+	Total       int    `json:"total"`
+	Instruction string `json:"instruction,omitempty"`
+}
+
+// Layer is the progress of pulling or pushing a layer.
+type Layer struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Current int    `json:"current,omitempty"`
+	Total   int    `json:"total,omitempty"`
+	// Done is whether the layer has been pulled or pushed, or didn't need to
+	// be.
+	Done bool `json:"done,omitempty"`
+}
+
+var (
+	// stepPattern matches the start of a step, as logged by Docker
+	// ("Step 1/3 : FROM alpine") and Buildah ("STEP 1/3: FROM alpine").
+	stepPattern = regexp.MustCompile(`^(?i:step) (\d+)/(\d+)\s?: (.*)$`)
+	// cacheHitPattern matches a step being reused from the cache, as logged by
+	// Docker (" ---> Using cache") and Buildah ("--> Using cache 0123abcd").
+	cacheHitPattern = regexp.MustCompile(`^\s*-+> Using cache`)
+	// copyingBlobPattern matches the progress of a layer pulled by Buildah
+	// ("Copying blob 0123abcd done").
+	copyingBlobPattern = regexp.MustCompile(`^Copying blob (?:sha256:)?([0-9a-f]+)(.*)$`)
+
+	// buildKitLinePattern matches a line of the progress of a BuildKit build,
+	// which is prefixed with the number of the step it belongs to ("#5 ...").
+	buildKitLinePattern = regexp.MustCompile(`^#(\d+) (.*)$`)
+	// buildKitStepPattern matches the name of a BuildKit step that runs an
+	// instruction of the Dockerfile, which is numbered within its stage
+	// ("[2/3] RUN make" or "[build 2/3] RUN make").
+	buildKitStepPattern = regexp.MustCompile(`^\[(?:\S+ )?(\d+)/(\d+)\] (.*)$`)
+	// buildKitLayerPattern matches the progress of a layer pulled by BuildKit
+	// ("sha256:0123abcd 1.7MB / 3.4MB").
+	buildKitLayerPattern = regexp.MustCompile(`^sha256:([0-9a-f]+)\s*(.*)$`)
+)
+
+// layerStatuses are the statuses of the layers in Docker's pull and push
+// progress, and whether the layer is done.
+var layerStatuses = map[string]bool{
+	"Pulling fs layer":     false,
+	"Waiting":              false,
+	"Downloading":          false,
+	"Verifying Checksum":   false,
+	"Download complete":    false,
+	"Extracting":           false,
+	"Pull complete":        true,
+	"Already exists":       true,
+	"Preparing":            false,
+	"Pushing":              false,
+	"Pushed":               true,
+	"Layer already exists": true,
+}
+
+// eventParser annotates log entries with the events they describe. Cache hits
+// are only logged after the step they belong to, so it remembers the step
+// being run.
+type eventParser struct {
+	step *Step
+	// buildKitSteps are the steps of a BuildKit build, by the number prefixed
+	// to their lines. The steps that don't run instructions are nil.
+	buildKitSteps map[string]*Step
+}
+
+// annotate sets the type of the log entry, along with the step or layer it
+// describes, if it is an event.
+func (p *eventParser) annotate(m *Response) {
+	if m.ID != "" && m.Status != "" {
+		done, ok := layerStatuses[m.Status]
+		if !ok && strings.HasPrefix(m.Status, "Mounted from ") {
+			done, ok = true, true
+		}
+		if ok {
+			m.Type = LayerEvent
+			m.Layer = &Layer{
+				ID:      m.ID,
+				Status:  m.Status,
+				Current: m.ProgressDetail.Current,
+				Total:   m.ProgressDetail.Total,
+				Done:    done,
+			}
+		}
+		return
+	}
+
+	line := strings.TrimRight(m.Stream, "\r\n")
+	if line == "" {
+		return
+	}
+
+	if match := buildKitLinePattern.FindStringSubmatch(line); match != nil {
+		p.annotateBuildKit(m, match[1], match[2])
+		return
+	}
+
+	if match := stepPattern.FindStringSubmatch(line); match != nil {
+		number, _ := strconv.Atoi(match[1])
+		total, _ := strconv.Atoi(match[2])
+		p.step = &Step{Number: number, Total: total, Instruction: strings.TrimSpace(match[3])}
+		m.Type = StepEvent
+		m.Step = p.step
+		return
+	}
+
+	if cacheHitPattern.MatchString(line) {
+		m.Type = CacheHitEvent
+		m.Step = p.step
+		return
+	}
+
+	if match := copyingBlobPattern.FindStringSubmatch(line); match != nil {
+		status := strings.TrimSpace(match[2])
+		done := strings.HasPrefix(status, "done") || strings.Contains(status, "already exists")
+		if status == "" {
+			status = "Copying"
+		}
+		m.Type = LayerEvent
+		m.Layer = &Layer{ID: match[1], Status: status, Done: done}
+		return
+	}
+
+	if isWarning(line) {
+		m.Type = WarningEvent
+	}
+}
+
+// annotateBuildKit annotates a line of the progress of a BuildKit build, in the
+// format of "docker build --progress=plain". The first line of each step is
+// its name, and steps run in parallel, so their lines are interleaved.
+func (p *eventParser) annotateBuildKit(m *Response, vertex, line string) {
+	if p.buildKitSteps == nil {
+		p.buildKitSteps = map[string]*Step{}
+	}
+
+	step, seen := p.buildKitSteps[vertex]
+	if !seen {
+		p.buildKitSteps[vertex] = nil
+		if match := buildKitStepPattern.FindStringSubmatch(line); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			total, _ := strconv.Atoi(match[2])
+			p.buildKitSteps[vertex] = &Step{Number: number, Total: total, Instruction: strings.TrimSpace(match[3])}
+			m.Type = StepEvent
+			m.Step = p.buildKitSteps[vertex]
+		}
+		return
+	}
+
+	switch {
+	case line == "CACHED" && step != nil:
+		m.Type = CacheHitEvent
+		m.Step = step
+
+	case buildKitLayerPattern.MatchString(line):
+		match := buildKitLayerPattern.FindStringSubmatch(line)
+		status := match[2]
+		done := strings.HasSuffix(status, "done")
+		if status == "" {
+			status = "Downloading"
+		}
+		m.Type = LayerEvent
+		m.Layer = &Layer{ID: match[1], Status: status, Done: done}
+
+	case isWarning(line):
+		m.Type = WarningEvent
+	}
+}
+
+// isWarning returns whether the line is a warning, as logged by Docker
+// ("[Warning] ..."), Buildah ("WARN[0000] ..." or "WARNING: ...") or the
+// builder itself ("Warning: ...").
+func isWarning(line string) bool {
+	lower := strings.ToLower(strings.TrimSpace(line))
+	return strings.HasPrefix(lower, "warning") ||
+		strings.HasPrefix(lower, "[warning]") ||
+		strings.HasPrefix(lower, "warn[") ||
+		strings.Contains(lower, "level=warning")
+}
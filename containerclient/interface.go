@@ -1,14 +1,20 @@
 package containerclient
 
 import (
+	"encoding/json"
 	"io"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/quay/quay-builder/rpc"
 )
 
+// sourceDateEpochArg is the build arg conventionally used to make builds
+// reproducible.
+const sourceDateEpochArg = "SOURCE_DATE_EPOCH"
+
 type BuildImageOptions struct {
 	// name:tag
 	Name                string
@@ -20,6 +26,14 @@ type BuildImageOptions struct {
 	OutputStream        io.Writer
 	Dockerfile          string
 	ContextDir          string
+	Labels              map[string]string
+	BuildArgs           map[string]string
+	// SourceDateEpoch, if set, is used for the timestamps in the image so that
+	// the same sources always produce the same image.
+	SourceDateEpoch *time.Time
+	// AuthConfigs are the credentials, keyed by registry hostname (e.g.
+	// "docker.io"), used for images pulled during the build.
+	AuthConfigs map[string]AuthConfiguration
 }
 
 type AuthConfiguration struct {
@@ -32,6 +46,10 @@ type PullImageOptions struct {
 	Registry     string
 	Tag          string
 	OutputStream io.Writer
+	// Insecure allows the registry to be accessed without verifying its
+	// certificate. It is only honored by Podman: Docker only pulls from
+	// insecure registries listed in the daemon's configuration.
+	Insecure bool
 }
 
 type PushImageOptions struct {
@@ -70,11 +88,27 @@ type PruneImagesResults struct {
 type Client interface {
 	BuildImage(BuildImageOptions) error
 	PullImage(PullImageOptions, AuthConfiguration) error
-	PushImage(PushImageOptions, AuthConfiguration) error
+	// PushImage pushes the image and returns the digest of the manifest it
+	// was pushed as, or "" if the runtime didn't report it.
+	PushImage(PushImageOptions, AuthConfiguration) (string, error)
 	TagImage(string, TagImageOptions) error
 	InspectImage(string) (*Image, error)
 	RemoveImageExtended(string, RemoveImageOptions) error
 	PruneImages(PruneImagesOptions) (*PruneImagesResults, error)
+
+	// UsesBuildKit reports whether images are built with BuildKit, which
+	// honours the syntax directive of a Dockerfile.
+	UsesBuildKit() bool
+
+	// IgnoreFiles returns the files, relative to the root of the build
+	// context, that the runtime reads patterns excluding files from the
+	// context from, in order of precedence.
+	IgnoreFiles() []string
+
+	// InsecureRegistry reports whether the runtime accesses the registry
+	// over plain HTTP or without verifying its certificate, so that the
+	// builder can access it the same way.
+	InsecureRegistry(registry string) bool
 }
 
 func NewClient(host, containerRuntime string) (Client, error) {
@@ -101,6 +135,19 @@ type LogWriter interface {
 	// ResetError throws away any error state from previously streamed logs.
 	ResetError()
 
+	// WriteStream publishes plain text output, such as the progress of a
+	// command run by the builder itself, rather than the daemon's output.
+	WriteStream(s string) error
+
+	// WriteError publishes an error found by the builder itself, such as a
+	// Dockerfile that can't be parsed, so that it is shown as the cause of
+	// the failed build.
+	WriteError(s string) error
+
+	// Flush publishes any output held back waiting for the rest of a line
+	// or message, such as at the end of a build.
+	Flush() error
+
 	io.Writer
 }
 
@@ -132,6 +179,16 @@ type Response struct {
 	Status         string         `json:"status,omitempty"`
 	ID             string         `json:"id,omitempty"`
 	ProgressDetail progressDetail `json:"progressDetail,omitempty"`
+
+	// Aux is additional data sent by Docker, such as the progress of a
+	// BuildKit build. It is rendered into the logs rather than published.
+	Aux json.RawMessage `json:"aux,omitempty"`
+
+	// Type is the type of event the entry describes, if any, such as
+	// StepEvent. Step or Layer describe the event.
+	Type  string `json:"type,omitempty"`
+	Step  *Step  `json:"step,omitempty"`
+	Layer *Layer `json:"layer,omitempty"`
 }
 
 // progressDetail represents the progress made by a Docker™ command.
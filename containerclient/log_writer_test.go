@@ -3,7 +3,18 @@ package containerclient
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/quay/quay-builder/rpc"
 )
 
 type testWriter struct {
@@ -87,3 +98,341 @@ func TestPartialBufferSet(t *testing.T) {
 		}
 	}
 }
+
+// logClient records the log entries published to it.
+type logClient struct {
+	rpc.Client
+	entries []Response
+}
+
+func (c *logClient) PublishBuildLogEntry(entry string) error {
+	var m Response
+	if err := json.Unmarshal([]byte(entry), &m); err != nil {
+		return err
+	}
+	c.entries = append(c.entries, m)
+	return nil
+}
+
+func TestEventParserAnnotate(t *testing.T) {
+	table := []struct {
+		name  string
+		resp  Response
+		typ   string
+		step  *Step
+		layer *Layer
+	}{
+		{"docker step", Response{Stream: "Step 2/5 : RUN apk add git\n"}, StepEvent, &Step{Number: 2, Total: 5, Instruction: "RUN apk add git"}, nil},
+		{"buildah step", Response{Stream: "STEP 3/5: COPY . /src\n"}, StepEvent, &Step{Number: 3, Total: 5, Instruction: "COPY . /src"}, nil},
+		{"docker cache hit", Response{Stream: " ---> Using cache\n"}, CacheHitEvent, &Step{Number: 3, Total: 5, Instruction: "COPY . /src"}, nil},
+		{"buildah cache hit", Response{Stream: "--> Using cache 0f2a6c9d1e\n"}, CacheHitEvent, &Step{Number: 3, Total: 5, Instruction: "COPY . /src"}, nil},
+		{
+			"docker pull progress",
+			Response{Status: "Downloading", ID: "a3ed95caeb02", ProgressDetail: progressDetail{Current: 1024, Total: 4096}},
+			LayerEvent, nil, &Layer{ID: "a3ed95caeb02", Status: "Downloading", Current: 1024, Total: 4096},
+		},
+		{"docker pull complete", Response{Status: "Pull complete", ID: "a3ed95caeb02"}, LayerEvent, nil, &Layer{ID: "a3ed95caeb02", Status: "Pull complete", Done: true}},
+		{"docker mounted layer", Response{Status: "Mounted from library/alpine", ID: "a3ed95caeb02"}, LayerEvent, nil, &Layer{ID: "a3ed95caeb02", Status: "Mounted from library/alpine", Done: true}},
+		{"docker image status", Response{Status: "Pulling from library/alpine", ID: "latest"}, "", nil, nil},
+		{"buildah blob", Response{Stream: "Copying blob sha256:4abcf2066143 done\n"}, LayerEvent, nil, &Layer{ID: "4abcf2066143", Status: "done", Done: true}},
+		{"buildah warning", Response{Stream: "WARN[0002] missing \"VERSION\" build argument\n"}, WarningEvent, nil, nil},
+		{"builder warning", Response{Stream: "Warning: Dockerfile:3: MAINTAINER is deprecated\n"}, WarningEvent, nil, nil},
+		{"output", Response{Stream: "fetch https://dl-cdn.alpinelinux.org/alpine/v3.19/main/x86_64/APKINDEX.tar.gz\n"}, "", nil, nil},
+		{"buildkit internal step", Response{Stream: "#1 [internal] load build definition from Dockerfile\n"}, "", nil, nil},
+		{"buildkit step", Response{Stream: "#2 [build 1/2] FROM docker.io/library/alpine:3.20\n"}, StepEvent, &Step{Number: 1, Total: 2, Instruction: "FROM docker.io/library/alpine:3.20"}, nil},
+		{"buildkit layer", Response{Stream: "#2 sha256:0123abcd 3.4MB / 3.4MB done\n"}, LayerEvent, nil, &Layer{ID: "0123abcd", Status: "3.4MB / 3.4MB done", Done: true}},
+		{"buildkit output", Response{Stream: "#2 [1/2] printed by the step\n"}, "", nil, nil},
+		{"buildkit warning", Response{Stream: "#2 WARNING: no platform specified\n"}, WarningEvent, nil, nil},
+		{"buildkit cache hit", Response{Stream: "#2 CACHED\n"}, CacheHitEvent, &Step{Number: 1, Total: 2, Instruction: "FROM docker.io/library/alpine:3.20"}, nil},
+		{"buildkit internal cache hit", Response{Stream: "#1 CACHED\n"}, "", nil, nil},
+	}
+
+	// The cases share a parser, as cache hits belong to the last step.
+	var p eventParser
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.resp
+			p.annotate(&m)
+			if m.Type != tt.typ {
+				t.Fatalf("want type %q, got %q", tt.typ, m.Type)
+			}
+			if !reflect.DeepEqual(m.Step, tt.step) {
+				t.Fatalf("want step %+v, got %+v", tt.step, m.Step)
+			}
+			if !reflect.DeepEqual(m.Layer, tt.layer) {
+				t.Fatalf("want layer %+v, got %+v", tt.layer, m.Layer)
+			}
+		})
+	}
+}
+
+func TestPodmanRPCWriterEvents(t *testing.T) {
+	client := &logClient{}
+	w := NewRPCWriter(client, "podman")
+
+	output := "STEP 1/2: FROM alpine\nCopying blob 4abcf2066143 done\nSTEP 2/2: RUN true\n--> Using cache 0f2a6c9d1e\n"
+	if n, err := w.Write([]byte(output)); err != nil || n != len(output) {
+		t.Fatalf("failed to write: %d, %v", n, err)
+	}
+
+	want := []string{StepEvent, LayerEvent, StepEvent, CacheHitEvent}
+	if len(client.entries) != len(want) {
+		t.Fatalf("want %d log entries, got %d: %+v", len(want), len(client.entries), client.entries)
+	}
+	for i, typ := range want {
+		if client.entries[i].Type != typ {
+			t.Errorf("entry %d: want type %q, got %q", i, typ, client.entries[i].Type)
+		}
+	}
+	if step := client.entries[3].Step; step == nil || step.Number != 2 {
+		t.Errorf("want cache hit for step 2, got %+v", step)
+	}
+}
+
+func TestPodmanRPCWriterSplitLines(t *testing.T) {
+	client := &logClient{}
+	w := NewRPCWriter(client, "podman")
+
+	// The step header and cache hit are split across writes, and the output
+	// doesn't end with a newline.
+	for _, chunk := range []string{"STEP 1/2: FR", "OM alpine\nSTEP 2/2: COPY . /s", "rc\n--> Using", " cache 0f2a6c9d1e"} {
+		if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("failed to write: %d, %v", n, err)
+		}
+	}
+	if len(client.entries) != 2 {
+		t.Fatalf("want 2 log entries before flushing, got %d: %+v", len(client.entries), client.entries)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		stream string
+		typ    string
+	}{
+		{"STEP 1/2: FROM alpine\n", StepEvent},
+		{"STEP 2/2: COPY . /src\n", StepEvent},
+		{"--> Using cache 0f2a6c9d1e", CacheHitEvent},
+	}
+	if len(client.entries) != len(want) {
+		t.Fatalf("want %d log entries, got %d: %+v", len(want), len(client.entries), client.entries)
+	}
+	for i, e := range want {
+		if client.entries[i].Stream != e.stream || client.entries[i].Type != e.typ {
+			t.Errorf("entry %d: want %q (%q), got %q (%q)", i, e.stream, e.typ, client.entries[i].Stream, client.entries[i].Type)
+		}
+	}
+	if step := client.entries[1].Step; step == nil || step.Instruction != "COPY . /src" {
+		t.Errorf("want step COPY . /src, got %+v", step)
+	}
+}
+
+// traceMessage encodes the status of a BuildKit build the way Docker streams
+// it.
+func traceMessage(t *testing.T, status *controlapi.StatusResponse) string {
+	dt, err := status.MarshalVT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := json.Marshal(map[string]interface{}{"id": buildKitTraceID, "aux": dt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(msg) + "\r\n"
+}
+
+func TestDockerRPCWriterBuildKitTrace(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *timestamppb.Timestamp { return timestamppb.New(start.Add(d)) }
+
+	messages := []*controlapi.StatusResponse{
+		{Vertexes: []*controlapi.Vertex{
+			{Digest: "sha256:1", Name: "[internal] load build definition from Dockerfile", Started: at(0), Completed: at(100 * time.Millisecond)},
+			{Digest: "sha256:2", Name: "[1/2] FROM docker.io/library/alpine:3.20", Started: at(0)},
+		}},
+		{Statuses: []*controlapi.VertexStatus{{ID: "sha256:0123abcd", Vertex: "sha256:2", Total: 3400000, Started: at(0)}}},
+		{Statuses: []*controlapi.VertexStatus{{ID: "sha256:0123abcd", Vertex: "sha256:2", Current: 1700000, Total: 3400000, Started: at(0)}}},
+		{
+			Vertexes: []*controlapi.Vertex{{Digest: "sha256:2", Name: "[1/2] FROM docker.io/library/alpine:3.20", Started: at(0), Completed: at(time.Second)}},
+			Statuses: []*controlapi.VertexStatus{{ID: "sha256:0123abcd", Vertex: "sha256:2", Current: 3400000, Total: 3400000, Started: at(0), Completed: at(time.Second)}},
+		},
+		{
+			Vertexes: []*controlapi.Vertex{{Digest: "sha256:3", Name: "[2/2] RUN echo hello", Started: at(time.Second)}},
+			Logs:     []*controlapi.VertexLog{{Vertex: "sha256:3", Msg: []byte("hel")}},
+		},
+		{Logs: []*controlapi.VertexLog{{Vertex: "sha256:3", Msg: []byte("lo\nwor")}}},
+		{Vertexes: []*controlapi.Vertex{{Digest: "sha256:3", Name: "[2/2] RUN echo hello", Started: at(time.Second), Completed: at(1500 * time.Millisecond)}}},
+	}
+
+	var stream string
+	for _, status := range messages {
+		stream += traceMessage(t, status)
+	}
+
+	client := &logClient{}
+	w := NewRPCWriter(client, "docker")
+	// The messages are split across writes.
+	for _, chunk := range []string{stream[:len(stream)/2], stream[len(stream)/2:]} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range client.entries {
+		got = append(got, entry.Stream)
+	}
+	want := []string{
+		"#1 [internal] load build definition from Dockerfile\n",
+		"#2 [1/2] FROM docker.io/library/alpine:3.20\n",
+		"#1 DONE 0.1s\n",
+		"#2 sha256:0123abcd 0B / 3.4MB\n",
+		"#2 sha256:0123abcd 3.4MB / 3.4MB done\n",
+		"#2 DONE 1.0s\n",
+		"#3 [2/2] RUN echo hello\n",
+		"#3 hello\n",
+		"#3 wor\n",
+		"#3 DONE 0.5s\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected build log:\ngot:  %q\nwant: %q", got, want)
+	}
+
+	types := map[int]string{1: StepEvent, 3: LayerEvent, 4: LayerEvent, 6: StepEvent}
+	for i, entry := range client.entries {
+		if entry.Type != types[i] {
+			t.Errorf("entry %d (%q): want type %q, got %q", i, entry.Stream, types[i], entry.Type)
+		}
+	}
+	if step := client.entries[6].Step; step == nil || step.Number != 2 || step.Instruction != "RUN echo hello" {
+		t.Errorf("want step 2 RUN echo hello, got %+v", step)
+	}
+}
+
+// TestDockerRPCWriterThrottlesProgress replays the output of docker pulls and
+// pushes, with the messages arriving at different rates, and checks that only
+// some of the progress messages are sent.
+func TestDockerRPCWriterThrottlesProgress(t *testing.T) {
+	table := []struct {
+		file string
+		tick time.Duration
+	}{
+		{"pull.json", 10 * time.Millisecond},
+		{"pull.json", 300 * time.Millisecond},
+		{"pull.json", 2 * time.Second},
+		{"push.json", 10 * time.Millisecond},
+		{"push.json", time.Second},
+	}
+
+	for _, tt := range table {
+		t.Run(fmt.Sprintf("%s every %s", tt.file, tt.tick), func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", "progress", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := &logClient{}
+			w := NewRPCWriter(client, "docker").(*DockerRPCWriter)
+			clock := time.Unix(0, 0)
+			w.filter.now = func() time.Time { return clock }
+
+			type sent struct {
+				resp Response
+				at   time.Time
+			}
+			var progress int
+			var sentProgress []sent
+			lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+			for _, line := range lines {
+				clock = clock.Add(tt.tick)
+				before := len(client.entries)
+
+				// Each message is written separately, as the daemon streams them.
+				if _, err := w.Write([]byte(line)); err != nil {
+					t.Fatal(err)
+				}
+
+				var m Response
+				if err := json.Unmarshal([]byte(line), &m); err != nil {
+					t.Fatal(err)
+				}
+				isProgress := progressStatuses[m.Status]
+				if isProgress {
+					progress++
+				}
+
+				if len(client.entries) == before {
+					if !isProgress {
+						t.Fatalf("message was skipped: %s", line)
+					}
+					if m.ProgressDetail.Current == m.ProgressDetail.Total {
+						t.Fatalf("final progress message was skipped: %s", line)
+					}
+					continue
+				}
+				if isProgress {
+					sentProgress = append(sentProgress, sent{client.entries[len(client.entries)-1], clock})
+				}
+			}
+
+			if len(sentProgress) >= progress {
+				t.Fatalf("all %d progress messages were sent", progress)
+			}
+
+			// Check the gaps between the progress messages sent for each layer.
+			last := map[string]sent{}
+			for _, s := range sentProgress {
+				key := s.resp.ID + "/" + s.resp.Status
+				prev, ok := last[key]
+				last[key] = s
+				if !ok || s.resp.ProgressDetail.Current == s.resp.ProgressDetail.Total {
+					continue
+				}
+
+				elapsed := s.at.Sub(prev.at)
+				delta := s.resp.ProgressDetail.Current - prev.resp.ProgressDetail.Current
+				if elapsed < minProgressInterval {
+					t.Errorf("%s: progress sent %s after the last", key, elapsed)
+				}
+				if delta < minProgressDelta && elapsed < maxProgressInterval {
+					t.Errorf("%s: progress of %d bytes sent %s after the last", key, delta, elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterShouldSkip(t *testing.T) {
+	clock := time.Unix(0, 0)
+	f := &filter{now: func() time.Time { return clock }}
+
+	table := []struct {
+		name    string
+		elapsed time.Duration
+		resp    Response
+		skip    bool
+	}{
+		{"first progress", 0, Response{Status: "Downloading", ID: "a", ProgressDetail: progressDetail{Current: 1, Total: 50000000}}, false},
+		{"other layer", 0, Response{Status: "Downloading", ID: "b", ProgressDetail: progressDetail{Current: 1, Total: 50000000}}, false},
+		{"too soon", 100 * time.Millisecond, Response{Status: "Downloading", ID: "a", ProgressDetail: progressDetail{Current: 20000000, Total: 50000000}}, true},
+		{"enough bytes", time.Second, Response{Status: "Downloading", ID: "a", ProgressDetail: progressDetail{Current: 20000000, Total: 50000000}}, false},
+		{"too few bytes", time.Second, Response{Status: "Downloading", ID: "a", ProgressDetail: progressDetail{Current: 21000000, Total: 50000000}}, true},
+		{"long enough", 5 * time.Second, Response{Status: "Downloading", ID: "a", ProgressDetail: progressDetail{Current: 22000000, Total: 50000000}}, false},
+		{"final", 0, Response{Status: "Downloading", ID: "a", ProgressDetail: progressDetail{Current: 50000000, Total: 50000000}}, false},
+		{"new status", 0, Response{Status: "Extracting", ID: "a", ProgressDetail: progressDetail{Current: 1, Total: 50000000}}, false},
+		{"status change", 0, Response{Status: "Download complete", ID: "b"}, false},
+		{"stream", 0, Response{Stream: "Step 1/2 : FROM alpine\n"}, false},
+	}
+
+	for _, tt := range table {
+		clock = clock.Add(tt.elapsed)
+		resp := tt.resp
+		if got := f.shouldSkip(&resp); got != tt.skip {
+			t.Errorf("%s: want skip %v, got %v", tt.name, tt.skip, got)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package containerclient
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"strings"
@@ -12,6 +15,11 @@ import (
 	"github.com/containers/podman/v5/pkg/bindings/images"
 	"github.com/containers/podman/v5/pkg/domain/entities"
 	"github.com/containers/podman/v5/pkg/domain/entities/reports"
+	log "github.com/sirupsen/logrus"
+	"go.podman.io/image/v5/pkg/sysregistriesv2"
+	"go.podman.io/image/v5/types"
+
+	"github.com/quay/quay-builder/containerclient/dockerfile"
 )
 
 func imagePath(repository, tag string) string {
@@ -49,6 +57,24 @@ func NewPodmanClient(host string) (*podmanClient, error) {
 }
 
 func (c *podmanClient) BuildImage(opts BuildImageOptions) error {
+	buildahOpts := buildahOptions(opts)
+	if len(opts.AuthConfigs) > 0 {
+		// The bindings only send credentials for the build from an auth file.
+		authFile, err := writeAuthFile(opts.AuthConfigs)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(authFile)
+		buildahOpts.SystemContext = &types.SystemContext{AuthFilePath: authFile}
+	}
+	podmanBuildOpts := entities.BuildOptions{BuildOptions: buildahOpts}
+	_, err := images.Build(c.podmanContext, []string{opts.Dockerfile}, podmanBuildOpts)
+	return err
+}
+
+// buildahOptions converts the options to the form expected by Buildah, other
+// than the credentials, which are sent in a file.
+func buildahOptions(opts BuildImageOptions) define.BuildOptions {
 	buildahOpts := define.BuildOptions{
 		NoCache:                 opts.NoCache,
 		RemoveIntermediateCtrs:  opts.RmTmpContainer,
@@ -60,12 +86,51 @@ func (c *podmanClient) BuildImage(opts BuildImageOptions) error {
 		Quiet:                   opts.SuppressOutput,
 		CommonBuildOpts:         &buildah.CommonBuildOptions{},
 	}
+	for key, value := range opts.Labels {
+		buildahOpts.Labels = append(buildahOpts.Labels, key+"="+value)
+	}
+	if len(opts.BuildArgs) > 0 {
+		buildahOpts.Args = opts.BuildArgs
+	}
+	if opts.SourceDateEpoch != nil {
+		// Buildah also passes SOURCE_DATE_EPOCH to the build as an arg, and
+		// clamps the timestamps of the files in new layers to it.
+		buildahOpts.SourceDateEpoch = opts.SourceDateEpoch
+		buildahOpts.RewriteTimestamp = true
+	}
 	if os.Getenv("BULDAH_ISOLATION") == "chroot" {
 		buildahOpts.Isolation = buildah.IsolationChroot
 	}
-	podmanBuildOpts := entities.BuildOptions{BuildOptions: buildahOpts}
-	_, err := images.Build(c.podmanContext, []string{opts.Dockerfile}, podmanBuildOpts)
-	return err
+	return buildahOpts
+}
+
+// writeAuthFile writes credentials keyed by registry hostname to a temporary
+// file in the format of a docker config.json, and returns its path.
+func writeAuthFile(auths map[string]AuthConfiguration) (string, error) {
+	type authEntry struct {
+		Auth string `json:"auth"`
+	}
+	config := struct {
+		Auths map[string]authEntry `json:"auths"`
+	}{Auths: map[string]authEntry{}}
+	for registry, auth := range auths {
+		config.Auths[registry] = authEntry{
+			Auth: base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)),
+		}
+	}
+
+	f, err := ioutil.TempFile("", "quay-builder-auth-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(config); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
 }
 
 func (c *podmanClient) PullImage(opts PullImageOptions, auth AuthConfiguration) error {
@@ -74,11 +139,14 @@ func (c *podmanClient) PullImage(opts PullImageOptions, auth AuthConfiguration)
 		Username: &auth.Username,
 		Password: &auth.Password,
 	}
+	if opts.Insecure {
+		podmanPullOpts.SkipTLSVerify = &opts.Insecure
+	}
 	_, err := images.Pull(c.podmanContext, fullImagePath, &podmanPullOpts)
 	return err
 }
 
-func (c *podmanClient) PushImage(opts PushImageOptions, auth AuthConfiguration) error {
+func (c *podmanClient) PushImage(opts PushImageOptions, auth AuthConfiguration) (string, error) {
 
 	imagePath := imagePath(opts.Repository, opts.Tag)
 	podmanPushOpts := images.PushOptions{
@@ -86,7 +154,7 @@ func (c *podmanClient) PushImage(opts PushImageOptions, auth AuthConfiguration)
 		Password: &auth.Password,
 	}
 	err := images.Push(c.podmanContext, imagePath, imagePath, &podmanPushOpts)
-	return err
+	return podmanPushOpts.GetManifestDigest(), err
 }
 
 func (c *podmanClient) TagImage(name string, opts TagImageOptions) error {
@@ -128,3 +196,24 @@ func (c *podmanClient) PruneImages(opts PruneImagesOptions) (*PruneImagesResults
 	imagesDeleted := reports.PruneReportsIds(imagesDeletedReports)
 	return &PruneImagesResults{ImagesDeleted: imagesDeleted}, nil
 }
+
+// UsesBuildKit is always false, as Buildah has its own Dockerfile builder.
+func (c *podmanClient) UsesBuildKit() bool {
+	return false
+}
+
+// IgnoreFiles prefers .containerignore to .dockerignore, like Buildah.
+func (c *podmanClient) IgnoreFiles() []string {
+	return dockerfile.PodmanIgnoreFiles
+}
+
+// InsecureRegistry reads the registry's configuration from registries.conf,
+// which the Podman service shares with the builder.
+func (c *podmanClient) InsecureRegistry(registry string) bool {
+	reg, err := sysregistriesv2.FindRegistry(nil, registry)
+	if err != nil {
+		log.Warningf("failed to read the configuration of registry %s: %s", registry, err)
+		return false
+	}
+	return reg != nil && reg.Insecure
+}
@@ -1,6 +1,7 @@
 package containerclient
 
 import (
+	"bytes"
 	"encoding/json"
 
 	log "github.com/sirupsen/logrus"
@@ -16,6 +17,7 @@ type PodmanRPCWriter struct {
 	errResponse      *Response
 	partialBuffer    *partialBuffer
 	hasPartialBuffer bool
+	events           eventParser
 }
 
 // Write implements the io.Writer interface for RPCWriter.
@@ -23,23 +25,75 @@ func (w *PodmanRPCWriter) Write(p []byte) (n int, err error) {
 	// Unlike docker, libpod parses the JSON encoded data from stream before writing the output,
 	// without the option of returning the raw data instead.
 	// Instead of decoding the stream into a Response, we set the Response's "Stream" before
-	// marshaling it into JSON to be logged.
+	// marshaling it into JSON to be logged. Each line is logged separately, so
+	// that it can be annotated with the event it describes.
 	originalLength := len(p)
 
+	// Note: A line may be split across calls, so the end of the output that
+	// isn't followed by a newline is held back until the rest of the line is
+	// written, or the writer is flushed.
+	data := w.partialBuffer.getAndEmpty(p)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := w.publish(string(data[:i+1])); err != nil {
+			log.Fatalf("Failed to publish log entry: %v", err)
+		}
+		data = data[i+1:]
+	}
+	w.partialBuffer.set(data)
+
+	return originalLength, nil
+}
+
+// Flush implements the LogWriter interface for PodmanRPCWriter, publishing
+// the last line of the output if it wasn't followed by a newline.
+func (w *PodmanRPCWriter) Flush() error {
+	if !w.partialBuffer.hasContents() {
+		return nil
+	}
+
+	return w.publish(string(w.partialBuffer.getAndEmpty(nil)))
+}
+
+// publish annotates a line of output with the event it describes, if any, and
+// publishes it.
+func (w *PodmanRPCWriter) publish(line string) error {
 	var m Response
-	m.Stream = string(p)
+	m.Stream = line
+	w.events.annotate(&m)
 
 	jsonData, err := json.Marshal(&m)
 	if err != nil {
 		log.Fatalf("Error when marshaling logs: %v", err)
 	}
 
-	err = w.client.PublishBuildLogEntry(string(jsonData))
+	return w.client.PublishBuildLogEntry(string(jsonData))
+}
+
+// WriteStream implements the LogWriter interface for PodmanRPCWriter. The
+// output is published straight away, rather than joined to any partial line.
+func (w *PodmanRPCWriter) WriteStream(s string) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(s)); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// WriteError implements the LogWriter interface for PodmanRPCWriter.
+func (w *PodmanRPCWriter) WriteError(s string) error {
+	jsonData, err := json.Marshal(&Response{Error: s})
 	if err != nil {
-		log.Fatalf("Failed to publish log entry: %v", err)
+		return err
 	}
 
-	return originalLength, nil
+	return w.client.PublishBuildLogEntry(string(jsonData))
 }
 
 func (w *PodmanRPCWriter) ErrResponse() (error, bool) {
@@ -0,0 +1,140 @@
+package containerclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestDockerBuildArgs(t *testing.T) {
+	epoch := time.Unix(1600000000, 0)
+
+	table := []struct {
+		opts     BuildImageOptions
+		expected []docker.BuildArg
+	}{
+		{BuildImageOptions{}, nil},
+		{
+			BuildImageOptions{BuildArgs: map[string]string{"b": "2", "a": "1"}, SourceDateEpoch: &epoch},
+			[]docker.BuildArg{{Name: "SOURCE_DATE_EPOCH", Value: "1600000000"}, {Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+		},
+	}
+
+	for _, tt := range table {
+		if got := dockerBuildArgs(tt.opts); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("got %v, wanted %v", got, tt.expected)
+		}
+	}
+}
+
+// TestReproducibleBuildOptions checks that each client is asked to timestamp
+// the image and its layers with SOURCE_DATE_EPOCH for reproducible builds.
+func TestReproducibleBuildOptions(t *testing.T) {
+	epoch := time.Unix(1600000000, 0)
+
+	table := []struct {
+		name     string
+		epoch    *time.Time
+		buildKit bool
+	}{
+		{"not reproducible", nil, false},
+		{"not reproducible with buildkit", nil, true},
+		{"reproducible", &epoch, false},
+		{"reproducible with buildkit", &epoch, true},
+	}
+
+	for _, tt := range table {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := BuildImageOptions{Name: "build", SourceDateEpoch: tt.epoch}
+
+			dockerOpts := (&dockerClient{buildKit: tt.buildKit}).buildImageOptions(opts)
+			wantBuildKit := tt.buildKit || tt.epoch != nil
+			if (dockerOpts.Version == docker.BuilderBuildKit) != wantBuildKit {
+				t.Errorf("docker: got builder version %q, wanted BuildKit: %t", dockerOpts.Version, wantBuildKit)
+			}
+			wantOutputs := ""
+			if tt.epoch != nil {
+				wantOutputs = reproducibleOutputs
+			}
+			if dockerOpts.Outputs != wantOutputs {
+				t.Errorf("docker: got outputs %q, wanted %q", dockerOpts.Outputs, wantOutputs)
+			}
+			var dockerEpoch string
+			for _, arg := range dockerOpts.BuildArgs {
+				if arg.Name == "SOURCE_DATE_EPOCH" {
+					dockerEpoch = arg.Value
+				}
+			}
+			if (dockerEpoch == "1600000000") != (tt.epoch != nil) {
+				t.Errorf("docker: got SOURCE_DATE_EPOCH %q", dockerEpoch)
+			}
+
+			buildah := buildahOptions(opts)
+			if !reflect.DeepEqual(buildah.SourceDateEpoch, tt.epoch) || buildah.RewriteTimestamp != (tt.epoch != nil) {
+				t.Errorf("podman: got SourceDateEpoch %v and RewriteTimestamp %t", buildah.SourceDateEpoch, buildah.RewriteTimestamp)
+			}
+		})
+	}
+}
+
+// TestReproducibleBuild builds the same fixture twice, extracted at different
+// times, and checks that both builds produce the same image. It needs a
+// Podman socket, given by QUAY_BUILDER_TEST_PODMAN_HOST (e.g.
+// "unix:///run/podman/podman.sock").
+func TestReproducibleBuild(t *testing.T) {
+	host := os.Getenv("QUAY_BUILDER_TEST_PODMAN_HOST")
+	if host == "" {
+		t.Skip("QUAY_BUILDER_TEST_PODMAN_HOST not set")
+	}
+
+	client, err := NewClient(host, "podman")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	epoch := time.Unix(1600000000, 0)
+	build := func(name string) string {
+		// Copy the fixture, so that its files have new timestamps.
+		dir := t.TempDir()
+		for _, file := range []string{"Dockerfile", "hello.txt"} {
+			contents, err := ioutil.ReadFile(filepath.Join("testdata", "reproducible", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, file), contents, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := client.BuildImage(BuildImageOptions{
+			Name:            name,
+			NoCache:         true,
+			OutputStream:    ioutil.Discard,
+			Dockerfile:      "Dockerfile",
+			ContextDir:      dir,
+			SourceDateEpoch: &epoch,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.RemoveImageExtended(name, RemoveImageOptions{Force: true})
+
+		image, err := client.InspectImage(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return image.ID
+	}
+
+	first := build("quay-builder-reproducible-test-1")
+	time.Sleep(time.Second)
+	second := build("quay-builder-reproducible-test-2")
+	if first != second {
+		t.Errorf("expected identical images, got %s and %s", first, second)
+	}
+}
@@ -0,0 +1,219 @@
+// Package retry retries requests to container registries and runtimes that
+// fail with transient errors, backing off exponentially between attempts.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containers/podman/v5/pkg/errorhandling"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Policy is how a request is retried.
+type Policy struct {
+	// Attempts is the most times the request is made, including the first.
+	Attempts int
+	// InitialBackoff is the delay before the first retry. It doubles for each
+	// retry after that, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction of each delay that is randomized (e.g. 0.2 waits
+	// between 80% and 120% of the delay), so builders that failed together
+	// don't retry together.
+	Jitter float64
+}
+
+// DefaultPolicy is the policy used unless one is configured.
+var DefaultPolicy = Policy{
+	Attempts:       3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
+// Backoff returns how long to wait before retrying after the given attempt,
+// counting from 1.
+func (p Policy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		backoff += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(backoff))
+	}
+
+	return backoff
+}
+
+// Do makes the request until it succeeds, fails with a permanent error or has
+// been made p.Attempts times. Before each retry, notify is called with the
+// error and the time until the next attempt. The final error is an *Error.
+func (p Policy) Do(request func() error, notify func(err error, attempt int, backoff time.Duration)) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if err == nil {
+			return nil
+		}
+
+		if Classify(err) == Permanent {
+			return &Error{Err: err, Attempts: attempt, Permanent: true}
+		}
+		if attempt >= attempts {
+			return &Error{Err: err, Attempts: attempt}
+		}
+
+		backoff := p.Backoff(attempt)
+		if notify != nil {
+			notify(err, attempt, backoff)
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// Error is the error of a request that was given up on.
+type Error struct {
+	Err error
+	// Attempts is the number of times the request was made.
+	Attempts int
+	// Permanent is whether the request was given up on because the error
+	// can't be fixed by retrying.
+	Permanent bool
+}
+
+func (e *Error) Error() string {
+	if e.Permanent {
+		if e.Attempts > 1 {
+			return fmt.Sprintf("%s (not retrying after attempt %d, as the error is permanent)", e.Err, e.Attempts)
+		}
+		return fmt.Sprintf("%s (not retrying, as the error is permanent)", e.Err)
+	}
+	if e.Attempts == 1 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (gave up after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Class is whether an error may be fixed by retrying.
+type Class int
+
+const (
+	// Transient errors, such as timeouts and server errors, may not happen
+	// again.
+	Transient Class = iota
+	// Permanent errors, such as missing credentials or images, happen every
+	// time.
+	Permanent
+)
+
+func (c Class) String() string {
+	if c == Permanent {
+		return "permanent"
+	}
+	return "transient"
+}
+
+// transientMessages are found in the messages of network errors that the
+// container runtime only passes on as text, such as a registry's name failing
+// to resolve, which may not happen again.
+var transientMessages = []string{
+	"no such host",
+	"i/o timeout",
+	"tls handshake timeout",
+	"connection reset by peer",
+	"connection refused",
+	"toomanyrequests",
+}
+
+// permanentMessages matches the messages of errors returned by registries,
+// through the container runtime, that retrying won't fix. The patterns are
+// specific to registries and runtimes, so that a page from a proxy that
+// happens to say "denied" or "not found" isn't mistaken for one.
+var permanentMessages = regexp.MustCompile(strings.Join([]string{
+	`unauthorized: `,
+	`authentication required`,
+	`requested access to the resource is denied`,
+	`pull access denied`,
+	`manifest unknown`,
+	`name unknown`,
+	`manifest for \S+ not found`,
+	`repository does not exist`,
+	`no such image`,
+	`image not known`,
+	`invalid reference format`,
+	`no matching manifest`,
+}, "|"))
+
+// Classify returns whether the error may be fixed by retrying. Errors that
+// aren't known to be permanent are assumed to be transient.
+func Classify(err error) Class {
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode != 0 {
+		return classifyStatus(terr.StatusCode)
+	}
+
+	// The runtimes' APIs report the status of the request that failed.
+	var derr *docker.Error
+	if errors.As(err, &derr) && derr.Status != 0 {
+		return classifyStatus(derr.Status)
+	}
+	var perr *errorhandling.ErrorModel
+	if errors.As(err, &perr) && perr.ResponseCode != 0 {
+		return classifyStatus(perr.ResponseCode)
+	}
+
+	var nerr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.As(err, &nerr) && nerr.Timeout():
+		return Transient
+	}
+
+	// Errors streamed by the runtime while pulling or pushing only have a
+	// message.
+	msg := strings.ToLower(err.Error())
+	for _, transient := range transientMessages {
+		if strings.Contains(msg, transient) {
+			return Transient
+		}
+	}
+	if permanentMessages.MatchString(msg) {
+		return Permanent
+	}
+
+	return Transient
+}
+
+// classifyStatus classifies an HTTP error response from a registry.
+func classifyStatus(code int) Class {
+	switch {
+	case code >= 500, code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return Transient
+	default:
+		return Permanent
+	}
+}
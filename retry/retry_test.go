@@ -0,0 +1,142 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containers/podman/v5/pkg/errorhandling"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+func TestClassify(t *testing.T) {
+	var tests = []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"server error", &transport.Error{StatusCode: http.StatusServiceUnavailable}, Transient},
+		{"rate limited", &transport.Error{StatusCode: http.StatusTooManyRequests}, Transient},
+		{"unauthorized", &transport.Error{StatusCode: http.StatusUnauthorized}, Permanent},
+		{"missing manifest", fmt.Errorf("failed to push: %w", &transport.Error{StatusCode: http.StatusNotFound}), Permanent},
+		{"deadline", fmt.Errorf("pull: %w", context.DeadlineExceeded), Transient},
+		{"unexpected EOF", io.ErrUnexpectedEOF, Transient},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), Transient},
+		{"docker unauthorized", errors.New("unauthorized: authentication required"), Permanent},
+		{"docker manifest unknown", errors.New("manifest unknown: manifest unknown"), Permanent},
+		{"docker missing tag", errors.New("manifest for quay.io/org/repo:missing not found"), Permanent},
+		{"docker bad gateway", errors.New("received unexpected HTTP status: 502 Bad Gateway"), Transient},
+		{"docker timeout", errors.New("net/http: TLS handshake timeout"), Transient},
+		{"docker no such image", &docker.Error{Status: http.StatusNotFound, Message: "No such image: quay.io/org/repo:latest"}, Permanent},
+		{"docker daemon error", &docker.Error{Status: http.StatusInternalServerError, Message: "Get \"https://quay.io/v2/\": access denied"}, Transient},
+		{"podman image not known", fmt.Errorf("push: %w", &errorhandling.ErrorModel{Message: "quay.io/org/repo: image not known", ResponseCode: http.StatusNotFound}), Permanent},
+		{"podman server error", &errorhandling.ErrorModel{Message: "unauthorized: authentication required", ResponseCode: http.StatusBadGateway}, Transient},
+		{"podman unknown host", errors.New("pinging container registry quay.example.com: Get \"https://quay.example.com/v2/\": dial tcp: lookup quay.example.com: no such host"), Transient},
+		{"proxy denied page", errors.New("received unexpected HTTP status: 403 Access Denied by proxy"), Transient},
+		{"proxy not found page", errors.New("error parsing HTTP 404 response body: <h1>Not Found</h1>"), Transient},
+		{"podman manifest unknown", errors.New("reading manifest missing in quay.io/org/repo: manifest unknown"), Permanent},
+		{"unknown", errors.New("something went wrong"), Transient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Fatalf("got %s, wanted %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.5}
+
+	var tests = []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := policy.Backoff(tt.attempt)
+			if got < tt.want/2 || got > tt.want*3/2 {
+				t.Fatalf("attempt %d: got backoff %s, wanted %s ± 50%%", tt.attempt, got, tt.want)
+			}
+		}
+	}
+
+	policy.Jitter = 0
+	if got := policy.Backoff(3); got != 4*time.Second {
+		t.Fatalf("got backoff %s without jitter, wanted %s", got, 4*time.Second)
+	}
+}
+
+func TestDo(t *testing.T) {
+	policy := Policy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	transient := errors.New("503 Service Unavailable")
+	permanent := errors.New("unauthorized: authentication required")
+
+	var tests = []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      string
+	}{
+		{"success", []error{nil}, 1, ""},
+		{"transient then success", []error{transient, transient, nil}, 3, ""},
+		{"transient", []error{transient, transient, transient}, 3, "503 Service Unavailable (gave up after 3 attempts)"},
+		{"permanent", []error{permanent}, 1, "unauthorized: authentication required (not retrying, as the error is permanent)"},
+		{"transient then permanent", []error{transient, permanent}, 2, "unauthorized: authentication required (not retrying after attempt 2, as the error is permanent)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts, notified := 0, 0
+			err := policy.Do(func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			}, func(err error, attempt int, backoff time.Duration) {
+				notified++
+				if attempt != attempts || !errors.Is(err, transient) {
+					t.Fatalf("notified of attempt %d (%v) after attempt %d", attempt, err, attempts)
+				}
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Fatalf("got %d attempts, wanted %d", attempts, tt.wantAttempts)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if notified != attempts-1 {
+					t.Fatalf("notified of %d retries, wanted %d", notified, attempts-1)
+				}
+				return
+			}
+
+			var rerr *Error
+			if !errors.As(err, &rerr) || rerr.Attempts != tt.wantAttempts {
+				t.Fatalf("got error %#v, wanted an *Error after %d attempts", err, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.errs[len(tt.errs)-1]) {
+				t.Fatalf("error %v doesn't wrap the last error", err)
+			}
+			if err.Error() != tt.wantErr {
+				t.Fatalf("got error %q, wanted %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package grpcbuild
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -74,20 +75,58 @@ func (c *grpcClient) RegisterBuildJob(registrationToken string) (*rpc.BuildArgs,
 		PullToken:      buildpack.PullToken,
 		PushToken:      buildpack.PushToken,
 		TagNames:       buildpack.TagNames,
+		Reproducible:   buildpack.GetReproducible(),
+		StrictLint:     buildpack.GetStrictLint(),
+		SBOMFormat:     buildpack.GetSbomFormat(),
+		Provenance:     buildpack.GetProvenance(),
+		LogBundleURL:   buildpack.GetLogBundleUrl(),
 		BaseImage: rpc.BuildArgsBaseImage{
 			Username: buildpack.BaseImage.GetUsername(),
 			Password: buildpack.BaseImage.GetPassword(),
 		},
 	}
 
+	if policy := buildpack.GetBaseImagePolicy(); policy != nil {
+		buildArgs.BaseImagePolicy = &rpc.BaseImagePolicy{
+			AllowedRegistries:   policy.GetAllowedRegistries(),
+			AllowedRepositories: policy.GetAllowedRepositories(),
+			DeniedRepositories:  policy.GetDeniedRepositories(),
+			RequireDigest:       policy.GetRequireDigest(),
+			DenyLatest:          policy.GetDenyLatest(),
+		}
+	}
+
+	if len(buildpack.GetRegistryAuths()) > 0 {
+		buildArgs.RegistryAuths = map[string]rpc.RegistryCredentials{}
+		for registry, creds := range buildpack.GetRegistryAuths() {
+			buildArgs.RegistryAuths[registry] = rpc.RegistryCredentials{
+				Username: creds.GetUsername(),
+				Password: creds.GetPassword(),
+				Auth:     creds.GetAuth(),
+			}
+		}
+	}
+
+	if key := buildpack.GetSigningKey(); key != nil {
+		buildArgs.SigningKey = &rpc.SigningKey{
+			PrivateKey: key.GetPrivateKey(),
+			Password:   key.GetPassword(),
+		}
+	}
+
 	switch bp := buildpack.BuildPack.(type) {
 	case *pb.BuildPack_PackageUrl:
 		buildArgs.BuildPackage = bp.PackageUrl
+		buildArgs.BuildPackageDigest = buildpack.GetPackageDigest()
 	case *pb.BuildPack_GitPackage_:
 		buildArgs.Git = &rpc.BuildArgsGit{
-			URL:        bp.GitPackage.GetUrl(),
-			SHA:        bp.GitPackage.GetSha(),
-			PrivateKey: bp.GitPackage.GetPrivateKey(),
+			URL:                bp.GitPackage.GetUrl(),
+			SHA:                bp.GitPackage.GetSha(),
+			Ref:                bp.GitPackage.GetRef(),
+			PrivateKey:         bp.GitPackage.GetPrivateKey(),
+			TrustedSigningKeys: bp.GitPackage.GetTrustedSigningKeys(),
+			IdleTimeout:        time.Duration(bp.GitPackage.GetIdleTimeoutSeconds()) * time.Second,
+			Timeout:            time.Duration(bp.GitPackage.GetTimeoutSeconds()) * time.Second,
 		}
 	default:
 		return nil, fmt.Errorf("Buildpack.Buildpack has unexpected type %T", bp)
@@ -97,29 +136,49 @@ func (c *grpcClient) RegisterBuildJob(registrationToken string) (*rpc.BuildArgs,
 }
 
 func (c *grpcClient) SetPhase(phase rpc.Phase, pmd *rpc.PullMetadata) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	c.currentPhase = phase
-	c.phaseSequenceNum += 1
-
 	statusData := &pb.SetPhaseRequest_PullMetadata{}
 	if pmd != nil {
 		statusData.RegistryUrl = pmd.RegistryURL
 		statusData.BaseImage = pmd.BaseImage
 		statusData.BaseImageTag = pmd.BaseImageTag
 		statusData.PullUsername = pmd.PullUsername
+		statusData.MirrorUrl = pmd.MirrorURL
+		statusData.ContextDigest = pmd.ContextDigest
 	}
 
-	phaseResponse, err := c.client.SetPhase(
-		ctx,
-		&pb.SetPhaseRequest{
-			JobJwt:         c.jobToken,
-			SequenceNumber: int32(c.phaseSequenceNum),
-			Phase:          phaseEnum(phase),
-			PullMetadata:   statusData,
-		},
-	)
+	return c.setPhase(phase, &pb.SetPhaseRequest{PullMetadata: statusData})
+}
+
+func (c *grpcClient) CompleteBuild(bmd *rpc.BuildMetadata) error {
+	buildData := &pb.SetPhaseRequest_BuildMetadata{}
+	if bmd != nil {
+		buildData.ImageId = bmd.ImageID
+		buildData.Digests = bmd.Digests
+		buildData.CommitSha = bmd.CommitSHA
+		buildData.ContextDigest = bmd.ContextDigest
+		buildData.Signatures = bmd.Signatures
+		buildData.SbomDigest = bmd.SBOMDigest
+		buildData.Provenance = bmd.Provenance
+		buildData.Attestations = bmd.Attestations
+		buildData.Tagged = bmd.Tagged
+		buildData.FailedTags = bmd.FailedTags
+	}
+
+	return c.setPhase(rpc.Complete, &pb.SetPhaseRequest{BuildMetadata: buildData})
+}
+
+func (c *grpcClient) setPhase(phase rpc.Phase, req *pb.SetPhaseRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c.currentPhase = phase
+	c.phaseSequenceNum += 1
+
+	req.JobJwt = c.jobToken
+	req.SequenceNumber = int32(c.phaseSequenceNum)
+	req.Phase = phaseEnum(phase)
+
+	phaseResponse, err := c.client.SetPhase(ctx, req)
 	if err != nil {
 		log.Errorf("failed to update phase: %v", err)
 		return err
@@ -194,21 +253,21 @@ func (c *grpcClient) PublishBuildLogEntry(entry string) error {
 	return nil
 }
 
-func (c *grpcClient) Heartbeat(ctx context.Context) {
+func (c *grpcClient) Heartbeat(ctx context.Context) error {
 	failedHeartbeatRetries := 3
 
 	heartbeatStream, err := c.client.Heartbeat(ctx)
 	if err != nil {
-		log.Fatalf("failed to start heartbeat: %s", err)
+		return fmt.Errorf("failed to start heartbeat: %w", err)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		default:
 			if failedHeartbeatRetries == 0 {
-				log.Fatalf("failed to update heartbeat too many times")
+				return errors.New("failed to update heartbeat too many times")
 			}
 
 			// Send heartbeat
@@ -221,7 +280,7 @@ func (c *grpcClient) Heartbeat(ctx context.Context) {
 			// Block until heartbeat response
 			hearbeatResp, err := heartbeatStream.Recv()
 			if err == io.EOF {
-				return
+				return nil
 			}
 			if err != nil {
 				log.Warningf("failed to get heartbeat response: %s", err)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Phase represents the milestones in progressing through a build.
@@ -23,7 +24,18 @@ const (
 
 // InvalidDockerfileError is the type of error returned from a BuildCallback when the
 // provided BuildArgs do not have parsable Dockerfile.
-type InvalidDockerfileError struct{ Err string }
+//
+// When the error was caused by a particular line of the Dockerfile, Line is
+// that line number, Instruction is the instruction on it (e.g. "RUN"), Message
+// is the error from the parser and Source is an excerpt of the Dockerfile
+// around the line. Line is zero otherwise.
+type InvalidDockerfileError struct {
+	Err         string
+	Line        int
+	Instruction string
+	Message     string
+	Source      string
+}
 
 func (e InvalidDockerfileError) Error() string {
 	return e.Err
@@ -53,6 +65,14 @@ func (e GitCloneError) Error() string {
 	return e.Err
 }
 
+// GitSignatureError is the type of error returned from a BuildCallback when the
+// checked out commit is unsigned or is not signed by a trusted key.
+type GitSignatureError struct{ Err string }
+
+func (e GitSignatureError) Error() string {
+	return e.Err
+}
+
 // CannotPullForCacheError is the type of error returned from a BuildCallback
 // when it fails to pull the image used for caching.
 type CannotPullForCacheError struct{ Err string }
@@ -77,6 +97,19 @@ func (e PushError) Error() string {
 	return e.Err
 }
 
+// PartialPushError is the type of error returned from a BuildCallback
+// when the built image was pushed, but some of its tags could not be created.
+// Tagged and Failed list the tags in each case.
+type PartialPushError struct {
+	Err    string
+	Tagged []string
+	Failed []string
+}
+
+func (e PartialPushError) Error() string {
+	return e.Err
+}
+
 // PullError is the type of error returned from a BuildCallback
 // when it fails to pull the base image.
 type PullError struct{ Err string }
@@ -93,6 +126,34 @@ func (e BuildError) Error() string {
 	return e.Err
 }
 
+// BaseImagePolicyError is the type of error returned from a BuildCallback
+// when the Dockerfile uses base images that are not allowed by the base image
+// policy. Violations describes each of them.
+type BaseImagePolicyError struct {
+	Err        string
+	Violations []string
+}
+
+func (e BaseImagePolicyError) Error() string {
+	return e.Err
+}
+
+// SBOMError is the type of error returned from a BuildCallback
+// when it fails to generate or attach the SBOM of the pushed image.
+type SBOMError struct{ Err string }
+
+func (e SBOMError) Error() string {
+	return e.Err
+}
+
+// SignError is the type of error returned from a BuildCallback
+// when it fails to sign the pushed image.
+type SignError struct{ Err string }
+
+func (e SignError) Error() string {
+	return e.Err
+}
+
 // ErrClientRejectedPhaseTransition is the type of error
 // returned when buildman rejects a phase transition
 type ErrClientRejectedPhaseTransition struct{ Err string }
@@ -111,22 +172,69 @@ type BuildArgsBaseImage struct {
 	Password string `mapstructure:"password"`
 }
 
+// RegistryCredentials are the credentials for a registry, like an entry in the
+// auths section of a docker config.json. The arguments are as follows:
+//
+// username - the username for the registry,
+// password - the password for the registry, and
+// auth - the base64 encoded 'username:password', used if there is no
+// username.
+type RegistryCredentials struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Auth     string `mapstructure:"auth"`
+}
+
+// BaseImagePolicy restricts the base images a Dockerfile may be built on. The
+// arguments are as follows:
+//
+// allowed_registries - registries base images may be pulled from (any if
+// empty),
+// allowed_repositories - globs matching the full names of the repositories
+// base images may be pulled from (e.g. 'quay.io/myorg/*'; any if empty),
+// denied_repositories - globs matching the full names of repositories base
+// images may not be pulled from,
+// require_digest - whether base images must be pinned to a digest, and
+// deny_latest - whether base images may not use the 'latest' tag, explicitly
+// or by having no tag.
+type BaseImagePolicy struct {
+	AllowedRegistries   []string `mapstructure:"allowed_registries" json:"allowed_registries"`
+	AllowedRepositories []string `mapstructure:"allowed_repositories" json:"allowed_repositories"`
+	DeniedRepositories  []string `mapstructure:"denied_repositories" json:"denied_repositories"`
+	RequireDigest       bool     `mapstructure:"require_digest" json:"require_digest"`
+	DenyLatest          bool     `mapstructure:"deny_latest" json:"deny_latest"`
+}
+
 // BuildArgsGit represents the arguments related to git (if any). The arguments
 // are as follows:
 //
 // url - URL to clone a repository,
-// sha - commit identifier to checkout, and
-// private_key - ssh private key needed to clone a repository.
+// sha - commit identifier to checkout,
+// ref - branch or tag to resolve and checkout when no sha is provided,
+// private_key - ssh private key needed to clone a repository,
+// trusted_signing_keys - armored GPG or SSH public keys, one of which must have
+// signed the commit (if any are provided),
+// idle_timeout - how long a git command may run without output before it is
+// killed (zero for the builder's default), and
+// timeout - how long a git command that doesn't report progress may run for
+// (zero for the builder's default).
 type BuildArgsGit struct {
-	URL        string `mapstructure:"url"`
-	SHA        string `mapstructure:"sha"`
-	PrivateKey string `mapstructure:"private_key"`
+	URL                string        `mapstructure:"url"`
+	SHA                string        `mapstructure:"sha"`
+	Ref                string        `mapstructure:"ref"`
+	PrivateKey         string        `mapstructure:"private_key"`
+	TrustedSigningKeys []string      `mapstructure:"trusted_signing_keys"`
+	IdleTimeout        time.Duration `mapstructure:"idle_timeout"`
+	Timeout            time.Duration `mapstructure:"timeout"`
 }
 
 // BuildArgs represents the arguments needed to build an image. The
 // arguments are as follows:
 //
-// build_package - URL to the build package to download and untar/unzip,
+// build_package - URL to the build package to download and untar/unzip: an
+// http(s):// URL, an s3://bucket/key object or an oci:// artifact reference,
+// build_package_digest - optional digest (e.g. 'sha256:...') of the build
+// package downloaded from build_package,
 // sub_directory - location within the build package of the Dockerfile and the
 //                 build context,
 // dockerfile_name - name of the dockerfile within the sub_directory
@@ -137,19 +245,50 @@ type BuildArgsGit struct {
 // push_token - token to use to push the built image,
 // tag_names - name(s) of the tag(s) for the newly built image,
 // cached_tag - tag in the repository to pull to prime the cache,
-// git - optional git values and credentials used to clone the repository, and
-// base_image - image name and credentials used to conduct the base image pull.
+// git - optional git values and credentials used to clone the repository,
+// base_image - image name and credentials used to conduct the base image pull,
+// reproducible - build the image with SOURCE_DATE_EPOCH set to the time of the
+// git commit, so that the same sources produce the same image,
+// strict_lint - fail the build if linting the Dockerfile finds any problems,
+// base_image_policy - optional restrictions on the base images of the
+// Dockerfile,
+// registry_auths - credentials for pulling images from other registries, keyed
+// by registry (e.g. 'ghcr.io' or 'https://index.docker.io/v1/'),
+// signing_key - optional key used to sign the pushed image with a
+// cosign-compatible signature,
+// sbom_format - format ('spdx' or 'cyclonedx') of an SBOM to attach to the
+// pushed image, or empty to not generate one,
+// provenance - attach a SLSA provenance attestation, signed with the
+// signing_key, to the pushed image, and
+// log_bundle_url - optional URL that a bundle of the build's logs is uploaded
+// to with a PUT request when the job ends.
 type BuildArgs struct {
-	BuildPackage   string             `mapstructure:"build_package"`
-	Context        string             `mapstructure:"context"`
-	DockerfilePath string             `mapstructure:"dockerfile_path"`
-	Repository     string             `mapstructure:"repository"`
-	Registry       string             `mapstructure:"registry"`
-	PullToken      string             `mapstructure:"pull_token"`
-	PushToken      string             `mapstructure:"push_token"`
-	TagNames       []string           `mapstructure:"tag_names"`
-	Git            *BuildArgsGit      `mapstructure:"git"`
-	BaseImage      BuildArgsBaseImage `mapstructure:"base_image"`
+	BuildPackage       string                         `mapstructure:"build_package"`
+	BuildPackageDigest string                         `mapstructure:"build_package_digest"`
+	Context            string                         `mapstructure:"context"`
+	DockerfilePath     string                         `mapstructure:"dockerfile_path"`
+	Repository         string                         `mapstructure:"repository"`
+	Registry           string                         `mapstructure:"registry"`
+	PullToken          string                         `mapstructure:"pull_token"`
+	PushToken          string                         `mapstructure:"push_token"`
+	TagNames           []string                       `mapstructure:"tag_names"`
+	Git                *BuildArgsGit                  `mapstructure:"git"`
+	BaseImage          BuildArgsBaseImage             `mapstructure:"base_image"`
+	Reproducible       bool                           `mapstructure:"reproducible"`
+	StrictLint         bool                           `mapstructure:"strict_lint"`
+	BaseImagePolicy    *BaseImagePolicy               `mapstructure:"base_image_policy"`
+	RegistryAuths      map[string]RegistryCredentials `mapstructure:"registry_auths"`
+	SigningKey         *SigningKey                    `mapstructure:"signing_key"`
+	SBOMFormat         string                         `mapstructure:"sbom_format"`
+	Provenance         bool                           `mapstructure:"provenance"`
+	LogBundleURL       string                         `mapstructure:"log_bundle_url"`
+}
+
+// SigningKey is a PEM-encoded private key used to sign built images. Keys
+// generated by "cosign generate-key-pair" are encrypted with Password.
+type SigningKey struct {
+	PrivateKey string `mapstructure:"private_key"`
+	Password   string `mapstructure:"password"`
 }
 
 // FullRepoName is a helper function to concatenate the registry and repository.
@@ -171,13 +310,37 @@ type PullMetadata struct {
 	BaseImage    string
 	BaseImageTag string
 	PullUsername string
+	// MirrorURL is the mirror the base image was pulled from, or empty if it
+	// was pulled from its own registry. It is only set once the image has
+	// been pulled, with the phase after pulling.
+	MirrorURL string
+	// ContextDigest is the digest of the build context, which is known
+	// before the image is built.
+	ContextDigest string
 }
 
 // BuildMetadata is a collection of metadata about the successfully created
 // build artifact.
 type BuildMetadata struct {
-	ImageID string
-	Digests []string
+	ImageID       string
+	Digests       []string
+	CommitSHA     string
+	ContextDigest string
+	// Signatures are the tags the image's signatures were pushed to, if it
+	// was signed.
+	Signatures []string
+	// SBOMDigest is the digest of the manifest the image's SBOM was attached
+	// as, if one was generated.
+	SBOMDigest string
+	// Provenance is the in-toto statement describing how the image was built,
+	// if a provenance attestation was requested, and Attestations are the tags
+	// it was pushed to.
+	Provenance   string
+	Attestations []string
+	// Tagged are the tags the image was pushed as, and FailedTags are the
+	// requested tags that couldn't be created.
+	Tagged     []string
+	FailedTags []string
 }
 
 // ErrNoSimilarTags is returned from a Client when FindMostSimilarTag fails
@@ -193,12 +356,17 @@ type Client interface {
 	// RegisterBuild
 	RegisterBuildJob(string) (*BuildArgs, error)
 
-	// Heartbeat
-	Heartbeat(context.Context)
+	// Heartbeat keeps the build alive until the context is done, returning an
+	// error if the BuildManager stops accepting heartbeats.
+	Heartbeat(context.Context) error
 
 	// SetPhase informs a BuildManager of a transition between Phases.
 	SetPhase(Phase, *PullMetadata) error
 
+	// CompleteBuild informs a BuildManager of the transition to the Complete
+	// Phase along with the metadata of the built image.
+	CompleteBuild(*BuildMetadata) error
+
 	// FindMostSimilarTag sends a synchronous request to a BuildManager in order
 	// to determine if there is a suitable docker tag to pull in order to prime
 	// the docker build cache.
@@ -0,0 +1,248 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/quay/quay-builder/version"
+)
+
+// Format is a format an SBOM can be written in.
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx"
+	FormatCycloneDX Format = "cyclonedx"
+)
+
+// ParseFormat returns the format with the given name, or an error if it isn't
+// supported.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatSPDX, FormatCycloneDX:
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported SBOM format %q (supported formats are %q and %q)", name, FormatSPDX, FormatCycloneDX)
+}
+
+// MediaType returns the media type of SBOMs in the format.
+func (f Format) MediaType() string {
+	if f == FormatCycloneDX {
+		return "application/vnd.cyclonedx+json"
+	}
+	return "application/spdx+json"
+}
+
+// Subject is the image an SBOM describes.
+type Subject struct {
+	// Repository is the full name of the repository the image was pushed to
+	// (e.g. "quay.io/org/repo").
+	Repository string
+	// Digest is the digest of the image's manifest.
+	Digest string
+}
+
+// toolName identifies the builder as the creator of SBOMs.
+const toolName = "quay-builder"
+
+// Encode writes the inventory of the subject as an SBOM in the format, created
+// at the given time.
+func Encode(format Format, subject Subject, inventory *Inventory, created time.Time) ([]byte, error) {
+	switch format {
+	case FormatSPDX:
+		return json.MarshalIndent(buildSPDX(subject, inventory, created), "", "  ")
+	case FormatCycloneDX:
+		return json.MarshalIndent(buildCycloneDX(subject, inventory, created), "", "  ")
+	}
+	return nil, fmt.Errorf("unsupported SBOM format %q", format)
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// buildSPDX describes the image as the root package of an SPDX 2.3
+// document, containing every package found in it.
+func buildSPDX(subject Subject, inventory *Inventory, created time.Time) spdxDocument {
+	const imageID = "SPDXRef-Image"
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              subject.Repository + "@" + subject.Digest,
+		DocumentNamespace: fmt.Sprintf("https://%s/sbom/%s", subject.Repository, subject.Digest),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName + "-" + version.Version},
+		},
+		Packages: []spdxPackage{{
+			Name:             subject.Repository,
+			SPDXID:           imageID,
+			VersionInfo:      subject.Digest,
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "CONTAINER",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  imagePURL(subject),
+			}},
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: imageID,
+		}},
+	}
+
+	for i, p := range inventory.Packages {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             p.Name,
+			SPDXID:           id,
+			VersionInfo:      p.Version,
+			DownloadLocation: "NOASSERTION",
+			SourceInfo:       "found in " + p.Location,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  p.PURL(),
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      imageID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return doc
+}
+
+type cycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// buildCycloneDX describes the image as the component of a CycloneDX 1.5
+// BOM, with a component for its operating system and each package found in
+// it.
+func buildCycloneDX(subject Subject, inventory *Inventory, created time.Time) cycloneDXBOM {
+	bom := cycloneDXBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Components:  []cycloneDXComponent{},
+	}
+	// The serial number is derived from the image, so the same image always
+	// has the same SBOM.
+	if u, err := uuid.NewV5(uuid.NamespaceURL, []byte(imagePURL(subject))); err == nil {
+		bom.SerialNumber = "urn:uuid:" + u.String()
+	}
+
+	bom.Metadata.Timestamp = created.UTC().Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: toolName, Version: version.Version}}
+	bom.Metadata.Component = cycloneDXComponent{
+		BOMRef:  imagePURL(subject),
+		Type:    "container",
+		Name:    subject.Repository,
+		Version: subject.Digest,
+		PURL:    imagePURL(subject),
+	}
+
+	if d := inventory.Distro; d != nil {
+		bom.Components = append(bom.Components, cycloneDXComponent{
+			BOMRef:  "os:" + d.ID,
+			Type:    "operating-system",
+			Name:    d.ID,
+			Version: d.VersionID,
+		})
+	}
+
+	for _, p := range inventory.Packages {
+		bom.Components = append(bom.Components, cycloneDXComponent{
+			BOMRef:     p.PURL() + "?location=" + purlEscape(p.Location),
+			Type:       "library",
+			Name:       p.Name,
+			Version:    p.Version,
+			PURL:       p.PURL(),
+			Properties: []cycloneDXProperty{{Name: "quay:location", Value: p.Location}},
+		})
+	}
+
+	return bom
+}
+
+// imagePURL returns the package URL of the image, as an OCI artifact.
+func imagePURL(subject Subject) string {
+	name := subject.Repository
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return fmt.Sprintf("pkg:oci/%s@%s?repository_url=%s", purlEscape(name), purlEscape(subject.Digest), purlEscape(subject.Repository))
+}
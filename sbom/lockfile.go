@@ -0,0 +1,220 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// parsePackageLock reads the packages from an npm package-lock.json. Version 2
+// and 3 lockfiles list every package under "packages", keyed by its path in
+// node_modules; version 1 lockfiles nest them under "dependencies".
+func parsePackageLock(location string, data []byte) ([]Package, error) {
+	type dependency struct {
+		Version      string                 `json:"version"`
+		Dependencies map[string]*dependency `json:"dependencies"`
+	}
+	var lock struct {
+		Packages map[string]struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			Link    bool   `json:"link"`
+		} `json:"packages"`
+		Dependencies map[string]*dependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	var packages []Package
+	if len(lock.Packages) > 0 {
+		for key, p := range lock.Packages {
+			// The empty key is the project itself.
+			if key == "" || p.Link {
+				continue
+			}
+			name := p.Name
+			if i := strings.LastIndex(key, "node_modules/"); i >= 0 && name == "" {
+				name = key[i+len("node_modules/"):]
+			}
+			if name == "" {
+				continue
+			}
+			packages = append(packages, Package{Name: name, Version: p.Version, Type: "npm", Location: location})
+		}
+		return packages, nil
+	}
+
+	var walk func(deps map[string]*dependency)
+	walk = func(deps map[string]*dependency) {
+		for name, dep := range deps {
+			if dep == nil {
+				continue
+			}
+			packages = append(packages, Package{Name: name, Version: dep.Version, Type: "npm", Location: location})
+			walk(dep.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+
+	return packages, nil
+}
+
+// parseRequirements reads the packages pinned to an exact version ("name==1.0")
+// in a pip requirements file. Other requirements don't say which version is
+// installed, so they are skipped.
+func parseRequirements(location string, data []byte) ([]Package, error) {
+	var packages []Package
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		// Drop environment markers and hash options.
+		if i := strings.IndexAny(line, "; "); i >= 0 {
+			line = line[:i]
+		}
+
+		name, version, ok := strings.Cut(strings.TrimSpace(line), "==")
+		if !ok || name == "" || strings.HasPrefix(name, "-") {
+			continue
+		}
+		if i := strings.Index(name, "["); i >= 0 {
+			// Drop extras, e.g. "requests[security]".
+			name = name[:i]
+		}
+		packages = append(packages, Package{
+			Name:     normalizePythonName(name),
+			Version:  strings.TrimSpace(version),
+			Type:     "pypi",
+			Location: location,
+		})
+	}
+
+	return packages, scanner.Err()
+}
+
+// parsePipfileLock reads the packages from a Pipfile.lock.
+func parsePipfileLock(location string, data []byte) ([]Package, error) {
+	type section map[string]struct {
+		Version string `json:"version"`
+	}
+	var lock struct {
+		Default section `json:"default"`
+		Develop section `json:"develop"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	var packages []Package
+	for _, s := range []section{lock.Default, lock.Develop} {
+		for name, p := range s {
+			packages = append(packages, Package{
+				Name:     normalizePythonName(name),
+				Version:  strings.TrimPrefix(p.Version, "=="),
+				Type:     "pypi",
+				Location: location,
+			})
+		}
+	}
+
+	return packages, nil
+}
+
+// normalizePythonName normalizes a Python package name as PyPI does.
+func normalizePythonName(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer("_", "-", ".", "-").Replace(name)
+}
+
+// parseGemfileLock reads the gems from the specs of a Gemfile.lock, which are
+// indented by four spaces ("    name (version)"); their own dependencies are
+// indented further.
+func parseGemfileLock(location string, data []byte) ([]Package, error) {
+	var packages []Package
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inSpecs := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "  specs:":
+			inSpecs = true
+			continue
+		case !strings.HasPrefix(line, "  "):
+			inSpecs = false
+			continue
+		}
+		if !inSpecs || !strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "     ") {
+			continue
+		}
+
+		name, version, ok := strings.Cut(strings.TrimSpace(line), " (")
+		if !ok {
+			continue
+		}
+		version = strings.TrimSuffix(version, ")")
+		packages = append(packages, Package{Name: name, Version: version, Type: "gem", Location: location})
+	}
+
+	return packages, scanner.Err()
+}
+
+// parseCargoLock reads the crates from the [[package]] tables of a Cargo.lock.
+func parseCargoLock(location string, data []byte) ([]Package, error) {
+	var packages []Package
+	var name, version string
+
+	flush := func() {
+		if name != "" {
+			packages = append(packages, Package{Name: name, Version: version, Type: "cargo", Location: location})
+		}
+		name, version = "", ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			flush()
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.TrimSpace(key) {
+		case "name":
+			name = value
+		case "version":
+			version = value
+		}
+	}
+	flush()
+
+	return packages, scanner.Err()
+}
+
+// parseGoSum reads the modules from a go.sum. Each module version appears
+// twice, once for its go.mod file alone, and modules only listed for their
+// go.mod weren't needed to build anything, so they are skipped.
+func parseGoSum(location string, data []byte) ([]Package, error) {
+	var packages []Package
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		packages = append(packages, Package{Name: fields[0], Version: fields[1], Type: "golang", Location: location})
+	}
+
+	return packages, scanner.Err()
+}
@@ -0,0 +1,126 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// parseDpkgStatus reads the packages from a dpkg status file, which has a
+// paragraph of "Field: value" lines for each package. Packages that were
+// removed but not purged are skipped.
+func parseDpkgStatus(location string, data []byte) ([]Package, error) {
+	var packages []Package
+	var name, version, status string
+
+	flush := func() {
+		installed := status == "" || strings.HasSuffix(status, " installed")
+		if name != "" && installed {
+			packages = append(packages, Package{Name: name, Version: version, Type: "deb", Location: location})
+		}
+		name, version, status = "", "", ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, maxFileSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// Continuation of a multi-line field, such as Description.
+			continue
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch field {
+		case "Package":
+			name = value
+		case "Version":
+			version = value
+		case "Status":
+			status = value
+		}
+	}
+	flush()
+
+	return packages, scanner.Err()
+}
+
+// parseApkInstalled reads the packages from Alpine's installed database, which
+// has a paragraph of single letter "K:value" lines for each package.
+func parseApkInstalled(location string, data []byte) ([]Package, error) {
+	var packages []Package
+	var name, version string
+
+	flush := func() {
+		if name != "" {
+			packages = append(packages, Package{Name: name, Version: version, Type: "apk", Location: location})
+		}
+		name, version = "", ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, maxFileSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "P:"):
+			name = line[2:]
+		case strings.HasPrefix(line, "V:"):
+			version = line[2:]
+		}
+	}
+	flush()
+
+	return packages, scanner.Err()
+}
+
+// parseOSRelease reads the distribution from an os-release file, which has a
+// KEY=value (optionally quoted) line for each field.
+func parseOSRelease(data []byte) *Distro {
+	distro := &Distro{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+
+		switch key {
+		case "ID":
+			distro.ID = value
+		case "VERSION_ID":
+			distro.VersionID = value
+		case "PRETTY_NAME":
+			distro.Name = value
+		case "NAME":
+			if distro.Name == "" {
+				distro.Name = value
+			}
+		}
+	}
+
+	if distro.ID == "" {
+		return nil
+	}
+	return distro
+}
@@ -0,0 +1,259 @@
+// Package sbom generates software bills of materials for container images by
+// inventorying the packages installed in their filesystems.
+package sbom
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxFileSize is the largest package database or lockfile that is read. Larger
+// files are skipped rather than read into memory.
+const maxFileSize = 64 << 20
+
+// Package is a piece of software found in an image.
+type Package struct {
+	Name    string
+	Version string
+	// Type is the package URL type of the package (e.g. "deb" or "npm").
+	Type string
+	// Namespace is the package URL namespace, such as the distribution of an
+	// OS package.
+	Namespace string
+	// Location is the file the package was found in.
+	Location string
+}
+
+// PURL returns the package URL identifying the package.
+func (p Package) PURL() string {
+	var b strings.Builder
+	b.WriteString("pkg:" + p.Type + "/")
+	if p.Namespace != "" {
+		b.WriteString(purlEscape(p.Namespace) + "/")
+	}
+
+	name := p.Name
+	if p.Type == "npm" && strings.HasPrefix(name, "@") {
+		// Scoped npm packages keep the scope as the namespace.
+		scope, rest, _ := strings.Cut(name, "/")
+		b.WriteString(purlEscape(scope) + "/")
+		name = rest
+	}
+	if p.Type == "golang" {
+		b.WriteString(name)
+	} else {
+		b.WriteString(purlEscape(name))
+	}
+
+	if p.Version != "" {
+		b.WriteString("@" + purlEscape(p.Version))
+	}
+	return b.String()
+}
+
+// purlEscape percent-encodes the characters that can't appear in a package
+// URL segment.
+func purlEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', strings.IndexByte("-._~", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// Distro identifies the operating system of an image, from its os-release
+// file.
+type Distro struct {
+	ID        string
+	VersionID string
+	Name      string
+}
+
+// Inventory is everything found in an image.
+type Inventory struct {
+	Distro   *Distro
+	Packages []Package
+	// Unsupported are the package databases found that can't be read, so
+	// their packages are missing from Packages.
+	Unsupported []string
+}
+
+// parser reads the packages from the contents of a file.
+type parser func(location string, data []byte) ([]Package, error)
+
+// fileParser returns the parser for the file at name (a path relative to the
+// root of the image), if it is one that lists packages.
+func fileParser(name string) parser {
+	switch name {
+	case "var/lib/dpkg/status":
+		return parseDpkgStatus
+	case "lib/apk/db/installed":
+		return parseApkInstalled
+	}
+	if strings.HasPrefix(name, "var/lib/dpkg/status.d/") && !strings.HasSuffix(name, ".md5sums") {
+		// Distroless images have a file per package instead.
+		return parseDpkgStatus
+	}
+
+	// Lockfiles of dependencies that are themselves installed as packages
+	// would list the same packages again.
+	if strings.Contains(name, "/node_modules/") || strings.HasPrefix(name, "node_modules/") {
+		return nil
+	}
+
+	switch path.Base(name) {
+	case "package-lock.json":
+		return parsePackageLock
+	case "requirements.txt":
+		return parseRequirements
+	case "Pipfile.lock":
+		return parsePipfileLock
+	case "Gemfile.lock":
+		return parseGemfileLock
+	case "Cargo.lock":
+		return parseCargoLock
+	case "go.sum":
+		return parseGoSum
+	}
+	return nil
+}
+
+// rpmDatabases are the locations of the RPM package databases: SQLite in
+// current distributions, and Berkeley DB or NDB in older ones and SUSE. None of
+// them can be read without a database library, so they are only reported as
+// unsupported.
+var rpmDatabases = map[string]bool{
+	"var/lib/rpm/rpmdb.sqlite":          true,
+	"var/lib/rpm/Packages":              true,
+	"var/lib/rpm/Packages.db":           true,
+	"usr/lib/sysimage/rpm/rpmdb.sqlite": true,
+	"usr/lib/sysimage/rpm/Packages.db":  true,
+}
+
+// osReleaseFiles are the locations of the os-release file, in order of
+// precedence.
+var osReleaseFiles = []string{"etc/os-release", "usr/lib/os-release"}
+
+// Scan inventories the flattened filesystem of an image, read as a tar stream
+// (e.g. from mutate.Extract).
+func Scan(r io.Reader) (*Inventory, error) {
+	inventory := &Inventory{}
+	osRelease := map[string][]byte{}
+	var osPackages []Package
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if rpmDatabases[name] {
+			inventory.Unsupported = append(inventory.Unsupported, "/"+name)
+			continue
+		}
+		if hdr.Size > maxFileSize {
+			continue
+		}
+		for _, f := range osReleaseFiles {
+			if name == f {
+				data, err := ioutil.ReadAll(tr)
+				if err != nil {
+					return nil, err
+				}
+				osRelease[name] = data
+			}
+		}
+
+		parse := fileParser(name)
+		if parse == nil {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		packages, err := parse("/"+name, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for _, p := range packages {
+			if p.Type == "deb" || p.Type == "apk" {
+				osPackages = append(osPackages, p)
+			} else {
+				inventory.Packages = append(inventory.Packages, p)
+			}
+		}
+	}
+
+	for _, f := range osReleaseFiles {
+		if data, ok := osRelease[f]; ok {
+			inventory.Distro = parseOSRelease(data)
+			break
+		}
+	}
+
+	// OS packages are namespaced by the distribution they came from.
+	for i := range osPackages {
+		if inventory.Distro != nil {
+			osPackages[i].Namespace = inventory.Distro.ID
+		} else if osPackages[i].Type == "apk" {
+			osPackages[i].Namespace = "alpine"
+		}
+	}
+	inventory.Packages = append(osPackages, inventory.Packages...)
+
+	sort.Strings(inventory.Unsupported)
+	sortPackages(inventory.Packages)
+	inventory.Packages = dedupePackages(inventory.Packages)
+	return inventory, nil
+}
+
+// sortPackages orders packages by type, name, version and location.
+func sortPackages(packages []Package) {
+	sort.SliceStable(packages, func(i, j int) bool {
+		a, b := packages[i], packages[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Location < b.Location
+	})
+}
+
+// dedupePackages removes packages that are listed more than once in the same
+// file. The packages must be sorted.
+func dedupePackages(packages []Package) []Package {
+	var deduped []Package
+	for i, p := range packages {
+		if i > 0 && p == packages[i-1] {
+			continue
+		}
+		deduped = append(deduped, p)
+	}
+	return deduped
+}
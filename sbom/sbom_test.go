@@ -0,0 +1,218 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// imageTar returns a tar stream of an image filesystem with the given files.
+func imageTar(t *testing.T, files map[string]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+const dpkgStatus = `Package: libc6
+Status: install ok installed
+Version: 2.36-9+deb12u4
+Description: GNU C Library
+ Contains the standard libraries.
+
+Package: removed
+Status: deinstall ok config-files
+Version: 1.0
+
+Package: zlib1g
+Status: install ok installed
+Version: 1:1.2.13.dfsg-1
+`
+
+const packageLock = `{
+  "name": "app",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app", "version": "1.0.0"},
+    "node_modules/@babel/core": {"version": "7.24.0"},
+    "node_modules/left-pad": {"version": "1.3.0"},
+    "node_modules/local": {"resolved": "../local", "link": true}
+  }
+}`
+
+const gemfileLock = `GEM
+  remote: https://rubygems.org/
+  specs:
+    rack (3.0.9)
+    rails (7.1.3)
+      rack (>= 2.2.4)
+
+PLATFORMS
+  ruby
+`
+
+const cargoLock = `version = 3
+
+[[package]]
+name = "serde"
+version = "1.0.197"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+dependencies = [
+ "serde_derive",
+]
+`
+
+const goSum = `github.com/pkg/errors v0.9.1 h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4=
+github.com/pkg/errors v0.9.1/go.mod h1:bwawxfHBFNV+L2hUp1rHADufV3IMtnDRdf1r5NINEl0=
+golang.org/x/unused v0.1.0/go.mod h1:abc=
+`
+
+func TestScan(t *testing.T) {
+	fs := imageTar(t, map[string]string{
+		"etc/os-release":                       "NAME=\"Debian GNU/Linux\"\nID=debian\nVERSION_ID=\"12\"\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\n",
+		"var/lib/dpkg/status":                  dpkgStatus,
+		"./app/package-lock.json":              packageLock,
+		"app/node_modules/x/package-lock.json": packageLock,
+		"app/requirements.txt":                 "# pinned\nDjango==5.0.3\nrequests[security]==2.31.0 ; python_version >= \"3.8\"\nflask>=2\n",
+		"app/Gemfile.lock":                     gemfileLock,
+		"app/Cargo.lock":                       cargoLock,
+		"app/go.sum":                           goSum,
+	})
+
+	inventory, err := Scan(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedDistro := &Distro{ID: "debian", VersionID: "12", Name: "Debian GNU/Linux 12 (bookworm)"}
+	if !reflect.DeepEqual(inventory.Distro, expectedDistro) {
+		t.Errorf("got distro %+v, wanted %+v", inventory.Distro, expectedDistro)
+	}
+
+	var purls []string
+	for _, p := range inventory.Packages {
+		purls = append(purls, p.PURL())
+	}
+	expected := []string{
+		"pkg:cargo/serde@1.0.197",
+		"pkg:deb/debian/libc6@2.36-9%2Bdeb12u4",
+		"pkg:deb/debian/zlib1g@1%3A1.2.13.dfsg-1",
+		"pkg:gem/rack@3.0.9",
+		"pkg:gem/rails@7.1.3",
+		"pkg:golang/github.com/pkg/errors@v0.9.1",
+		"pkg:npm/%40babel/core@7.24.0",
+		"pkg:npm/left-pad@1.3.0",
+		"pkg:pypi/django@5.0.3",
+		"pkg:pypi/requests@2.31.0",
+	}
+	if !reflect.DeepEqual(purls, expected) {
+		t.Errorf("got packages:\n%s\nwanted:\n%s", strings.Join(purls, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestScanRPM(t *testing.T) {
+	fs := imageTar(t, map[string]string{
+		"etc/os-release":           "ID=fedora\nVERSION_ID=40\n",
+		"var/lib/rpm/rpmdb.sqlite": "SQLite format 3\x00",
+		"app/requirements.txt":     "Django==5.0.3\n",
+	})
+
+	inventory, err := Scan(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(inventory.Unsupported, []string{"/var/lib/rpm/rpmdb.sqlite"}) {
+		t.Errorf("got unsupported databases %q, wanted the RPM database", inventory.Unsupported)
+	}
+	if len(inventory.Packages) != 1 || inventory.Packages[0].Name != "django" {
+		t.Errorf("got packages %+v, wanted django", inventory.Packages)
+	}
+}
+
+func TestScanAlpine(t *testing.T) {
+	fs := imageTar(t, map[string]string{
+		"lib/apk/db/installed": "C:Q1abc=\nP:musl\nV:1.2.4-r2\nA:x86_64\n\nP:busybox\nV:1.36.1-r15\n",
+	})
+
+	inventory, err := Scan(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Package{
+		{Name: "busybox", Version: "1.36.1-r15", Type: "apk", Namespace: "alpine", Location: "/lib/apk/db/installed"},
+		{Name: "musl", Version: "1.2.4-r2", Type: "apk", Namespace: "alpine", Location: "/lib/apk/db/installed"},
+	}
+	if !reflect.DeepEqual(inventory.Packages, expected) {
+		t.Errorf("got %+v, wanted %+v", inventory.Packages, expected)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	inventory := &Inventory{
+		Distro:   &Distro{ID: "alpine", VersionID: "3.19.1"},
+		Packages: []Package{{Name: "musl", Version: "1.2.4-r2", Type: "apk", Namespace: "alpine", Location: "/lib/apk/db/installed"}},
+	}
+	subject := Subject{Repository: "quay.io/org/repo", Digest: "sha256:" + strings.Repeat("a", 64)}
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	table := []struct {
+		format   string
+		expected map[string]interface{}
+	}{
+		{"SPDX", map[string]interface{}{"spdxVersion": "SPDX-2.3", "documentNamespace": "https://quay.io/org/repo/sbom/" + subject.Digest}},
+		{"cyclonedx", map[string]interface{}{"bomFormat": "CycloneDX", "specVersion": "1.5"}},
+	}
+
+	for _, tt := range table {
+		format, err := ParseFormat(tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := Encode(format, subject, inventory, created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := Encode(format, subject, inventory, created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, again) {
+			t.Errorf("%s: encoding the same inventory twice gave different SBOMs", tt.format)
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range tt.expected {
+			if doc[key] != value {
+				t.Errorf("%s: got %s %v, wanted %v", tt.format, key, doc[key], value)
+			}
+		}
+		if !strings.Contains(string(data), "pkg:apk/alpine/musl@1.2.4-r2") {
+			t.Errorf("%s: SBOM doesn't list musl:\n%s", tt.format, data)
+		}
+	}
+
+	if _, err := ParseFormat("swid"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}